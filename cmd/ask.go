@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/chand1012/git2gpt/llm"
+	"github.com/chand1012/git2gpt/prompt"
+	"github.com/spf13/cobra"
+)
+
+// The endpoint settings are only flags of ask; the other commands that
+// send requests, for --summarize, use these defaults.
+var baseURL = envOr("OPENAI_BASE_URL", llm.DefaultBaseURL)
+var modelName string
+var apiKeyEnv = llm.DefaultAPIKeyEnv
+var contextWindow int64
+var maxAnswerTokens int64
+var mapReduce bool
+var batchTokens int64
+var concurrency int
+var retries = 3
+var transcriptPath string
+var summaryBaseURL string
+var summaryModel string
+
+// newLLMClient returns a client for the endpoint selected on the command
+// line.
+func newLLMClient() *llm.Client {
+	return llm.NewClient(llm.Config{
+		BaseURL:       baseURL,
+		Model:         modelName,
+		APIKey:        llm.APIKeyFromEnv(apiKeyEnv),
+		ContextWindow: contextWindow,
+		MaxTokens:     maxAnswerTokens,
+		Retries:       retries,
+	})
+}
+
+// envOr returns the environment variable name, or def when it is unset.
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// defaultModelName is the default of --model.
+func defaultModelName() string {
+	return envOr("OPENAI_MODEL", prompt.DefaultOpenAIModel)
+}
+
+// addEndpointFlags registers the flags of ask that select and limit the chat
+// completions endpoint. The model flags come with addRepoFlags.
+func addEndpointFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&baseURL, "base-url", envOr("OPENAI_BASE_URL", llm.DefaultBaseURL), "base URL of an OpenAI-compatible API, up to and including /v1 (default from $OPENAI_BASE_URL)")
+	cmd.Flags().StringVar(&apiKeyEnv, "api-key-env", llm.DefaultAPIKeyEnv, "environment variable holding the API key")
+	cmd.Flags().Int64Var(&contextWindow, "context-window", 128000, "context window of the model in tokens; larger prompts are not sent. 0 disables the check")
+	cmd.Flags().IntVar(&retries, "retries", 3, "how often --map-reduce and --summarize retry a request that failed with a rate limit, server or network error")
+}
+
+// addModelFlags registers the model and answer limit, which the request
+// body formats name and --summarize defaults to.
+func addModelFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&modelName, "model", defaultModelName(), "model to ask, also named in the request body of --format openai and anthropic (default from $OPENAI_MODEL)")
+	cmd.Flags().Int64Var(&maxAnswerTokens, "max-answer-tokens", 4096, "tokens reserved for the answer")
+}
+
+// addSummaryFlags registers the flags that choose who writes the summaries
+// of --summarize.
+func addSummaryFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&concurrency, "concurrency", 4, "requests to send at once for --summarize and ask --map-reduce")
+	cmd.Flags().StringVar(&summaryBaseURL, "summary-base-url", "", "base URL of the API that writes --summarize summaries (default: --base-url for ask, else $OPENAI_BASE_URL or the OpenAI API)")
+	cmd.Flags().StringVar(&summaryModel, "summary-model", "", "model that writes --summarize summaries (default: --model)")
+}
+
+// newSummarizer returns the summarizer for --summarize, which may use a
+// different endpoint and model than questions do.
+func newSummarizer() *llm.Summarizer {
+	client := newLLMClient()
+	if summaryBaseURL != "" {
+		client = llm.NewClient(client.Config)
+		client.BaseURL = strings.TrimRight(summaryBaseURL, "/")
+	}
+	if summaryModel != "" {
+		client.Model = summaryModel
+	}
+	client.ContextWindow, client.MaxTokens = 0, 0
+	return &llm.Summarizer{Client: client}
+}
+
+var askCmd = &cobra.Command{
+	Use:   "ask [flags] /path/to/git/repository [...] \"question\"",
+	Short: "Ask a question about the repository of an OpenAI-compatible chat completions API",
+	Long: `Ask a question about the repository of an OpenAI-compatible chat completions API.
+
+The last argument is the question, unless it is an existing path or the only
+argument; then the task must be given with --question, --instructions or
+--task. The snapshot is sent
+in the plain text format and the answer is streamed to standard output.
+
+With --map-reduce, a repository too large for one request is split into
+batches. Each batch is asked for notes on the question, and the notes are
+combined into the answer in further requests. A transcript of every request
+is saved.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		paths := args
+		if len(args) > 1 {
+			last := args[len(args)-1]
+			// A path is never taken for the question: with the task given
+			// by flags it is one of the repositories, otherwise the
+			// question is missing.
+			if _, err := os.Stat(last); err == nil {
+				if question == "" && instructionsFile == "" && taskPreset == "" {
+					return fmt.Errorf("no question given: the last argument %s is a path, give the question after it or with --question", last)
+				}
+			} else {
+				paths = args[:len(args)-1]
+				question = strings.TrimSpace(question + "\n\n" + last)
+			}
+		}
+		if selectedFormat() != prompt.FormatText {
+			return fmt.Errorf("ask always sends the plain text format")
+		}
+		if question == "" && instructionsFile == "" && taskPreset == "" {
+			return fmt.Errorf("no question given")
+		}
+		if err := validateRepoFlags(paths); err != nil {
+			return err
+		}
+		if outputFile != "" {
+			if _, err := os.Stat(outputFile); err == nil {
+				return fmt.Errorf("output file %s already exists", outputFile)
+			}
+		}
+		closeCache, err := openCache()
+		if err != nil {
+			return err
+		}
+		defer closeCache()
+		ctx := cmd.Context()
+		repo, err := buildRepo(ctx, paths, nil, true)
+		if err != nil {
+			return err
+		}
+		defer printSkipped(repo)
+		client := newLLMClient()
+		if mapReduce {
+			return askMapReduce(ctx, cmd, client, repo)
+		}
+		snapshot, err := renderOutput(ctx, cmd, repo)
+		if err != nil {
+			return err
+		}
+		if err := client.CheckWindow(repo.TotalTokens); err != nil {
+			return fmt.Errorf("%w; narrow the selection with --include, --ignore or --grep, or raise --context-window", err)
+		}
+		if err := saveManifest(repo); err != nil {
+			return err
+		}
+		answer, err := client.Stream(ctx, []llm.Message{{Role: "user", Content: snapshot}}, os.Stdout)
+		if err != nil {
+			return err
+		}
+		if !strings.HasSuffix(answer, "\n") {
+			fmt.Println()
+		}
+		if outputFile != "" {
+			return os.WriteFile(outputFile, []byte(answer), 0644)
+		}
+		return nil
+	},
+}
+
+// askMapReduce answers the question in batches with llm.MapReduce and saves
+// the transcript, also when the run fails.
+func askMapReduce(ctx context.Context, cmd *cobra.Command, client *llm.Client, repo *prompt.GitRepo) error {
+	budget := batchTokens
+	if budget <= 0 {
+		// Leave room for the answer, the preamble and the instructions.
+		budget = contextWindow - maxAnswerTokens - 2000
+		if contextWindow <= 0 || budget <= 0 {
+			return fmt.Errorf("set --batch-tokens, or a --context-window large enough to derive it from")
+		}
+	}
+	path := transcriptPath
+	if path == "" {
+		dir, err := prompt.DefaultCacheDir()
+		if err != nil {
+			return fmt.Errorf("could not locate cache directory for the transcript, set --transcript: %w", err)
+		}
+		path = filepath.Join(dir, "transcripts", time.Now().Format("20060102-150405")+".json")
+	}
+	question := repo.Task
+	repo.Task = ""
+	var done int32
+	transcript, err := llm.MapReduce(ctx, client, repo, question, llm.MapReduceOptions{
+		BatchTokens: budget,
+		Concurrency: concurrency,
+		Render: func(ctx context.Context, batch *prompt.GitRepo) (string, error) {
+			return renderOutput(ctx, cmd, batch)
+		},
+		OnStep: func(step llm.Step) {
+			n := atomic.AddInt32(&done, 1)
+			status := "done"
+			if step.Error != "" {
+				status = "failed: " + step.Error
+			}
+			fmt.Fprintf(os.Stderr, "[%d] %s step %d %s\n", n, step.Phase, step.Index+1, status)
+		},
+	})
+	if saveErr := transcript.WriteFile(path); saveErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", saveErr)
+	} else {
+		fmt.Fprintf(os.Stderr, "Transcript saved to %s\n", path)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(strings.TrimRight(transcript.Answer, "\n"))
+	if outputFile != "" {
+		return os.WriteFile(outputFile, []byte(transcript.Answer), 0644)
+	}
+	return nil
+}
+
+func init() {
+	addRepoFlags(askCmd)
+	addOutputFlags(askCmd)
+	addEndpointFlags(askCmd)
+	askCmd.Flags().BoolVar(&mapReduce, "map-reduce", false, "split a repository too large for one request into batches, ask each, and combine the answers")
+	askCmd.Flags().Int64Var(&batchTokens, "batch-tokens", 0, "with --map-reduce, tokens of files per batch (default: derived from --context-window)")
+	askCmd.Flags().StringVar(&transcriptPath, "transcript", "", "with --map-reduce, where to save the transcript (default: transcripts in the git2gpt cache directory)")
+	askCmd.Flags().Lookup("output").Usage = "also save the answer to this file"
+	askCmd.Example = "  OPENAI_API_KEY=... git2gpt ask . \"Where is the configuration parsed?\"\n  git2gpt ask --base-url http://localhost:11434/v1 --model llama3 -t review ."
+	rootCmd.AddCommand(askCmd)
+}
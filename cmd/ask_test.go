@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAskQuestionArgument(t *testing.T) {
+	first := writeRepo(t, map[string]string{"a.go": "package a\n"})
+	second := writeRepo(t, map[string]string{"b.go": "package b\n"})
+
+	// A repository is never taken for the question.
+	_, _, err := runCommand(t, "ask", first, second)
+	if err == nil || !strings.Contains(err.Error(), "is a path") {
+		t.Fatalf("ask with two repositories and no question: %v", err)
+	}
+
+	// With --question, every argument is a repository. Nothing listens at
+	// the endpoint, so getting that far is enough.
+	endpoint := []string{"--base-url", "http://127.0.0.1:1/v1", "--retries", "0"}
+	_, _, err = runCommand(t, append([]string{"ask", "-q", "Why?", first, second}, endpoint...)...)
+	if err == nil || strings.Contains(err.Error(), "question") || strings.Contains(err.Error(), "path") {
+		t.Errorf("ask with --question and two repositories: %v", err)
+	}
+	_, _, err = runCommand(t, append([]string{"ask", first, "Why?"}, endpoint...)...)
+	if err == nil || strings.Contains(err.Error(), "question") {
+		t.Errorf("ask with a question argument: %v", err)
+	}
+}
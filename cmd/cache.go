@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chand1012/git2gpt/prompt"
+	"github.com/spf13/cobra"
+)
+
+var useCache bool
+var cacheDir string
+var cacheMaxMB int64
+var pruneMaxAge time.Duration
+var pruneAll bool
+
+// tokenizer counts the tokens of files and outputs. openCache backs it with
+// the on-disk cache.
+var tokenizer = prompt.DefaultTokenizer
+
+// openCache enables the on-disk cache when --cache is set. The returned
+// function trims the cache to its size limit and should run once the output
+// has been produced.
+func openCache() (func(), error) {
+	if !useCache {
+		return func() {}, nil
+	}
+	cache, err := loadCache()
+	if err != nil {
+		return nil, err
+	}
+	tokenizer = cache.Tokenizer(prompt.DefaultTokenizer)
+	return func() {
+		tokenizer = prompt.DefaultTokenizer
+		if _, err := cache.Prune(cacheMaxMB<<20, 0); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+		}
+	}, nil
+}
+
+func loadCache() (*prompt.DiskCache, error) {
+	dir := cacheDir
+	if dir == "" {
+		var err error
+		dir, err = prompt.DefaultCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("could not locate cache directory: %w", err)
+		}
+	}
+	return prompt.OpenDiskCache(dir)
+}
+
+// addCacheFlags registers the flags that locate and size the on-disk cache.
+func addCacheFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory of the on-disk cache (default: git2gpt in the user cache directory)")
+	cmd.Flags().Int64Var(&cacheMaxMB, "cache-max-mb", prompt.DefaultCacheMaxSize>>20, "maximum size of the on-disk cache in megabytes")
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the on-disk cache of token counts and transformed files",
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove old entries from the on-disk cache",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cache, err := loadCache()
+		if err != nil {
+			return err
+		}
+		var result prompt.PruneResult
+		if pruneAll {
+			result, err = cache.Clear()
+		} else {
+			result, err = cache.Prune(cacheMaxMB<<20, pruneMaxAge)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d entries (%d bytes) from %s; %d bytes remain\n", result.Removed, result.FreedBytes, cache.Dir(), result.Remaining)
+		return nil
+	},
+}
+
+func init() {
+	addCacheFlags(cachePruneCmd)
+	cachePruneCmd.Flags().DurationVar(&pruneMaxAge, "max-age", 0, "also remove entries not used within this duration, e.g. 720h")
+	cachePruneCmd.Flags().BoolVar(&pruneAll, "all", false, "remove every entry, including the summaries of --summarize")
+	cacheCmd.AddCommand(cachePruneCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
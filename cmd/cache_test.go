@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/chand1012/git2gpt/prompt"
+)
+
+func TestCacheColdAndWarm(t *testing.T) {
+	dir := writeRepo(t, map[string]string{
+		"main.go":     "package main\n\n// main does nothing.\nfunc main() {}\n",
+		"lib/util.go": "package lib\n\n/* Util is a helper. */\nfunc Util() int { return 1 }\n",
+	})
+	cacheDir := t.TempDir()
+	args := []string{"--cache", "--cache-dir", cacheDir, "--scrub-comments", "--format", "json", dir}
+	cold, _, err := runCommand(t, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil || len(entries) == 0 {
+		t.Fatalf("the cold run cached nothing in %s", cacheDir)
+	}
+	warm, _, err := runCommand(t, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cold != warm {
+		t.Errorf("warm output differs from cold output:\n%s\n---\n%s", cold, warm)
+	}
+	uncached, _, err := runCommand(t, "--scrub-comments", "--format", "json", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uncached != cold {
+		t.Errorf("output with the cache differs from the output without it")
+	}
+	if tokenizer != prompt.DefaultTokenizer {
+		t.Error("the cached tokenizer outlived the run")
+	}
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/chand1012/git2gpt/prompt"
+	"github.com/spf13/cobra"
+)
+
+var chunkOptions = prompt.DefaultChunkOptions
+
+var chunksCmd = &cobra.Command{
+	Use:   "chunks [flags] /path/to/git/repository [/path/to/another/repository ...]",
+	Short: "Split the files into chunks and write them as JSON Lines for retrieval and embedding pipelines",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateRepoFlags(args); err != nil {
+			return err
+		}
+		closeCache, err := openCache()
+		if err != nil {
+			return err
+		}
+		defer closeCache()
+		repo, err := buildRepo(cmd.Context(), args, nil, false)
+		if err != nil {
+			return err
+		}
+		defer printSkipped(repo)
+		opts := chunkOptions
+		opts.Tokenizer = tokenizer
+		chunks, err := prompt.ChunkRepo(repo, opts)
+		if err != nil {
+			return err
+		}
+		var out io.Writer = os.Stdout
+		if outputFile != "" {
+			if _, err := os.Stat(outputFile); err == nil {
+				return fmt.Errorf("output file %s already exists", outputFile)
+			}
+			f, err := os.Create(outputFile)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		w := bufio.NewWriter(out)
+		enc := json.NewEncoder(w)
+		for _, chunk := range chunks {
+			if err := enc.Encode(chunk); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	addRepoFlags(chunksCmd)
+	addOutputFlags(chunksCmd)
+	chunksCmd.Flags().Int64Var(&chunkOptions.MaxTokens, "max-tokens", chunkOptions.MaxTokens, "maximum tokens per chunk")
+	chunksCmd.Flags().Int64Var(&chunkOptions.Overlap, "overlap", chunkOptions.Overlap, "tokens of the previous chunk to repeat at the start of the next")
+	chunksCmd.Example = "  git2gpt chunks --max-tokens 256 . > chunks.jsonl"
+	rootCmd.AddCommand(chunksCmd)
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/chand1012/git2gpt/mcp"
+	"github.com/spf13/cobra"
+)
+
+var mcpCmd = &cobra.Command{
+	Use:   "mcp [flags] [/path/to/git/repository]",
+	Short: "Run a Model Context Protocol server for a repository over stdio",
+	Long: `Run a Model Context Protocol server for a repository over stdin and stdout.
+
+The server offers the tools list_files, read_files, snapshot_repo and
+token_stats, and publishes the repository's files as git2gpt:///path resources.
+The repository defaults to the current directory.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo := "."
+		if len(args) == 1 {
+			repo = args[0]
+		}
+		closeCache, err := openCache()
+		if err != nil {
+			return err
+		}
+		defer closeCache()
+		srv := &mcp.Server{
+			RepoPath:        repo,
+			IgnoreFilePath:  ignoreFilePath,
+			IncludeFilePath: includeFilePath,
+			UseGitignore:    !ignoreGitignore,
+			Version:         rootCmd.Version,
+			Tokenizer:       tokenizer,
+		}
+		return srv.ServeContext(cmd.Context(), os.Stdin, os.Stdout)
+	},
+}
+
+func init() {
+	mcpCmd.Flags().StringVarP(&ignoreFilePath, "ignore", "i", "", "path to .gptignore file")
+	mcpCmd.Flags().StringVarP(&includeFilePath, "include", "I", "", "path to .gptinclude file")
+	mcpCmd.Flags().BoolVarP(&ignoreGitignore, "ignore-gitignore", "g", false, "ignore .gitignore file")
+	mcpCmd.Flags().BoolVar(&useCache, "cache", false, "reuse token counts and transformed files from the on-disk cache")
+	addCacheFlags(mcpCmd)
+	mcpCmd.Example = `  git2gpt mcp /path/to/repo
+
+  # in an MCP client configuration:
+  {"command": "git2gpt", "args": ["mcp", "/path/to/repo"]}`
+	rootCmd.AddCommand(mcpCmd)
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chand1012/git2gpt/prompt"
+)
+
+var showProgress bool
+
+// progressInterval limits how often the progress line is redrawn.
+const progressInterval = 100 * time.Millisecond
+
+// progressLine shows the progress of buildRepo as a single line on stderr
+// that is rewritten in place. Its methods do nothing on a nil receiver, so
+// callers need not check whether progress was requested.
+type progressLine struct {
+	finished prompt.Progress // totals of the repositories already processed
+	current  prompt.Progress
+	drawn    time.Time
+}
+
+// callback returns the function to hand to the prompt package.
+func (p *progressLine) callback() prompt.ProgressFunc {
+	if p == nil {
+		return nil
+	}
+	return func(current prompt.Progress) {
+		p.current = current
+		if time.Since(p.drawn) >= progressInterval {
+			p.draw()
+		}
+	}
+}
+
+// next moves on to the following repository.
+func (p *progressLine) next() {
+	if p == nil {
+		return
+	}
+	p.finished.FilesScanned += p.current.FilesScanned
+	p.finished.FilesIncluded += p.current.FilesIncluded
+	p.finished.Bytes += p.current.Bytes
+	p.finished.Tokens += p.current.Tokens
+	p.current = prompt.Progress{}
+}
+
+func (p *progressLine) draw() {
+	p.drawn = time.Now()
+	fmt.Fprintf(os.Stderr, "\rScanned %d files, included %d (%s, %d tokens)",
+		p.finished.FilesScanned+p.current.FilesScanned,
+		p.finished.FilesIncluded+p.current.FilesIncluded,
+		formatBytes(p.finished.Bytes+p.current.Bytes),
+		p.finished.Tokens+p.current.Tokens)
+}
+
+// done draws the final totals and ends the line.
+func (p *progressLine) done() {
+	if p == nil {
+		return
+	}
+	p.draw()
+	fmt.Fprintln(os.Stderr)
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// canceledStatus returns the exit status shells use for SIGINT, after
+// saying so, when err comes from an interrupt, and 0 otherwise.
+func canceledStatus(err error) int {
+	var canceled *prompt.CanceledError
+	if errors.As(err, &canceled) {
+		fmt.Fprintln(os.Stderr, "Interrupted")
+		return 130
+	}
+	return 0
+}
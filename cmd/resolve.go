@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chand1012/git2gpt/prompt"
+	"github.com/spf13/cobra"
+)
+
+var lineNumbers bool
+var fileIDs bool
+var manifestPath string
+
+// saveManifest writes the manifest of the files next to the output, or to
+// --manifest. Without anywhere to put it, there is nothing to save.
+func saveManifest(repo *prompt.GitRepo) error {
+	path := manifestPath
+	if path == "" && outputFile != "" {
+		path = outputFile + prompt.ManifestSuffix
+	}
+	if path == "" {
+		return nil
+	}
+	return prompt.NewRenderedManifest(repo, scrubComments).WriteFile(path)
+}
+
+// findManifest locates the manifest to resolve citations with: the file
+// given, the manifest of a given output file, or the only manifest in the
+// current directory.
+func findManifest(path string) (string, error) {
+	if path != "" {
+		if !strings.HasSuffix(path, prompt.ManifestSuffix) {
+			if _, err := os.Stat(path + prompt.ManifestSuffix); err == nil {
+				return path + prompt.ManifestSuffix, nil
+			}
+		}
+		return path, nil
+	}
+	matches, _ := filepath.Glob("*" + prompt.ManifestSuffix)
+	if len(matches) != 1 {
+		return "", fmt.Errorf("found %d manifests in the current directory, choose one with --manifest", len(matches))
+	}
+	return matches[0], nil
+}
+
+var resolveCmd = &cobra.Command{
+	Use:   "resolve [flags] CITATION...",
+	Short: "Map citations such as F3kq9:L30-42 back to file paths",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := findManifest(manifestPath)
+		if err != nil {
+			return err
+		}
+		manifest, err := prompt.ReadManifest(path)
+		if err != nil {
+			return err
+		}
+		for _, arg := range args {
+			citation, err := prompt.ParseCitation(arg)
+			if err != nil {
+				return err
+			}
+			file, err := manifest.Resolve(citation)
+			if err != nil {
+				return err
+			}
+			location := filepath.Join(file.Root, filepath.FromSlash(file.Path))
+			switch {
+			case citation.Start == 0:
+			case citation.Start == citation.End:
+				location += fmt.Sprintf(":%d", citation.Start)
+			default:
+				location += fmt.Sprintf(":%d-%d", citation.Start, citation.End)
+			}
+			fmt.Println(location)
+		}
+		return nil
+	},
+}
+
+func init() {
+	resolveCmd.Flags().StringVarP(&manifestPath, "manifest", "m", "", "manifest to read, or the output file it was saved next to")
+	resolveCmd.Example = "  git2gpt --file-ids --line-numbers -o out.txt .\n  git2gpt resolve -m out.txt F3kq9:L30-42"
+	rootCmd.AddCommand(resolveCmd)
+}
@@ -1,7 +1,10 @@
 package cmd
 import (
+        "context"
         "fmt"
         "os"
+        "os/signal"
+        "regexp"
         "github.com/chand1012/git2gpt/prompt"
         "github.com/spf13/cobra"
 )
@@ -14,119 +17,465 @@ var includeFilePath string // New: Add variable for include file path
 var ignoreGitignore bool
 var outputJSON bool
 var outputXML bool
+var outputFormat string
+var cacheControl bool
 var debug bool
 var scrubComments bool
+var historyCount int
+var historyOnlyIncluded bool
+var fileCommits bool
+var onError prompt.ErrorPolicy
+var filesFrom string
+var applyIgnore bool
+var grepPattern string
+var excerptContext int
+var summarizePatterns []string
+var gitRef string
+var submoduleMode prompt.SubmoduleMode
+var symlinkPolicy prompt.SymlinkPolicy
 var rootCmd = &cobra.Command{
         Use:   "git2gpt [flags] /path/to/git/repository [/path/to/another/repository ...]",
         Short: "git2gpt is a utility to convert one or more Git repositories to a text file for input into an LLM",
         Args:  cobra.MinimumNArgs(1),
         Run: func(cmd *cobra.Command, args []string) {
-                combinedRepo := &prompt.GitRepo{
-                        Files: []prompt.GitFile{},
-                }
-                for _, path := range args {
-                        repoPath = path
-                        ignoreList := prompt.GenerateIgnoreList(repoPath, ignoreFilePath, !ignoreGitignore)
-                        includeList := prompt.GenerateIncludeList(repoPath, includeFilePath) // New: Generate include list
-                        repo, err := prompt.ProcessGitRepo(repoPath, includeList, ignoreList) // Modified: Pass includeList
-                        if err != nil {
-                                fmt.Printf("Error processing %s: %s\n", repoPath, err)
-                                os.Exit(1)
-                        }
-                        combinedRepo.Files = append(combinedRepo.Files, repo.Files...)
+                if status := runRoot(cmd, args); status != 0 {
+                        os.Exit(status)
                 }
-                combinedRepo.FileCount = len(combinedRepo.Files)
-                if outputJSON {
-                        output, err := prompt.MarshalRepo(combinedRepo, scrubComments)
-                        if err != nil {
-                                fmt.Printf("Error: %s\n", err)
-                                os.Exit(1)
+        },
+}
+// runRoot runs the root command and returns its exit status. It does not
+// exit itself, so the deferred cache trimming and skipped-file report also
+// happen when it fails.
+func runRoot(cmd *cobra.Command, args []string) int {
+        if err := validateRepoFlags(args); err != nil {
+                fmt.Printf("Error: %s\n", err)
+                return 1
+        }
+        var prices []prompt.ModelPrice
+        if showCost {
+                var err error
+                if prices, err = loadPricing(); err != nil {
+                        fmt.Printf("Error: %s\n", err)
+                        return 1
+                }
+        }
+        closeCache, err := openCache()
+        if err != nil {
+                fmt.Printf("Error: %s\n", err)
+                return 1
+        }
+        defer closeCache()
+        combinedRepo, err := buildRepo(cmd.Context(), args, nil, true)
+        if err != nil {
+                if status := canceledStatus(err); status != 0 {
+                        return status
+                }
+                fmt.Printf("Error processing %s: %s\n", repoPath, err)
+                return 1
+        }
+        defer printSkipped(combinedRepo)
+        output, err := renderOutput(cmd.Context(), cmd, combinedRepo)
+        if err != nil {
+                if status := canceledStatus(err); status != 0 {
+                        return status
+                }
+                fmt.Printf("Error: %s\n", err)
+                return 1
+        }
+        if outputFile != "" {
+                if _, err := os.Stat(outputFile); err == nil {
+                        fmt.Printf("Error: output file %s already exists\n", outputFile)
+                        return 1
+                }
+                err = os.WriteFile(outputFile, []byte(output), 0644)
+                if err != nil {
+                        fmt.Printf("Error: could not write to output file %s\n", outputFile)
+                        return 1
+                }
+                if err := saveManifest(combinedRepo); err != nil {
+                        fmt.Printf("Error: %s\n", err)
+                        return 1
+                }
+        } else {
+                if !debug {
+                        fmt.Println(output)
+                }
+                if err := saveManifest(combinedRepo); err != nil {
+                        fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+                        return 1
+                }
+        }
+        if estimateTokens && selectedFormat() == prompt.FormatText {
+                fmt.Printf("Estimated number of tokens: %d\n", prompt.EstimateTokens(output))
+        }
+        if showCost {
+                printCosts(os.Stderr, prompt.EstimateCosts(output, prices))
+        }
+        return 0
+}
+// buildRepo processes every path and combines the files into a single
+// GitRepo. The git history is only read when withHistory is set.
+func buildRepo(ctx context.Context, paths []string, cache *prompt.TokenCache, withHistory bool) (*prompt.GitRepo, error) {
+        combinedRepo := &prompt.GitRepo{
+                Files: []prompt.GitFile{},
+        }
+        var grep *regexp.Regexp
+        if grepPattern != "" {
+                grep = regexp.MustCompile(grepPattern) // checked by validateRepoFlags
+        }
+        var progress *progressLine
+        if showProgress {
+                progress = &progressLine{}
+                defer progress.done()
+        }
+        for _, path := range paths {
+                repoPath = path
+                if isArchive(path) {
+                        opts := prompt.ArchiveOptions{
+                                ProcessOptions: prompt.ProcessOptions{Progress: progress.callback(), OnError: onError, Tokenizer: tokenizer},
+                                IgnoreFile:     ignoreFilePath,
+                                IncludeFile:    includeFilePath,
+                                UseGitignore:   !ignoreGitignore,
+                                Limits:         prompt.DefaultArchiveLimits,
                         }
-                        if outputFile != "" {
-                                if _, err := os.Stat(outputFile); err == nil {
-                                        fmt.Printf("Error: output file %s already exists\n", outputFile)
-                                        os.Exit(1)
-                                }
-                                err = os.WriteFile(outputFile, []byte(output), 0644)
-                                if err != nil {
-                                        fmt.Printf("Error: could not write to output file %s\n", outputFile)
-                                        os.Exit(1)
-                                }
-                        } else {
-                                if !debug {
-                                        fmt.Println(string(output))
-                                }
+                        repo, err := prompt.ProcessArchive(ctx, path, opts)
+                        if err != nil {
+                                return nil, err
                         }
-                        return
+                        progress.next()
+                        // Archives have no history; validateRepoFlags
+                        // rejects --history and --file-commits for them.
+                        addRepo(combinedRepo, repo, grep)
+                        continue
                 }
-                if outputXML {
-                        output, err := prompt.OutputGitRepoXML(combinedRepo, scrubComments)
+                if gitRef != "" || prompt.IsBareSource(path) {
+                        repo, err := processTree(ctx, path, progress.callback())
                         if err != nil {
-                                fmt.Printf("Error: %s\n", err)
-                                os.Exit(1)
+                                return nil, err
                         }
-                        if err := prompt.ValidateXML(output); err != nil {
-                                fmt.Printf("Error: %s\n", err)
-                                os.Exit(1)
-                        }
-                        if outputFile != "" {
-                                if _, err := os.Stat(outputFile); err == nil {
-                                        fmt.Printf("Error: output file %s already exists\n", outputFile)
-                                        os.Exit(1)
-                                }
-                                err = os.WriteFile(outputFile, []byte(output), 0644)
-                                if err != nil {
-                                        fmt.Printf("Error: could not write to output file %s\n", outputFile)
-                                        os.Exit(1)
-                                }
-                        } else {
-                                if !debug {
-                                        fmt.Println(output)
+                        progress.next()
+                        if withHistory {
+                                if err := loadHistory(path, repo); err != nil {
+                                        return nil, err
                                 }
                         }
-                        return
+                        addRepo(combinedRepo, repo, grep)
+                        continue
                 }
-                output, err := prompt.OutputGitRepo(combinedRepo, preambleFile, scrubComments)
+                ignoreList, err := prompt.LoadIgnoreList(repoPath, ignoreFilePath, !ignoreGitignore)
                 if err != nil {
-                        fmt.Printf("Error: %s\n", err)
-                        os.Exit(1)
+                        return nil, err
+                }
+                includeList, err := prompt.LoadIncludeList(repoPath, includeFilePath) // New: Generate include list
+                if err != nil {
+                        return nil, err
                 }
-                if outputFile != "" {
-                        if _, err := os.Stat(outputFile); err == nil {
-                                fmt.Printf("Error: output file %s already exists\n", outputFile)
-                                os.Exit(1)
+                opts := prompt.ProcessOptions{
+                        Cache:           cache,
+                        Progress:        progress.callback(),
+                        OnError:         onError,
+                        Symlinks:        symlinkPolicy,
+                        Submodules:      submoduleMode,
+                        IgnoreGitignore: ignoreGitignore,
+                        Tokenizer:       tokenizer,
+                }
+                var repo *prompt.GitRepo
+                if filesFrom != "" {
+                        listed, err := loadFileList()
+                        if err != nil {
+                                return nil, err
+                        }
+                        if !applyIgnore {
+                                ignoreList = nil
                         }
-                        err = os.WriteFile(outputFile, []byte(output), 0644)
+                        repo, err = prompt.ProcessFileList(ctx, repoPath, listed, ignoreList, opts)
                         if err != nil {
-                                fmt.Printf("Error: could not write to output file %s\n", outputFile)
-                                os.Exit(1)
+                                return nil, err
                         }
                 } else {
-                        if !debug {
-                                fmt.Println(output)
+                        repo, err = prompt.ProcessGitRepoContext(ctx, repoPath, includeList, ignoreList, opts)
+                        if err != nil {
+                                return nil, err
                         }
                 }
-                if estimateTokens {
-                        fmt.Printf("Estimated number of tokens: %d\n", prompt.EstimateTokens(output))
+                progress.next()
+                if withHistory {
+                        if err := loadHistory(repoPath, repo); err != nil {
+                                return nil, err
+                        }
                 }
-        },
+                addRepo(combinedRepo, repo, grep)
+        }
+        combinedRepo.FileCount = len(combinedRepo.Files)
+        if len(summarizePatterns) > 0 {
+                if err := summarizeFiles(ctx, combinedRepo); err != nil {
+                        return nil, err
+                }
+        }
+        guidance, task, err := loadTask()
+        if err != nil {
+                return nil, err
+        }
+        combinedRepo.Guidance, combinedRepo.Task = guidance, task
+        if fileIDs {
+                prompt.AssignFileIDs(combinedRepo)
+        }
+        if lineNumbers {
+                prompt.NumberLinesWith(combinedRepo, tokenizer)
+        }
+        return combinedRepo, nil
+}
+// processTree reads the tree of --ref, or of HEAD, from the object database
+// of the repository at path. This is how bare repositories and bundles are
+// read, since they have no working tree.
+func processTree(ctx context.Context, path string, report prompt.ProgressFunc) (*prompt.GitRepo, error) {
+        tree, err := prompt.OpenGitTree(path, gitRef)
+        if err != nil {
+                return nil, err
+        }
+        defer tree.Close()
+        includeList, err := tree.IncludeList(includeFilePath)
+        if err != nil {
+                return nil, err
+        }
+        ignoreList, err := tree.IgnoreList(ignoreFilePath, !ignoreGitignore)
+        if err != nil {
+                return nil, err
+        }
+        opts := prompt.ProcessOptions{
+                Progress:  report,
+                OnError:   onError,
+                Symlinks:  symlinkPolicy,
+                Tokenizer: tokenizer,
+        }
+        repo, err := tree.Process(ctx, includeList, ignoreList, opts)
+        if err != nil {
+                return nil, err
+        }
+        if submoduleMode != prompt.SkipSubmodules {
+                if repo.Submodules, err = tree.Submodules(); err != nil {
+                        return nil, err
+                }
+        }
+        return repo, nil
+}
+// loadHistory attaches the history selected on the command line to repo.
+func loadHistory(path string, repo *prompt.GitRepo) error {
+        opts := prompt.HistoryOptions{Count: historyCount, OnlyIncluded: historyOnlyIncluded, FileCommits: fileCommits, Rev: gitRef}
+        return prompt.LoadHistory(path, repo, opts)
+}
+// addRepo filters the files of repo with --grep and adds them to the
+// combined repository.
+func addRepo(combinedRepo, repo *prompt.GitRepo, grep *regexp.Regexp) {
+        if grep != nil {
+                prompt.FilterByContent(repo, grep)
+                if excerptContext >= 0 {
+                        prompt.ExcerptMatches(repo, grep, excerptContext)
+                }
+        }
+        combinedRepo.Files = append(combinedRepo.Files, repo.Files...)
+        combinedRepo.History = append(combinedRepo.History, repo.History...)
+        combinedRepo.Skipped = append(combinedRepo.Skipped, repo.Skipped...)
+        combinedRepo.Submodules = append(combinedRepo.Submodules, repo.Submodules...)
+}
+// isArchive reports whether path is an archive file rather than a
+// directory.
+func isArchive(path string) bool {
+        if !prompt.IsArchive(path) {
+                return false
+        }
+        info, err := os.Stat(path)
+        return err == nil && info.Mode().IsRegular()
+}
+// summarizeFiles replaces the files selected by --summarize with summaries.
+// Summaries are always kept in the on-disk cache, since they are expensive to
+// write and must be available offline.
+func summarizeFiles(ctx context.Context, repo *prompt.GitRepo) error {
+        cache, err := loadCache()
+        if err != nil {
+                return err
+        }
+        return prompt.SummarizeFiles(ctx, repo, newSummarizer(), prompt.SummaryOptions{
+                Patterns:    summarizePatterns,
+                Cache:       cache,
+                Concurrency: concurrency,
+                OnError:     onError,
+                Tokenizer:   tokenizer,
+        })
+}
+// validateRepoFlags checks the combinations of flags that buildRepo relies
+// on, so mistakes are reported before any work is done.
+func validateRepoFlags(paths []string) error {
+        if filesFrom != "" && len(paths) > 1 {
+                return fmt.Errorf("--files-from takes a single repository")
+        }
+        if filesFrom != "" && isArchive(paths[0]) {
+                return fmt.Errorf("--files-from cannot be used with an archive")
+        }
+        if filesFrom != "" && (gitRef != "" || prompt.IsBareSource(paths[0])) {
+                return fmt.Errorf("--files-from reads the working tree and cannot be used with --ref, bare repositories or bundles")
+        }
+        if historyCount > 0 || fileCommits {
+                for _, path := range paths {
+                        if isArchive(path) {
+                                return fmt.Errorf("--history and --file-commits cannot be used with the archive %s, which has no git history", path)
+                        }
+                }
+        }
+        if grepPattern != "" {
+                if _, err := regexp.Compile(grepPattern); err != nil {
+                        return fmt.Errorf("invalid --grep pattern: %w", err)
+                }
+        } else if excerptContext >= 0 {
+                return fmt.Errorf("--excerpt requires --grep")
+        }
+        switch outputFormat {
+        case "", prompt.FormatText, prompt.FormatJSON, prompt.FormatXML, prompt.FormatOpenAI, prompt.FormatAnthropic:
+        default:
+                return fmt.Errorf("unknown --format %q", outputFormat)
+        }
+        if outputFormat != "" && (outputJSON || outputXML) {
+                return fmt.Errorf("--format cannot be combined with --json or --xml")
+        }
+        if cacheControl && selectedFormat() != prompt.FormatAnthropic {
+                return fmt.Errorf("--cache-control requires --format anthropic")
+        }
+        if err := prompt.ValidatePatterns(summarizePatterns); err != nil {
+                return fmt.Errorf("invalid --summarize pattern: %w", err)
+        }
+        if _, _, err := loadTask(); err != nil {
+                return err
+        }
+        return nil
+}
+// fileList holds the paths read for --files-from. Standard input can only be
+// read once, so the list is kept for later rebuilds in watch mode.
+var fileList []string
+var fileListLoaded bool
+func loadFileList() ([]string, error) {
+        if fileListLoaded {
+                return fileList, nil
+        }
+        r := os.Stdin
+        if filesFrom != "-" {
+                f, err := os.Open(filesFrom)
+                if err != nil {
+                        return nil, err
+                }
+                defer f.Close()
+                r = f
+        }
+        list, err := prompt.ReadFileList(r)
+        if err != nil {
+                return nil, err
+        }
+        fileList, fileListLoaded = list, true
+        return fileList, nil
+}
+// printSkipped lists the files left out because they could not be read, on
+// stderr so it does not mix with the output.
+func printSkipped(repo *prompt.GitRepo) {
+        if len(repo.Skipped) == 0 {
+                return
+        }
+        fmt.Fprintf(os.Stderr, "Skipped %d unreadable files:\n", len(repo.Skipped))
+        for _, f := range repo.Skipped {
+                fmt.Fprintf(os.Stderr, "  %s: %s\n", f.Path, f.Reason)
+        }
+}
+// selectedFormat returns the output format selected with --format, --json or
+// --xml.
+func selectedFormat() string {
+        switch {
+        case outputFormat != "":
+                return outputFormat
+        case outputJSON:
+                return prompt.FormatJSON
+        case outputXML:
+                return prompt.FormatXML
+        }
+        return prompt.FormatText
+}
+// renderOutput formats repo in the format selected on the command line.
+func renderOutput(ctx context.Context, cmd *cobra.Command, repo *prompt.GitRepo) (string, error) {
+        return renderFormat(ctx, cmd, repo, selectedFormat())
+}
+// renderFormat formats repo in format, with the options given to cmd on the
+// command line.
+func renderFormat(ctx context.Context, cmd *cobra.Command, repo *prompt.GitRepo, format string) (string, error) {
+        switch format {
+        case prompt.FormatOpenAI, prompt.FormatAnthropic:
+                opts := prompt.RequestOptions{
+                        Model:        modelName,
+                        MaxTokens:    int(maxAnswerTokens),
+                        CacheControl: cacheControl,
+                }
+                // The default of --model is an OpenAI model, so Anthropic
+                // requests only name a model that was given.
+                if format == prompt.FormatAnthropic && !cmd.Flags().Changed("model") {
+                        opts.Model = ""
+                }
+                return prompt.RenderRepoWith(ctx, repo, format, preambleFile, scrubComments, opts, tokenizer)
+        }
+        return prompt.RenderRepoWith(ctx, repo, format, preambleFile, scrubComments, prompt.RequestOptions{}, tokenizer)
+}
+// addRepoFlags registers the flags that control which files are read and how
+// the output is formatted.
+func addRepoFlags(cmd *cobra.Command) {
+        cmd.Flags().StringVarP(&preambleFile, "preamble", "p", "", "path to preamble text file")
+        cmd.Flags().StringVarP(&ignoreFilePath, "ignore", "i", "", "path to .gptignore file")
+        cmd.Flags().StringVarP(&includeFilePath, "include", "I", "", "path to .gptinclude file") // New: Add flag for include file
+        cmd.Flags().BoolVarP(&ignoreGitignore, "ignore-gitignore", "g", false, "ignore .gitignore file")
+        // A command that gives --json a meaning of its own registers it first.
+        if cmd.Flags().Lookup("json") == nil {
+                cmd.Flags().BoolVarP(&outputJSON, "json", "j", false, "output JSON")
+        }
+        cmd.Flags().BoolVarP(&outputXML, "xml", "x", false, "output XML")
+        cmd.Flags().StringVar(&outputFormat, "format", "", "output format: text, json, xml, or the request body of the openai or anthropic API, using --model, --max-answer-tokens and the question")
+        cmd.Flags().BoolVar(&cacheControl, "cache-control", false, "with --format anthropic, mark the preamble and files for prompt caching")
+        cmd.Flags().BoolVarP(&scrubComments, "scrub-comments", "s", false, "scrub comments from the output. Decreases token count")
+        cmd.Flags().IntVar(&historyCount, "history", 0, "append the last N commits from the local git history")
+        cmd.Flags().StringVar(&gitRef, "ref", "", "read the files of this branch, tag or commit from the git objects instead of the working tree (default for bare repositories and bundles: HEAD)")
+        cmd.Flags().Var(&symlinkPolicy, "symlinks", "how to read symbolic links: files reads linked files inside the repository, follow also walks linked directories, skip leaves links out and record outputs their targets instead of the contents")
+        cmd.Flags().Var(&submoduleMode, "submodules", "how to treat git submodules: include the checked out ones, list them without their files, or skip them")
+        cmd.Flags().BoolVar(&historyOnlyIncluded, "history-included-only", false, "only list commits and files that are part of the output in the history")
+        cmd.Flags().BoolVar(&fileCommits, "file-commits", false, "record the last commit that modified each file")
+        cmd.Flags().StringVar(&filesFrom, "files-from", "", "read the files to include from this file, or - for stdin, one per line or NUL separated")
+        cmd.Flags().BoolVar(&applyIgnore, "apply-ignore", false, "apply the ignore rules to the files read with --files-from")
+        cmd.Flags().StringVar(&grepPattern, "grep", "", "only include files whose contents match this regular expression")
+        cmd.Flags().IntVar(&excerptContext, "excerpt", -1, "with --grep, only output the matching regions with this many lines of context")
+        cmd.Flags().BoolVar(&lineNumbers, "line-numbers", false, "prefix every line with its line number")
+        cmd.Flags().BoolVar(&fileIDs, "file-ids", false, "give every file a short ID derived from its path, such as F3kq9, for citations, and save a manifest for the resolve command")
+        cmd.Flags().Var(&onError, "on-error", "what to do with files that cannot be read: skip, warn or fail")
+        cmd.Flags().BoolVar(&useCache, "cache", false, "reuse token counts and transformed files from the on-disk cache")
+        addCacheFlags(cmd)
+        addTaskFlags(cmd)
+        cmd.Flags().StringArrayVar(&summarizePatterns, "summarize", nil, "replace files matching this pattern with summaries written by the model; can be repeated")
+        addSummaryFlags(cmd)
+        addModelFlags(cmd)
+}
+// addOutputFlags registers the flags that name the files a command writes,
+// for the commands that write them.
+func addOutputFlags(cmd *cobra.Command) {
+        cmd.Flags().StringVarP(&outputFile, "output", "o", "", "path to output file")
+        cmd.Flags().StringVar(&manifestPath, "manifest", "", "where to save the manifest of the files, with their checksums and file IDs (default: the output file with "+prompt.ManifestSuffix+" appended)")
 }
 func init() {
-        rootCmd.Flags().StringVarP(&preambleFile, "preamble", "p", "", "path to preamble text file")
-        rootCmd.Flags().StringVarP(&outputFile, "output", "o", "", "path to output file")
+        addRepoFlags(rootCmd)
+        addOutputFlags(rootCmd)
         rootCmd.Flags().BoolVarP(&estimateTokens, "estimate", "e", false, "estimate the number of tokens in the output")
-        rootCmd.Flags().StringVarP(&ignoreFilePath, "ignore", "i", "", "path to .gptignore file")
-        rootCmd.Flags().StringVarP(&includeFilePath, "include", "I", "", "path to .gptinclude file") // New: Add flag for include file
-        rootCmd.Flags().BoolVarP(&ignoreGitignore, "ignore-gitignore", "g", false, "ignore .gitignore file")
-        rootCmd.Flags().BoolVarP(&outputJSON, "json", "j", false, "output JSON")
-        rootCmd.Flags().BoolVarP(&outputXML, "xml", "x", false, "output XML")
         rootCmd.Flags().BoolVarP(&debug, "debug", "d", false, "debug mode. Do not output to standard output")
-        rootCmd.Flags().BoolVarP(&scrubComments, "scrub-comments", "s", false, "scrub comments from the output. Decreases token count")
+        addCostFlags(rootCmd)
+        rootCmd.Flags().BoolVar(&showProgress, "progress", false, "show files scanned, files included, bytes and tokens on stderr while working")
         rootCmd.Example = "  git2gpt /path/to/repo1 /path/to/repo2\n  git2gpt -o output.txt /path/to/repo1 /path/to/repo2"
 }
 func Execute() {
-        if err := rootCmd.Execute(); err != nil {
+        // Interrupting cancels the run, so work stops between files instead of
+        // the process dying mid-write.
+        ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+        defer stop()
+        if err := rootCmd.ExecuteContext(ctx); err != nil {
                 fmt.Println(err)
                 os.Exit(1)
         }
-}
\ No newline at end of file
+}
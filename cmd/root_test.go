@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chand1012/git2gpt/prompt"
+	"github.com/spf13/cobra"
+)
+
+func TestAnthropicModel(t *testing.T) {
+	dir := writeRepo(t, map[string]string{"main.go": "package main\n"})
+	model := func(args ...string) string {
+		t.Helper()
+		out, _, err := runCommand(t, append(args, dir)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			Model string `json:"model"`
+		}
+		if err := json.Unmarshal([]byte(out), &body); err != nil {
+			t.Fatalf("not a request body: %v\n%s", err, out)
+		}
+		return body.Model
+	}
+	// The default of --model is an OpenAI model, so it is not sent to
+	// Anthropic, but giving it explicitly is respected.
+	if got := model("--format", "anthropic"); got != prompt.DefaultAnthropicModel {
+		t.Errorf("model without --model = %q, want %q", got, prompt.DefaultAnthropicModel)
+	}
+	if got := model("--format", "anthropic", "--model", defaultModelName()); got != defaultModelName() {
+		t.Errorf("model with --model %s = %q", defaultModelName(), got)
+	}
+	if got := model("--format", "openai"); got != defaultModelName() {
+		t.Errorf("openai model = %q, want %q", got, defaultModelName())
+	}
+}
+
+func TestArchiveHistoryFlags(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "drop.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("package main\n"))
+	zw.Close()
+	f.Close()
+
+	if _, _, err := runCommand(t, "stats", archive); err != nil {
+		t.Fatalf("archive without history flags: %v", err)
+	}
+	for _, flag := range []string{"--history=3", "--file-commits"} {
+		if _, _, err := runCommand(t, "stats", flag, archive); err == nil || !strings.Contains(err.Error(), "no git history") {
+			t.Errorf("%s with an archive: %v", flag, err)
+		}
+	}
+}
+
+func TestSkippedReportedOnFailure(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir := writeRepo(t, map[string]string{"main.go": "package main\n"})
+	if err := os.Symlink(outside, filepath.Join(dir, "escape.txt")); err != nil {
+		t.Skipf("symbolic links not supported: %v", err)
+	}
+	existing := filepath.Join(t.TempDir(), "out.txt")
+	if err := os.WriteFile(existing, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Record the exit status instead of exiting the test binary.
+	status := -1
+	savedRun := rootCmd.Run
+	rootCmd.Run = func(cmd *cobra.Command, args []string) { status = runRoot(cmd, args) }
+	defer func() { rootCmd.Run = savedRun }()
+	out, errOut, err := runCommand(t, "--on-error", "skip", "--symlinks", "follow", "-o", existing, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != 1 || !strings.Contains(out, "already exists") {
+		t.Errorf("status %d, output %q, want a failure on the existing output file", status, out)
+	}
+	if !strings.Contains(errOut, "Skipped 1 unreadable files") || !strings.Contains(errOut, "escape.txt") {
+		t.Errorf("the skipped file was not reported on failure:\n%s", errOut)
+	}
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/chand1012/git2gpt/server"
+	"github.com/spf13/cobra"
+)
+
+// readHeaderTimeout bounds how long a client may take to send the request
+// headers, so slow clients cannot hold connections open.
+const readHeaderTimeout = 10 * time.Second
+
+var serveAddr string
+var serveRoot string
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve repository snapshots over a read-only HTTP API",
+	Long: `Serve repository snapshots over a read-only HTTP API.
+
+Endpoints:
+  GET /repos                   list the repositories below --root
+  GET /repos/{name}/files      list the selected files and their token counts
+  GET /repos/{name}/snapshot   render a snapshot of the repository
+
+Query parameters: format=text|json|xml|openai|anthropic, ref, include, ignore, gitignore=false,
+budget, scrub=true, and model, max_tokens and question for the request body
+formats.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		srv, err := server.New(serveRoot)
+		if err != nil {
+			return err
+		}
+		closeCache, err := openCache()
+		if err != nil {
+			return err
+		}
+		defer closeCache()
+		srv.Tokenizer = tokenizer
+		fmt.Printf("Serving repositories below %s on %s\n", srv.Root, serveAddr)
+		return listenAndServe(cmd.Context(), &http.Server{Addr: serveAddr, Handler: srv, ReadHeaderTimeout: readHeaderTimeout})
+	},
+}
+
+// listenAndServe runs hs until it fails or ctx is done. Interrupting then
+// stops accepting connections and lets the requests in flight finish.
+func listenAndServe(ctx context.Context, hs *http.Server) error {
+	errc := make(chan error, 1)
+	go func() { errc <- hs.ListenAndServe() }()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	if err := hs.Shutdown(context.Background()); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveAddr, "addr", "localhost:8080", "address to listen on")
+	serveCmd.Flags().StringVar(&serveRoot, "root", ".", "directory containing the repositories to serve")
+	serveCmd.Flags().BoolVar(&useCache, "cache", false, "reuse token counts and transformed files from the on-disk cache")
+	addCacheFlags(serveCmd)
+	serveCmd.Example = "  git2gpt serve --addr :8080 --root ~/src\n  curl 'localhost:8080/repos/git2gpt/snapshot?format=json&include=*.go'"
+	rootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestListenAndServeShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- listenAndServe(ctx, &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()})
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("listenAndServe: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("listenAndServe did not return after the context was cancelled")
+	}
+
+	hs := &http.Server{Addr: "127.0.0.1:-1"}
+	if err := listenAndServe(context.Background(), hs); err == nil {
+		t.Error("listenAndServe on an invalid address succeeded")
+	}
+}
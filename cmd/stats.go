@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/chand1012/git2gpt/prompt"
+	"github.com/spf13/cobra"
+)
+
+var showCost bool
+var pricingFile string
+var statsTop int
+var statsJSON bool
+
+// loadPricing returns the pricing table: the built-in one with the entries
+// of --pricing, or of the pricing file in the config directory, on top.
+func loadPricing() ([]prompt.ModelPrice, error) {
+	if pricingFile != "" {
+		return prompt.LoadPricing(pricingFile, true)
+	}
+	dir := presetConfigDir()
+	if dir == "" {
+		return prompt.LoadPricing("", false)
+	}
+	return prompt.LoadPricing(prompt.PricingFile(dir), false)
+}
+
+// printCosts writes the cost estimates as a table. Approximate token counts
+// are marked with a tilde.
+func printCosts(w io.Writer, estimates []prompt.CostEstimate) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Model\tTokens\tInput cost\tContext window\t")
+	for _, e := range estimates {
+		window := "unknown"
+		if e.ContextWindow > 0 {
+			window = fmt.Sprint(e.ContextWindow)
+		}
+		if e.ExceedsWindow {
+			window += " (exceeded)"
+		}
+		tokens := fmt.Sprint(e.Tokens)
+		if e.Approximate {
+			tokens = "~" + tokens
+		}
+		fmt.Fprintf(tw, "%s\t%s\t$%.4f\t%s\t\n", e.Model, tokens, e.InputCost, window)
+	}
+	tw.Flush()
+}
+
+// addCostFlags registers the flags that estimate the cost of the output.
+func addCostFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&showCost, "cost", false, "print the estimated input cost of the output for each model in the pricing table to stderr")
+	cmd.Flags().StringVar(&pricingFile, "pricing", "", "JSON file with model prices and context windows, added to the built-in table (default: pricing.json in the config directory)")
+}
+
+type fileStats struct {
+	Path   string `json:"path"`
+	Tokens int64  `json:"tokens"`
+}
+
+type repoStats struct {
+	Files   int                   `json:"files"`
+	Tokens  int64                 `json:"tokens"`
+	Format  string                `json:"format"`
+	Largest []fileStats           `json:"largest_files"`
+	Costs   []prompt.CostEstimate `json:"costs"`
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats [flags] /path/to/git/repository [/path/to/another/repository ...]",
+	Short: "Show the token count, largest files and estimated cost of the output",
+	Long: `Show the token count, largest files and estimated cost of the output.
+
+The output is rendered in the format selected with --format or --xml, and
+priced for every model in the pricing table. --json prints the statistics as
+JSON instead of a table; it does not select the format that is measured, which
+is done with --format json.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateRepoFlags(args); err != nil {
+			return err
+		}
+		prices, err := loadPricing()
+		if err != nil {
+			return err
+		}
+		closeCache, err := openCache()
+		if err != nil {
+			return err
+		}
+		defer closeCache()
+		ctx := cmd.Context()
+		repo, err := buildRepo(ctx, args, nil, true)
+		if err != nil {
+			return err
+		}
+		defer printSkipped(repo)
+		format := selectedFormat()
+		output, err := renderFormat(ctx, cmd, repo, format)
+		if err != nil {
+			return err
+		}
+
+		stats := repoStats{
+			Files:  repo.FileCount,
+			Tokens: repo.TotalTokens,
+			Format: format,
+			Costs:  prompt.EstimateCosts(output, prices),
+		}
+		files := append([]prompt.GitFile(nil), repo.Files...)
+		sort.SliceStable(files, func(i, j int) bool { return files[i].Tokens > files[j].Tokens })
+		if len(files) > statsTop {
+			files = files[:statsTop]
+		}
+		stats.Largest = []fileStats{}
+		for _, f := range files {
+			stats.Largest = append(stats.Largest, fileStats{Path: filepath.ToSlash(f.Path), Tokens: f.Tokens})
+		}
+		if statsJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(stats)
+		}
+		fmt.Printf("Files: %d\nTotal tokens: %d (%s format)\nLargest files:\n", stats.Files, stats.Tokens, stats.Format)
+		for _, f := range stats.Largest {
+			fmt.Printf("  %s: %d tokens\n", f.Path, f.Tokens)
+		}
+		fmt.Println()
+		printCosts(os.Stdout, stats.Costs)
+		return nil
+	},
+}
+
+func init() {
+	statsCmd.Flags().BoolVarP(&statsJSON, "json", "j", false, "print the statistics as JSON")
+	addRepoFlags(statsCmd)
+	statsCmd.Flags().StringVar(&pricingFile, "pricing", "", "JSON file with model prices and context windows, added to the built-in table (default: pricing.json in the config directory)")
+	statsCmd.Flags().IntVar(&statsTop, "top", 10, "number of largest files to list")
+	statsCmd.Example = "  git2gpt stats .\n  git2gpt stats --json --format anthropic ."
+	rootCmd.AddCommand(statsCmd)
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// runCommand runs git2gpt with args and returns what it wrote to stdout and
+// stderr. The flags of the command are reset afterwards, since they are
+// package variables shared by every run.
+func runCommand(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	capture := func(f **os.File) func() string {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved := *f
+		*f = w
+		var buf bytes.Buffer
+		done := make(chan struct{})
+		go func() {
+			io.Copy(&buf, r)
+			close(done)
+		}()
+		return func() string {
+			w.Close()
+			*f = saved
+			<-done
+			return buf.String()
+		}
+	}
+	stdout, stderr := capture(&os.Stdout), capture(&os.Stderr)
+	rootCmd.SetArgs(args)
+	cmd, err := rootCmd.ExecuteContextC(context.Background())
+	out, errOut := stdout(), stderr()
+	resetFlags(cmd)
+	rootCmd.SetArgs(nil)
+	return out, errOut, err
+}
+
+// resetFlags sets the flags of cmd that were given back to their defaults.
+func resetFlags(cmd *cobra.Command) {
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if !f.Changed {
+			return
+		}
+		if v, ok := f.Value.(pflag.SliceValue); ok {
+			v.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+}
+
+// writeRepo creates a directory holding files.
+func writeRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, contents := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestStats(t *testing.T) {
+	dir := writeRepo(t, map[string]string{"main.go": "package main\n", "util.go": "package main\n\nfunc util() {}\n"})
+	pricing := filepath.Join(t.TempDir(), "pricing.json")
+	if err := os.WriteFile(pricing, []byte(`{"local": {"input_per_million": 1, "context_window": 1}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, _, err := runCommand(t, "stats", "--json", "--pricing", pricing, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats repoStats
+	if err := json.Unmarshal([]byte(out), &stats); err != nil {
+		t.Fatalf("stats --json is not JSON: %v\n%s", err, out)
+	}
+	// --json formats the statistics; the measured output stays text.
+	if stats.Files != 2 || stats.Format != "text" || len(stats.Largest) != 2 {
+		t.Errorf("stats = %+v", stats)
+	}
+	var local bool
+	for _, c := range stats.Costs {
+		local = local || c.Model == "local"
+	}
+	if !local || len(stats.Costs) < 2 {
+		t.Errorf("costs = %+v, want the built-in models and local", stats.Costs)
+	}
+
+	out, _, err = runCommand(t, "stats", "--format", "json", "--top", "1", "--pricing", pricing, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Files: 2\n", "(json format)", "Model", "local"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("stats table lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, ".go: ") != 1 {
+		t.Errorf("--top 1 listed another number of files:\n%s", out)
+	}
+	// The flags of one run do not leak into the next.
+	if statsJSON || outputFormat != "" {
+		t.Errorf("flags were not reset: json %v, format %q", statsJSON, outputFormat)
+	}
+	// stats writes no files, so it has no flags to name them.
+	for _, flag := range []string{"--output", "--manifest"} {
+		if _, _, err := runCommand(t, "stats", flag, filepath.Join(t.TempDir(), "out"), dir); err == nil {
+			t.Errorf("stats accepted %s", flag)
+		}
+	}
+}
+
+func TestCost(t *testing.T) {
+	dir := writeRepo(t, map[string]string{"main.go": "package main\n"})
+	pricing := filepath.Join(t.TempDir(), "pricing.json")
+	if err := os.WriteFile(pricing, []byte(`{"local": {"input_per_million": 1, "context_window": 1}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, errOut, err := runCommand(t, "--cost", "--pricing", pricing, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "main.go") || strings.Contains(out, "Input cost") {
+		t.Errorf("stdout should hold the output alone:\n%s", out)
+	}
+	for _, want := range []string{"Model", "Input cost", "gpt-4o", "local"} {
+		if !strings.Contains(errOut, want) {
+			t.Errorf("cost table on stderr lacks %q:\n%s", want, errOut)
+		}
+	}
+
+	if err := os.WriteFile(pricing, []byte(`{"local": {"encoding": "unknown"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := runCommand(t, "stats", "--pricing", pricing, dir); err == nil {
+		t.Error("stats accepted a pricing file with an unknown encoding")
+	}
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/chand1012/git2gpt/prompt"
+	"github.com/spf13/cobra"
+)
+
+var question string
+var instructionsFile string
+var taskPreset string
+var configDir string
+
+// presetConfigDir returns the config directory to look for user presets in.
+// Without --config-dir, a missing user config directory just means there are
+// no user presets.
+func presetConfigDir() string {
+	if configDir != "" {
+		return configDir
+	}
+	dir, err := prompt.DefaultConfigDir()
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+// loadTask assembles the guidance for the preamble and the instructions that
+// follow the repository from --task, --instructions and --question, in that
+// order.
+func loadTask() (guidance, instructions string, err error) {
+	var preset prompt.Preset
+	if taskPreset != "" {
+		preset, err = prompt.LoadPreset(presetConfigDir(), taskPreset)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	if instructionsFile != "" {
+		data, err := os.ReadFile(instructionsFile)
+		if err != nil {
+			return "", "", fmt.Errorf("error reading instructions file: %w", err)
+		}
+		preset.Instructions = strings.TrimSpace(preset.Instructions + "\n\n" + string(data))
+	}
+	guidance, instructions = preset.Task(question)
+	return guidance, instructions, nil
+}
+
+var tasksCmd = &cobra.Command{
+	Use:   "tasks",
+	Short: "List the presets available to --task",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := presetConfigDir()
+		presets, err := prompt.Presets(dir)
+		if err != nil {
+			return err
+		}
+		for _, preset := range presets {
+			fmt.Printf("%-12s %s\n", preset.Name, preset.Description)
+		}
+		if dir != "" {
+			fmt.Printf("\nAdd your own presets as JSON files in %s\n", prompt.PresetDir(dir))
+		}
+		return nil
+	},
+}
+
+// addTaskFlags registers the flags that append a task to the output.
+func addTaskFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&question, "question", "q", "", "append this question or task after the repository")
+	cmd.Flags().StringVar(&instructionsFile, "instructions", "", "append the instructions in this file after the repository")
+	cmd.Flags().StringVarP(&taskPreset, "task", "t", "", "use a preset preamble and instructions: review, explain, write-tests, document, find-bugs or one of your own (see git2gpt tasks)")
+	cmd.Flags().StringVar(&configDir, "config-dir", "", "directory with user presets in its presets subdirectory (default: git2gpt in the user config directory)")
+}
+
+func init() {
+	tasksCmd.Flags().StringVar(&configDir, "config-dir", "", "directory with user presets in its presets subdirectory (default: git2gpt in the user config directory)")
+	rootCmd.AddCommand(tasksCmd)
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/chand1012/git2gpt/prompt"
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify MANIFEST [PATH...]",
+	Short: "Check that a repository still holds the files recorded in a manifest",
+	Long: `Verify compares the files listed in a manifest, saved next to the output
+of an earlier run, with the repositories they were read from. Every file must
+have the size and SHA-256 it had when it was read. Files added since are
+not reported.
+
+Each file is checked in the directory or archive recorded in the manifest.
+Files read from a bare repository, a bundle or with --ref are checked in the
+commit they were read from. To check a tree that was moved or copied, give a PATH for each repository of
+the manifest, in the order they were given to the run.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := findManifest(args[0])
+		if err != nil {
+			return err
+		}
+		manifest, err := prompt.ReadManifest(path)
+		if err != nil {
+			return err
+		}
+		mismatches, err := prompt.VerifyManifest(manifest, args[1:])
+		if err != nil {
+			return err
+		}
+		// From here on, a failure is a finding rather than a usage mistake.
+		cmd.SilenceUsage = true
+		multiple := len(manifest.Roots()) > 1
+		for _, m := range mismatches {
+			if multiple {
+				fmt.Printf("%s: %s: %s\n", m.Root, m.Path, m.Reason)
+			} else {
+				fmt.Printf("%s: %s\n", m.Path, m.Reason)
+			}
+		}
+		if len(mismatches) > 0 {
+			return fmt.Errorf("%d of %d files differ from the manifest", len(mismatches), len(manifest.Files))
+		}
+		fmt.Printf("%d files match %s\n", len(manifest.Files), manifest.Digest)
+		return nil
+	},
+}
+
+func init() {
+	verifyCmd.Example = "  git2gpt -o out.txt . ../lib\n  git2gpt verify out.txt\n  git2gpt verify out.txt" + prompt.ManifestSuffix + " /mnt/copy/app /mnt/copy/lib"
+	rootCmd.AddCommand(verifyCmd)
+}
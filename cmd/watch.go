@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chand1012/git2gpt/prompt"
+	"github.com/spf13/cobra"
+)
+
+var watchInterval time.Duration
+var watchDebounce time.Duration
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [flags] /path/to/git/repository [/path/to/another/repository ...]",
+	Short: "Regenerate the output file whenever files in the repository change",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateRepoFlags(args); err != nil {
+			return err
+		}
+		closeCache, err := openCache()
+		if err != nil {
+			return err
+		}
+		defer closeCache()
+		return watch(cmd.Context(), cmd, args)
+	},
+}
+
+// watch writes the output file for paths, then rebuilds it whenever their
+// files change, until ctx is done. cmd holds the flags to render with.
+// Changes are detected by polling with scanRepos, which reads no files, so
+// summaries, the task and token counts are only produced by rebuilds.
+func watch(ctx context.Context, cmd *cobra.Command, paths []string) error {
+	cache := prompt.NewTokenCache()
+	stamps, err := scanRepos(ctx, paths)
+	if err != nil {
+		return err
+	}
+	current, err := rebuild(ctx, cmd, paths, cache, nil)
+	if err != nil {
+		return err
+	}
+	watched := strings.Join(paths, ", ")
+	for {
+		if !sleepContext(ctx, watchInterval) {
+			return nil
+		}
+		next, err := scanRepos(ctx, paths)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error processing %s: %s\n", watched, err)
+			continue
+		}
+		if sameStamps(stamps, next) {
+			continue
+		}
+		settled, err := waitForQuiet(ctx, paths, next)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error processing %s: %s\n", watched, err)
+			continue
+		}
+		// Changes made during the rebuild show up in the next scan.
+		stamps = settled
+		rebuilt, err := rebuild(ctx, cmd, paths, cache, current)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			continue
+		}
+		current = rebuilt
+	}
+}
+
+// scanRepos takes a stat-only snapshot of what buildRepo reads from paths:
+// the size and modification time of every selected file and archive, and
+// the commit of every tree read from the object database, as a key of its
+// own.
+func scanRepos(ctx context.Context, paths []string) (map[string]prompt.FileStamp, error) {
+	stamps := map[string]prompt.FileStamp{}
+	for _, path := range paths {
+		switch {
+		case isArchive(path):
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			stamps[path] = prompt.FileStamp{Size: info.Size(), ModTime: info.ModTime()}
+		case gitRef != "" || prompt.IsBareSource(path):
+			tree, err := prompt.OpenGitTree(path, gitRef)
+			if err != nil {
+				return nil, err
+			}
+			stamps[path+"@"+tree.Commit.String()] = prompt.FileStamp{}
+			tree.Close()
+		default:
+			ignoreList, err := prompt.LoadIgnoreList(path, ignoreFilePath, !ignoreGitignore)
+			if err != nil {
+				return nil, err
+			}
+			includeList, err := prompt.LoadIncludeList(path, includeFilePath)
+			if err != nil {
+				return nil, err
+			}
+			// Files that vanish during the scan are left to the rebuild.
+			files, err := prompt.StatGitRepo(ctx, path, includeList, ignoreList, prompt.ProcessOptions{
+				OnError:         prompt.SkipOnError,
+				Symlinks:        symlinkPolicy,
+				Submodules:      submoduleMode,
+				IgnoreGitignore: ignoreGitignore,
+			})
+			if err != nil {
+				return nil, err
+			}
+			for p, stamp := range files {
+				stamps[p] = stamp
+			}
+		}
+	}
+	return stamps, nil
+}
+
+// sameStamps reports whether two scans of scanRepos saw the same files.
+func sameStamps(a, b map[string]prompt.FileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for p, stamp := range a {
+		other, ok := b[p]
+		if !ok || other.Size != stamp.Size || !other.ModTime.Equal(stamp.ModTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// waitForQuiet scans until two consecutive scans, watchDebounce apart, see
+// the same files, so a burst of saves produces a single rebuild. It returns
+// the last scan.
+func waitForQuiet(ctx context.Context, paths []string, last map[string]prompt.FileStamp) (map[string]prompt.FileStamp, error) {
+	for {
+		if !sleepContext(ctx, watchDebounce) {
+			return nil, ctx.Err()
+		}
+		next, err := scanRepos(ctx, paths)
+		if err != nil {
+			return nil, err
+		}
+		if sameStamps(last, next) {
+			return next, nil
+		}
+		last = next
+	}
+}
+
+// rebuild regenerates the output file and prints what changed since previous,
+// which is nil for the initial build. When no selected file changed, as
+// after saving a file without changing it, the output is left alone and
+// previous is returned.
+func rebuild(ctx context.Context, cmd *cobra.Command, paths []string, cache *prompt.TokenCache, previous *prompt.GitRepo) (*prompt.GitRepo, error) {
+	repo, err := buildRepo(ctx, paths, cache, true)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil && prompt.DiffRepos(previous, repo).Empty() {
+		return previous, nil
+	}
+	output, err := renderOutput(ctx, cmd, repo)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(outputFile, []byte(output), 0644); err != nil {
+		return nil, fmt.Errorf("could not write to output file %s", outputFile)
+	}
+	if err := saveManifest(repo); err != nil {
+		return nil, err
+	}
+	printSkipped(repo)
+	stamp := time.Now().Format("15:04:05")
+	if previous == nil {
+		fmt.Printf("[%s] wrote %s: %d files, %d tokens\n", stamp, outputFile, repo.FileCount, repo.TotalTokens)
+		return repo, nil
+	}
+	fmt.Printf("[%s] %s; %d files, %d tokens\n", stamp, summarizeDiff(prompt.DiffRepos(previous, repo)), repo.FileCount, repo.TotalTokens)
+	return repo, nil
+}
+
+// sleepContext waits for d and reports whether ctx is still live.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func summarizeDiff(diff prompt.RepoDiff) string {
+	var parts []string
+	for _, group := range []struct {
+		verb  string
+		paths []string
+	}{
+		{"modified", diff.Modified},
+		{"added", diff.Added},
+		{"removed", diff.Removed},
+	} {
+		if len(group.paths) == 0 {
+			continue
+		}
+		names := group.paths
+		if len(names) > 3 {
+			names = append(names[:3:3], fmt.Sprintf("%d more", len(group.paths)-3))
+		}
+		parts = append(parts, fmt.Sprintf("%s %s", group.verb, strings.Join(names, ", ")))
+	}
+	if len(parts) == 0 {
+		return "no changes"
+	}
+	return strings.Join(parts, "; ")
+}
+
+func init() {
+	addRepoFlags(watchCmd)
+	addOutputFlags(watchCmd)
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", 500*time.Millisecond, "how often to check the repository for changes")
+	watchCmd.Flags().DurationVar(&watchDebounce, "debounce", 300*time.Millisecond, "how long the repository must be unchanged before rebuilding")
+	watchCmd.MarkFlagRequired("output")
+	watchCmd.Example = "  git2gpt watch -o output.txt /path/to/repo"
+	rootCmd.AddCommand(watchCmd)
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chand1012/git2gpt/prompt"
+)
+
+// setWatchFlags shortens the watch intervals and points the output file into
+// a temporary directory for the duration of the test.
+func setWatchFlags(t *testing.T) string {
+	t.Helper()
+	out := filepath.Join(t.TempDir(), "out.txt")
+	savedInterval, savedDebounce, savedOutput := watchInterval, watchDebounce, outputFile
+	watchInterval, watchDebounce, outputFile = 10*time.Millisecond, 20*time.Millisecond, out
+	t.Cleanup(func() {
+		watchInterval, watchDebounce, outputFile = savedInterval, savedDebounce, savedOutput
+	})
+	return out
+}
+
+func TestSummarizeDiff(t *testing.T) {
+	tests := []struct {
+		diff prompt.RepoDiff
+		want string
+	}{
+		{prompt.RepoDiff{}, "no changes"},
+		{prompt.RepoDiff{Modified: []string{"a"}}, "modified a"},
+		{prompt.RepoDiff{Added: []string{"a", "b", "c", "d", "e"}}, "added a, b, c, 2 more"},
+		{
+			prompt.RepoDiff{Modified: []string{"a"}, Added: []string{"b"}, Removed: []string{"c", "d"}},
+			"modified a; added b; removed c, d",
+		},
+	}
+	for _, tt := range tests {
+		if got := summarizeDiff(tt.diff); got != tt.want {
+			t.Errorf("summarizeDiff(%+v) = %q, want %q", tt.diff, got, tt.want)
+		}
+	}
+}
+
+func TestScanRepos(t *testing.T) {
+	dir := writeRepo(t, map[string]string{"main.go": "package main\n", ".gptignore": "build\n", "build/out.bin": "1"})
+	ctx := context.Background()
+	// Scanning reads no files, so it neither loads the task nor fails on a
+	// missing instructions file; only a rebuild would.
+	saved := instructionsFile
+	instructionsFile = filepath.Join(dir, "missing.txt")
+	defer func() { instructionsFile = saved }()
+	before, err := scanRepos(ctx, []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := before[filepath.Join(dir, "main.go")]; !ok {
+		t.Errorf("scan lacks main.go: %v", before)
+	}
+
+	// Ignored files do not count as changes.
+	later := time.Now().Add(time.Minute)
+	if err := os.WriteFile(filepath.Join(dir, "build", "out.bin"), []byte("22"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	after, err := scanRepos(ctx, []string{dir})
+	if err != nil || !sameStamps(before, after) {
+		t.Errorf("an ignored file changed the scan: %v, %v", after, err)
+	}
+	if err := os.Chtimes(filepath.Join(dir, "main.go"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if after, err = scanRepos(ctx, []string{dir}); err != nil || sameStamps(before, after) {
+		t.Errorf("a modified file did not change the scan: %v", err)
+	}
+}
+
+func TestWaitForQuiet(t *testing.T) {
+	setWatchFlags(t)
+	dir := writeRepo(t, map[string]string{"main.go": "package main\n"})
+	ctx := context.Background()
+	last, err := scanRepos(ctx, []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep saving the file for a while; waitForQuiet only returns once the
+	// saves stop, so it sees the last version.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			os.WriteFile(filepath.Join(dir, "main.go"), []byte(strings.Repeat("x", i+1)), 0644)
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+	settled, err := waitForQuiet(ctx, []string{dir}, last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	default:
+		t.Fatal("waitForQuiet returned while the file was still changing")
+	}
+	if stamp := settled[filepath.Join(dir, "main.go")]; len(settled) != 1 || stamp.Size != 10 {
+		t.Errorf("settled on %+v, want the last save", settled)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := waitForQuiet(canceled, []string{dir}, settled); err == nil {
+		t.Error("waitForQuiet ignored a canceled context")
+	}
+}
+
+func TestWatchRebuildsOnChange(t *testing.T) {
+	out := setWatchFlags(t)
+	dir := writeRepo(t, map[string]string{"main.go": "package main\n"})
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- watch(ctx, watchCmd, []string{dir}) }()
+	defer func() {
+		cancel()
+		if err := <-result; err != nil {
+			t.Errorf("watch returned %v", err)
+		}
+	}()
+
+	waitForOutput := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if b, err := os.ReadFile(out); err == nil && strings.Contains(string(b), want) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		b, _ := os.ReadFile(out)
+		t.Fatalf("output never contained %q:\n%s", want, b)
+	}
+	waitForOutput("package main")
+	if err := os.WriteFile(filepath.Join(dir, "added.go"), []byte("func added() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitForOutput("func added() {}")
+}
@@ -0,0 +1,294 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// IsBundle reports whether path is a git bundle file, judging by its
+// signature.
+func IsBundle(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	return err == nil && (line == "# v2 git bundle\n" || line == "# v3 git bundle\n")
+}
+
+// OpenBundle opens a git bundle, as written by git bundle create, as a
+// read-only repository. Its refs come from the bundle header, and its
+// packfile is indexed in memory. Objects of prerequisite commits are not in
+// the bundle, so trees that need them cannot be read.
+func OpenBundle(path string) (*Repository, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	refs, packStart, err := readBundleHeader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("bundle %s: %w", path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	pack := &packfile{
+		r:      io.NewSectionReader(f, packStart, info.Size()-packStart),
+		closer: f,
+		size:   info.Size() - packStart,
+	}
+	if err := pack.index(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("bundle %s: %w", path, err)
+	}
+	if _, ok := refs["HEAD"]; !ok {
+		if h, ok := defaultBundleHead(refs); ok {
+			refs["HEAD"] = h
+		}
+	}
+	return &Repository{GitDir: path, commonDir: path, Bare: true, bundleRefs: refs, packs: []*packfile{pack}, packsRead: true}, nil
+}
+
+// readBundleHeader parses the header of a version 2 or 3 bundle and returns
+// its refs and the offset of the packfile that follows.
+func readBundleHeader(r io.Reader) (map[string]Hash, int64, error) {
+	br := bufio.NewReader(r)
+	var offset int64
+	readLine := func() (string, error) {
+		line, err := br.ReadString('\n')
+		offset += int64(len(line))
+		if err != nil {
+			return "", fmt.Errorf("truncated header: %w", err)
+		}
+		return strings.TrimSuffix(line, "\n"), nil
+	}
+	signature, err := readLine()
+	if err != nil {
+		return nil, 0, err
+	}
+	if signature != "# v2 git bundle" && signature != "# v3 git bundle" {
+		return nil, 0, errors.New("not a git bundle")
+	}
+	refs := map[string]Hash{}
+	for {
+		line, err := readLine()
+		if err != nil {
+			return nil, 0, err
+		}
+		switch {
+		case line == "":
+			return refs, offset, nil
+		case strings.HasPrefix(line, "@"):
+			if format, ok := strings.CutPrefix(line, "@object-format="); ok && format != "sha1" {
+				return nil, 0, fmt.Errorf("unsupported object format %s", format)
+			}
+		case strings.HasPrefix(line, "-"):
+			// A prerequisite commit the bundle builds on.
+		default:
+			hash, name, _ := strings.Cut(line, " ")
+			h, err := ParseHash(hash)
+			if err != nil {
+				return nil, 0, err
+			}
+			refs[name] = h
+		}
+	}
+}
+
+// defaultBundleHead picks the commit to use as HEAD when the bundle does not
+// record one: the main or master branch, or its only branch.
+func defaultBundleHead(refs map[string]Hash) (Hash, bool) {
+	for _, name := range []string{"refs/heads/main", "refs/heads/master"} {
+		if h, ok := refs[name]; ok {
+			return h, true
+		}
+	}
+	var branches []Hash
+	for name, h := range refs {
+		if strings.HasPrefix(name, "refs/heads/") {
+			branches = append(branches, h)
+		}
+	}
+	if len(branches) == 1 {
+		return branches[0], true
+	}
+	return ZeroHash, false
+}
+
+// bundleHeadBranch returns the short name of a branch HEAD points to. The
+// bundle header does not record which one, so main and master are preferred.
+func (r *Repository) bundleHeadBranch() string {
+	head, ok := r.bundleRefs["HEAD"]
+	if !ok {
+		return ""
+	}
+	var names []string
+	for name, h := range r.bundleRefs {
+		if h == head && strings.HasPrefix(name, "refs/heads/") {
+			names = append(names, strings.TrimPrefix(name, "refs/heads/"))
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return branchRank(names[i]) < branchRank(names[j]) || branchRank(names[i]) == branchRank(names[j]) && names[i] < names[j]
+	})
+	if len(names) == 0 {
+		return ""
+	}
+	return names[0]
+}
+
+func branchRank(name string) int {
+	switch name {
+	case "main":
+		return 0
+	case "master":
+		return 1
+	}
+	return 2
+}
+
+// index builds the index of a packfile that comes without one by decoding
+// every object and hashing it. Ref deltas may name bases later in the pack,
+// so objects are decoded in rounds until no more can be resolved. The pack of
+// an incremental bundle is thin: some deltas are against objects of its
+// prerequisite commits, which are not in the pack. Those objects are left out
+// of the index, so reading them fails with ErrNotExist.
+func (p *packfile) index() error {
+	offsets, err := p.scan()
+	if err != nil {
+		return err
+	}
+	found := map[Hash]int64{}
+	pending := offsets
+	for len(pending) > 0 {
+		var missing []int64
+		for _, offset := range pending {
+			typ, data, err := p.decode(offset, nil, 0)
+			if errors.Is(err, ErrNotExist) {
+				missing = append(missing, offset)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			found[objectHash(typ, data)] = offset
+		}
+		p.setIndex(found)
+		if len(missing) == len(pending) {
+			break
+		}
+		pending = missing
+	}
+	return nil
+}
+
+// setIndex replaces the index with the objects of found.
+func (p *packfile) setIndex(found map[Hash]int64) {
+	p.hashes = make([]Hash, 0, len(found))
+	for h := range found {
+		p.hashes = append(p.hashes, h)
+	}
+	sort.Slice(p.hashes, func(i, j int) bool { return bytes.Compare(p.hashes[i][:], p.hashes[j][:]) < 0 })
+	p.offsets = make([]int64, len(p.hashes))
+	for i, h := range p.hashes {
+		p.offsets[i] = found[h]
+	}
+}
+
+// scan returns the offsets of the objects of the pack, in order.
+func (p *packfile) scan() ([]int64, error) {
+	cr := &countingReader{r: bufio.NewReader(io.NewSectionReader(p.r, 0, p.size))}
+	var header [12]byte
+	if _, err := io.ReadFull(cr, header[:]); err != nil {
+		return nil, fmt.Errorf("pack header: %w", err)
+	}
+	if string(header[:4]) != "PACK" {
+		return nil, errors.New("missing pack signature")
+	}
+	if v := uint32(header[4])<<24 | uint32(header[5])<<16 | uint32(header[6])<<8 | uint32(header[7]); v != 2 && v != 3 {
+		return nil, fmt.Errorf("unsupported pack version %d", v)
+	}
+	count := int64(uint32(header[8])<<24 | uint32(header[9])<<16 | uint32(header[10])<<8 | uint32(header[11]))
+	// Every object takes more than a byte, so a larger count is a lie that
+	// must not size the allocation.
+	if count > p.size {
+		return nil, fmt.Errorf("pack claims %d objects in %d bytes", count, p.size)
+	}
+	offsets := make([]int64, 0, count)
+	for i := int64(0); i < count; i++ {
+		offset := cr.n
+		kind, _, err := readPackObjectHeader(cr)
+		if err != nil {
+			return nil, fmt.Errorf("pack object at %d: %w", offset, err)
+		}
+		switch kind {
+		case packOfsDelta:
+			_, err = readOffsetDelta(cr)
+		case packRefDelta:
+			_, err = io.ReadFull(cr, make([]byte, 20))
+		}
+		if err == nil {
+			err = skipCompressed(cr)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("pack object at %d: %w", offset, err)
+		}
+		offsets = append(offsets, offset)
+	}
+	return offsets, nil
+}
+
+// skipCompressed reads past a zlib stream. r implements io.ByteReader, so
+// the decompressor does not read beyond the end of the stream.
+func skipCompressed(r *countingReader) error {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.Discard, zr); err != nil {
+		return err
+	}
+	return zr.Close()
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// objectHash returns the object name of an object of type typ.
+func objectHash(typ ObjectType, data []byte) Hash {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s %d\x00", typ, len(data))
+	h.Write(data)
+	var sum Hash
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
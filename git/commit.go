@@ -0,0 +1,182 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature is the author or committer line of a commit.
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+// Commit is a parsed commit object.
+type Commit struct {
+	Hash      Hash
+	Tree      Hash
+	Parents   []Hash
+	Author    Signature
+	Committer Signature
+	Message   string
+}
+
+// Subject returns the first line of the commit message.
+func (c *Commit) Subject() string {
+	subject, _, _ := strings.Cut(strings.TrimSpace(c.Message), "\n")
+	return strings.TrimSpace(subject)
+}
+
+// Commit reads and parses the commit h.
+func (r *Repository) Commit(h Hash) (*Commit, error) {
+	typ, data, err := r.readObject(h)
+	if err != nil {
+		return nil, err
+	}
+	if typ != CommitObject {
+		return nil, fmt.Errorf("object %s is a %s, not a commit", h, typ)
+	}
+	c, err := parseCommit(data)
+	if err != nil {
+		return nil, fmt.Errorf("commit %s: %w", h, err)
+	}
+	c.Hash = h
+	return c, nil
+}
+
+func parseCommit(data []byte) (*Commit, error) {
+	c := &Commit{}
+	header, message, _ := bytes.Cut(data, []byte("\n\n"))
+	c.Message = string(message)
+	for _, line := range strings.Split(string(header), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree":
+			h, err := ParseHash(value)
+			if err != nil {
+				return nil, err
+			}
+			c.Tree = h
+		case "parent":
+			h, err := ParseHash(value)
+			if err != nil {
+				return nil, err
+			}
+			c.Parents = append(c.Parents, h)
+		case "author":
+			c.Author = parseSignature(value)
+		case "committer":
+			c.Committer = parseSignature(value)
+		}
+	}
+	if c.Tree.IsZero() {
+		return nil, errors.New("missing tree")
+	}
+	return c, nil
+}
+
+// parseSignature parses "Name <email> 1700000000 +0100".
+func parseSignature(s string) Signature {
+	var sig Signature
+	open := strings.LastIndex(s, "<")
+	close := strings.LastIndex(s, ">")
+	if open < 0 || close < open {
+		sig.Name = strings.TrimSpace(s)
+		return sig
+	}
+	sig.Name = strings.TrimSpace(s[:open])
+	sig.Email = s[open+1 : close]
+	fields := strings.Fields(s[close+1:])
+	if len(fields) == 0 {
+		return sig
+	}
+	secs, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return sig
+	}
+	loc := time.UTC
+	if len(fields) > 1 && len(fields[1]) == 5 {
+		tz := fields[1]
+		hours, errH := strconv.Atoi(tz[1:3])
+		mins, errM := strconv.Atoi(tz[3:5])
+		if errH == nil && errM == nil {
+			offset := hours*3600 + mins*60
+			if tz[0] == '-' {
+				offset = -offset
+			}
+			loc = time.FixedZone(tz, offset)
+		}
+	}
+	sig.When = time.Unix(secs, 0).In(loc)
+	return sig
+}
+
+func parseTagTarget(data []byte) (Hash, error) {
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			break
+		}
+		if value, ok := strings.CutPrefix(line, "object "); ok {
+			return ParseHash(value)
+		}
+	}
+	return ZeroHash, errors.New("missing object line")
+}
+
+// Log returns up to n commits reachable from start, newest first by committer
+// date. A non-positive n returns the whole history.
+func (r *Repository) Log(start Hash, n int) ([]*Commit, error) {
+	var commits []*Commit
+	err := r.WalkHistory(start, func(c *Commit) bool {
+		commits = append(commits, c)
+		return n <= 0 || len(commits) < n
+	})
+	return commits, err
+}
+
+// WalkHistory calls fn for each commit reachable from start, newest first by
+// committer date, until fn returns false or the history is exhausted.
+func (r *Repository) WalkHistory(start Hash, fn func(*Commit) bool) error {
+	seen := map[Hash]bool{start: true}
+	first, err := r.Commit(start)
+	if err != nil {
+		return err
+	}
+	queue := []*Commit{first}
+	for len(queue) > 0 {
+		// Pick the most recent pending commit so merged branches interleave
+		// the way `git log` shows them.
+		best := 0
+		for i, c := range queue {
+			if c.Committer.When.After(queue[best].Committer.When) {
+				best = i
+			}
+		}
+		c := queue[best]
+		queue = append(queue[:best], queue[best+1:]...)
+		if !fn(c) {
+			return nil
+		}
+		for _, p := range c.Parents {
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+			parent, err := r.Commit(p)
+			if errors.Is(err, ErrNotExist) {
+				// Shallow clones have parents that were never fetched.
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			queue = append(queue, parent)
+		}
+	}
+	return nil
+}
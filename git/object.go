@@ -0,0 +1,155 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// ObjectType identifies the kind of a git object.
+type ObjectType int
+
+const (
+	CommitObject ObjectType = 1
+	TreeObject   ObjectType = 2
+	BlobObject   ObjectType = 3
+	TagObject    ObjectType = 4
+)
+
+func (t ObjectType) String() string {
+	switch t {
+	case CommitObject:
+		return "commit"
+	case TreeObject:
+		return "tree"
+	case BlobObject:
+		return "blob"
+	case TagObject:
+		return "tag"
+	}
+	return "unknown"
+}
+
+func parseObjectType(s string) (ObjectType, error) {
+	switch s {
+	case "commit":
+		return CommitObject, nil
+	case "tree":
+		return TreeObject, nil
+	case "blob":
+		return BlobObject, nil
+	case "tag":
+		return TagObject, nil
+	}
+	return 0, fmt.Errorf("unknown object type %q", s)
+}
+
+// ReadBlob returns the contents of the blob h.
+func (r *Repository) ReadBlob(h Hash) ([]byte, error) {
+	typ, data, err := r.readObject(h)
+	if err != nil {
+		return nil, err
+	}
+	if typ != BlobObject {
+		return nil, fmt.Errorf("object %s is a %s, not a blob", h, typ)
+	}
+	return data, nil
+}
+
+func (r *Repository) readObject(h Hash) (ObjectType, []byte, error) {
+	if r.bundleRefs == nil {
+		typ, data, err := r.readLooseObject(h)
+		if err == nil || !os.IsNotExist(err) {
+			return typ, data, err
+		}
+	}
+	if err := r.loadPacks(); err != nil {
+		return 0, nil, err
+	}
+	for _, p := range r.packs {
+		if offset, ok := p.find(h); ok {
+			return p.readAt(offset, r)
+		}
+	}
+	return 0, nil, fmt.Errorf("object %s: %w", h, ErrNotExist)
+}
+
+func (r *Repository) readLooseObject(h Hash) (ObjectType, []byte, error) {
+	name := h.String()
+	f, err := os.Open(filepath.Join(r.commonDir, "objects", name[:2], name[2:]))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return 0, nil, fmt.Errorf("object %s: %w", h, err)
+	}
+	defer zr.Close()
+	// The header is at most a few dozen bytes.
+	raw, err := io.ReadAll(io.LimitReader(zr, maxObjectSize+64))
+	if err != nil {
+		return 0, nil, fmt.Errorf("object %s: %w", h, err)
+	}
+	if len(raw) > maxObjectSize+63 {
+		return 0, nil, fmt.Errorf("object %s is larger than %d bytes", h, maxObjectSize)
+	}
+	header, data, ok := bytes.Cut(raw, []byte{0})
+	if !ok {
+		return 0, nil, fmt.Errorf("object %s: missing header", h)
+	}
+	kind, size, ok := bytes.Cut(header, []byte{' '})
+	if !ok {
+		return 0, nil, fmt.Errorf("object %s: malformed header", h)
+	}
+	typ, err := parseObjectType(string(kind))
+	if err != nil {
+		return 0, nil, fmt.Errorf("object %s: %w", h, err)
+	}
+	if n, err := strconv.Atoi(string(size)); err != nil || n != len(data) {
+		return 0, nil, fmt.Errorf("object %s: size mismatch", h)
+	}
+	return typ, data, nil
+}
+
+func (r *Repository) loadPacks() error {
+	if r.packsRead {
+		return nil
+	}
+	idxFiles, err := filepath.Glob(filepath.Join(r.commonDir, "objects", "pack", "*.idx"))
+	if err != nil {
+		return err
+	}
+	var packs []*packfile
+	for _, idx := range idxFiles {
+		p, err := openPackfile(idx)
+		if err != nil {
+			for _, opened := range packs {
+				opened.Close()
+			}
+			return err
+		}
+		packs = append(packs, p)
+	}
+	// Only a complete set is kept, so a failure is reported again by the
+	// next read rather than leaving the repository without packs.
+	r.packs, r.packsRead = packs, true
+	return nil
+}
+
+// Close releases the packfiles held open by the repository.
+func (r *Repository) Close() error {
+	var firstErr error
+	for _, p := range r.packs {
+		if err := p.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	r.packs = nil
+	r.packsRead = false
+	return firstErr
+}
@@ -0,0 +1,367 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	packOfsDelta = 6
+	packRefDelta = 7
+
+	// maxCachedBases bounds the number of delta bases kept in memory per pack.
+	maxCachedBases = 256
+
+	// maxObjectSize bounds the size of an object, far above any source file.
+	// Sizes come from pack and bundle headers, which cannot be trusted, so
+	// larger ones are rejected before anything is allocated.
+	maxObjectSize = 1 << 30
+)
+
+type cachedObject struct {
+	typ  ObjectType
+	data []byte
+}
+
+// packfile is a .pack file together with its index. hashes and offsets are
+// parallel slices sorted by hash.
+type packfile struct {
+	r       io.ReaderAt
+	closer  io.Closer
+	size    int64
+	hashes  []Hash
+	offsets []int64
+	bases   map[int64]cachedObject
+}
+
+func openPackfile(idxPath string) (*packfile, error) {
+	idx, err := os.ReadFile(idxPath)
+	if err != nil {
+		return nil, err
+	}
+	hashes, offsets, err := parsePackIndex(idx)
+	if err != nil {
+		return nil, fmt.Errorf("pack index %s: %w", idxPath, err)
+	}
+	f, err := os.Open(strings.TrimSuffix(idxPath, ".idx") + ".pack")
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &packfile{r: f, closer: f, size: info.Size(), hashes: hashes, offsets: offsets}, nil
+}
+
+func (p *packfile) Close() error {
+	if p.closer == nil {
+		return nil
+	}
+	return p.closer.Close()
+}
+
+// parsePackIndex decodes version 1 and version 2 pack index files.
+func parsePackIndex(idx []byte) ([]Hash, []int64, error) {
+	if len(idx) < 8 {
+		return nil, nil, errors.New("truncated")
+	}
+	if !bytes.Equal(idx[:4], []byte{0xff, 't', 'O', 'c'}) {
+		return parsePackIndexV1(idx)
+	}
+	if v := binary.BigEndian.Uint32(idx[4:8]); v != 2 {
+		return nil, nil, fmt.Errorf("unsupported version %d", v)
+	}
+	const fanoutEnd = 8 + 256*4
+	if len(idx) < fanoutEnd {
+		return nil, nil, errors.New("truncated")
+	}
+	n := int(binary.BigEndian.Uint32(idx[fanoutEnd-4 : fanoutEnd]))
+	hashStart := fanoutEnd
+	crcStart := hashStart + n*20
+	offStart := crcStart + n*4
+	largeStart := offStart + n*4
+	if len(idx) < largeStart {
+		return nil, nil, errors.New("truncated")
+	}
+	hashes := make([]Hash, n)
+	offsets := make([]int64, n)
+	for i := 0; i < n; i++ {
+		copy(hashes[i][:], idx[hashStart+i*20:])
+		off := binary.BigEndian.Uint32(idx[offStart+i*4:])
+		if off&0x80000000 == 0 {
+			offsets[i] = int64(off)
+			continue
+		}
+		pos := largeStart + int(off&0x7fffffff)*8
+		if pos+8 > len(idx) {
+			return nil, nil, errors.New("truncated")
+		}
+		offsets[i] = int64(binary.BigEndian.Uint64(idx[pos:]))
+	}
+	return hashes, offsets, nil
+}
+
+func parsePackIndexV1(idx []byte) ([]Hash, []int64, error) {
+	const fanoutEnd = 256 * 4
+	if len(idx) < fanoutEnd {
+		return nil, nil, errors.New("truncated")
+	}
+	n := int(binary.BigEndian.Uint32(idx[fanoutEnd-4 : fanoutEnd]))
+	if len(idx) < fanoutEnd+n*24 {
+		return nil, nil, errors.New("truncated")
+	}
+	hashes := make([]Hash, n)
+	offsets := make([]int64, n)
+	for i := 0; i < n; i++ {
+		entry := idx[fanoutEnd+i*24:]
+		offsets[i] = int64(binary.BigEndian.Uint32(entry))
+		copy(hashes[i][:], entry[4:24])
+	}
+	return hashes, offsets, nil
+}
+
+func (p *packfile) find(h Hash) (int64, bool) {
+	i := sort.Search(len(p.hashes), func(i int) bool {
+		return bytes.Compare(p.hashes[i][:], h[:]) >= 0
+	})
+	if i < len(p.hashes) && p.hashes[i] == h {
+		return p.offsets[i], true
+	}
+	return 0, false
+}
+
+// readAt decodes the object stored at offset, resolving deltas. Ref deltas
+// whose base lives outside the pack are looked up through repo.
+func (p *packfile) readAt(offset int64, repo *Repository) (ObjectType, []byte, error) {
+	return p.decode(offset, repo, 0)
+}
+
+func (p *packfile) decode(offset int64, repo *Repository, depth int) (ObjectType, []byte, error) {
+	if depth > 64 {
+		return 0, nil, fmt.Errorf("pack delta chain too deep at offset %d", offset)
+	}
+	if obj, ok := p.bases[offset]; ok {
+		return obj.typ, obj.data, nil
+	}
+	br := bufio.NewReader(io.NewSectionReader(p.r, offset, p.size-offset))
+	kind, size, err := readPackObjectHeader(br)
+	if err != nil {
+		return 0, nil, fmt.Errorf("pack object at %d: %w", offset, err)
+	}
+	var baseType ObjectType
+	var base []byte
+	switch kind {
+	case int(CommitObject), int(TreeObject), int(BlobObject), int(TagObject):
+		data, err := inflate(br, size)
+		if err != nil {
+			return 0, nil, fmt.Errorf("pack object at %d: %w", offset, err)
+		}
+		return ObjectType(kind), data, nil
+	case packOfsDelta:
+		rel, err := readOffsetDelta(br)
+		if err != nil {
+			return 0, nil, fmt.Errorf("pack object at %d: %w", offset, err)
+		}
+		baseOffset := offset - rel
+		if baseOffset <= 0 {
+			return 0, nil, fmt.Errorf("pack object at %d: invalid delta base", offset)
+		}
+		baseType, base, err = p.decode(baseOffset, repo, depth+1)
+		if err != nil {
+			return 0, nil, err
+		}
+		p.cache(baseOffset, baseType, base)
+	case packRefDelta:
+		var h Hash
+		if _, err := io.ReadFull(br, h[:]); err != nil {
+			return 0, nil, fmt.Errorf("pack object at %d: %w", offset, err)
+		}
+		if baseOffset, ok := p.find(h); ok {
+			baseType, base, err = p.decode(baseOffset, repo, depth+1)
+			if err == nil {
+				p.cache(baseOffset, baseType, base)
+			}
+		} else if repo != nil {
+			baseType, base, err = repo.readObject(h)
+		} else {
+			err = fmt.Errorf("delta base %s: %w", h, ErrNotExist)
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+	default:
+		return 0, nil, fmt.Errorf("pack object at %d: unknown type %d", offset, kind)
+	}
+	delta, err := inflate(br, size)
+	if err != nil {
+		return 0, nil, fmt.Errorf("pack object at %d: %w", offset, err)
+	}
+	data, err := applyDelta(base, delta)
+	if err != nil {
+		return 0, nil, fmt.Errorf("pack object at %d: %w", offset, err)
+	}
+	return baseType, data, nil
+}
+
+func (p *packfile) cache(offset int64, typ ObjectType, data []byte) {
+	if p.bases == nil || len(p.bases) >= maxCachedBases {
+		p.bases = make(map[int64]cachedObject)
+	}
+	p.bases[offset] = cachedObject{typ: typ, data: data}
+}
+
+func readPackObjectHeader(r io.ByteReader) (int, int64, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	kind := int(c>>4) & 7
+	size := int64(c & 0x0f)
+	shift := uint(4)
+	for c&0x80 != 0 {
+		if shift > 63-7 {
+			return 0, 0, errors.New("object size overflows")
+		}
+		if c, err = r.ReadByte(); err != nil {
+			return 0, 0, err
+		}
+		size |= int64(c&0x7f) << shift
+		shift += 7
+	}
+	return kind, size, nil
+}
+
+func readOffsetDelta(r io.ByteReader) (int64, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	off := int64(c & 0x7f)
+	for c&0x80 != 0 {
+		if off >= 1<<(63-7)-1 {
+			return 0, errors.New("delta offset overflows")
+		}
+		if c, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+		off = ((off + 1) << 7) | int64(c&0x7f)
+	}
+	return off, nil
+}
+
+// inflate decompresses an object of the given size. The buffer grows while
+// reading, so a size the data does not back is never allocated.
+func inflate(r io.Reader, size int64) ([]byte, error) {
+	if size > maxObjectSize {
+		return nil, fmt.Errorf("object of %d bytes is larger than %d bytes", size, maxObjectSize)
+	}
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(io.LimitReader(zr, size))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
+}
+
+func readDeltaSize(delta []byte) (int64, []byte, error) {
+	var size int64
+	var shift uint
+	for i, c := range delta {
+		if shift > 63-7 {
+			return 0, nil, errors.New("delta size overflows")
+		}
+		size |= int64(c&0x7f) << shift
+		shift += 7
+		if c&0x80 == 0 {
+			return size, delta[i+1:], nil
+		}
+	}
+	return 0, nil, errors.New("truncated delta header")
+}
+
+func applyDelta(base, delta []byte) ([]byte, error) {
+	srcSize, delta, err := readDeltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+	if srcSize != int64(len(base)) {
+		return nil, errors.New("delta base size mismatch")
+	}
+	dstSize, delta, err := readDeltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+	if dstSize > maxObjectSize {
+		return nil, fmt.Errorf("delta result of %d bytes is larger than %d bytes", dstSize, maxObjectSize)
+	}
+	// The result is at most the size the header claims, but only grows as
+	// large as the delta makes it.
+	capacity := dstSize
+	if limit := int64(len(base) + len(delta)); capacity > limit {
+		capacity = limit
+	}
+	out := make([]byte, 0, capacity)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		if op&0x80 == 0 {
+			n := int(op)
+			if n == 0 || n > len(delta) {
+				return nil, errors.New("invalid delta insert")
+			}
+			out = append(out, delta[:n]...)
+			delta = delta[n:]
+			continue
+		}
+		var offset, size int64
+		for i := uint(0); i < 4; i++ {
+			if op&(1<<i) != 0 {
+				if len(delta) == 0 {
+					return nil, errors.New("truncated delta copy")
+				}
+				offset |= int64(delta[0]) << (8 * i)
+				delta = delta[1:]
+			}
+		}
+		for i := uint(0); i < 3; i++ {
+			if op&(0x10<<i) != 0 {
+				if len(delta) == 0 {
+					return nil, errors.New("truncated delta copy")
+				}
+				size |= int64(delta[0]) << (8 * i)
+				delta = delta[1:]
+			}
+		}
+		if size == 0 {
+			size = 0x10000
+		}
+		if offset+size > int64(len(base)) {
+			return nil, errors.New("delta copy out of range")
+		}
+		if int64(len(out))+size > dstSize {
+			return nil, errors.New("delta result size mismatch")
+		}
+		out = append(out, base[offset:offset+size]...)
+	}
+	if int64(len(out)) != dstSize {
+		return nil, errors.New("delta result size mismatch")
+	}
+	return out, nil
+}
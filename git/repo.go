@@ -0,0 +1,346 @@
+// Package git reads commits, trees and blobs straight from a repository's
+// object database. It understands loose objects, packfiles and refs, and does
+// not need a git binary to be installed.
+package git
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotExist is returned when a repository, ref or object cannot be found.
+var ErrNotExist = errors.New("does not exist")
+
+// Hash is a SHA-1 object name.
+type Hash [20]byte
+
+// ZeroHash is the all-zero hash git uses for "no object".
+var ZeroHash Hash
+
+// ParseHash parses a 40 character hexadecimal object name.
+func ParseHash(s string) (Hash, error) {
+	var h Hash
+	if len(s) != 40 {
+		return h, fmt.Errorf("invalid object name %q", s)
+	}
+	if _, err := hex.Decode(h[:], []byte(s)); err != nil {
+		return h, fmt.Errorf("invalid object name %q: %w", s, err)
+	}
+	return h, nil
+}
+
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// Short returns the abbreviated seven character form of the hash.
+func (h Hash) Short() string {
+	return h.String()[:7]
+}
+
+// IsZero reports whether h is the zero hash.
+func (h Hash) IsZero() bool {
+	return h == ZeroHash
+}
+
+// Repository is an open git object database.
+type Repository struct {
+	GitDir    string // the repository's git directory (.git, or the repository itself when bare)
+	commonDir string // shared directory holding objects and refs (differs from GitDir for worktrees)
+	// Bare is set when the repository was opened without a working tree:
+	// a bare repository, a git directory given directly, or a bundle.
+	Bare       bool
+	bundleRefs map[string]Hash // refs of a bundle; nil for other repositories
+	packs      []*packfile
+	packsRead  bool
+}
+
+// Open opens the repository containing path. path may be a working tree with a
+// .git directory or gitfile, or the git directory itself.
+func Open(path string) (*Repository, error) {
+	dotGit := filepath.Join(path, ".git")
+	info, err := os.Stat(dotGit)
+	switch {
+	case err == nil && info.IsDir():
+		return OpenGitDir(dotGit)
+	case err == nil:
+		dir, err := readGitFile(dotGit)
+		if err != nil {
+			return nil, err
+		}
+		return OpenGitDir(dir)
+	}
+	if isGitDir(path) {
+		repo, err := OpenGitDir(path)
+		if err != nil {
+			return nil, err
+		}
+		repo.Bare = true
+		return repo, nil
+	}
+	return nil, fmt.Errorf("git repository at %s: %w", path, ErrNotExist)
+}
+
+// OpenGitDir opens a git directory directly.
+func OpenGitDir(gitDir string) (*Repository, error) {
+	if !isGitDir(gitDir) {
+		return nil, fmt.Errorf("git directory %s: %w", gitDir, ErrNotExist)
+	}
+	repo := &Repository{GitDir: gitDir, commonDir: gitDir}
+	if common, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		dir := strings.TrimSpace(string(common))
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(gitDir, dir)
+		}
+		repo.commonDir = dir
+	}
+	return repo, nil
+}
+
+// readGitFile resolves a ".git" file of the form "gitdir: <path>", as used by
+// linked worktrees and submodules.
+func readGitFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	line := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(line, "gitdir:") {
+		return "", fmt.Errorf("invalid gitfile %s", path)
+	}
+	dir := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(path), dir)
+	}
+	return dir, nil
+}
+
+func isGitDir(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(dir, "commondir")); err == nil {
+		return true
+	}
+	info, err := os.Stat(filepath.Join(dir, "objects"))
+	return err == nil && info.IsDir()
+}
+
+// Head returns the commit HEAD points to.
+func (r *Repository) Head() (Hash, error) {
+	return r.ResolveRef("HEAD")
+}
+
+// HeadBranch returns the short name of the branch HEAD points to, or an empty
+// string when HEAD is detached.
+func (r *Repository) HeadBranch() string {
+	if r.bundleRefs != nil {
+		return r.bundleHeadBranch()
+	}
+	data, err := os.ReadFile(filepath.Join(r.GitDir, "HEAD"))
+	if err != nil {
+		return ""
+	}
+	line := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(line, "ref:") {
+		return ""
+	}
+	return strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(line, "ref:")), "refs/heads/")
+}
+
+// ResolveRef resolves a revision to a commit hash. It accepts full object
+// names, "HEAD", full ref names and short branch, tag or remote names.
+func (r *Repository) ResolveRef(name string) (Hash, error) {
+	if h, err := ParseHash(name); err == nil {
+		return r.peel(h)
+	}
+	candidates := []string{name}
+	if name != "HEAD" && !strings.HasPrefix(name, "refs/") {
+		candidates = append(candidates, "refs/"+name, "refs/tags/"+name, "refs/heads/"+name, "refs/remotes/"+name, "refs/remotes/"+name+"/HEAD")
+	}
+	for _, ref := range candidates {
+		h, err := r.readRef(ref, 0)
+		if errors.Is(err, ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return ZeroHash, err
+		}
+		return r.peel(h)
+	}
+	if h, err := r.expandShortHash(name); err == nil {
+		return r.peel(h)
+	}
+	return ZeroHash, fmt.Errorf("revision %q: %w", name, ErrNotExist)
+}
+
+// peel follows annotated tags until it reaches a non-tag object.
+func (r *Repository) peel(h Hash) (Hash, error) {
+	for i := 0; i < 10; i++ {
+		typ, data, err := r.readObject(h)
+		if err != nil {
+			return ZeroHash, err
+		}
+		if typ != TagObject {
+			return h, nil
+		}
+		target, err := parseTagTarget(data)
+		if err != nil {
+			return ZeroHash, fmt.Errorf("tag %s: %w", h, err)
+		}
+		h = target
+	}
+	return ZeroHash, fmt.Errorf("tag chain too deep at %s", h)
+}
+
+func (r *Repository) readRef(name string, depth int) (Hash, error) {
+	if depth > 10 {
+		return ZeroHash, fmt.Errorf("symbolic ref loop at %s", name)
+	}
+	if r.bundleRefs != nil {
+		if h, ok := r.bundleRefs[name]; ok {
+			return h, nil
+		}
+		return ZeroHash, fmt.Errorf("ref %s: %w", name, ErrNotExist)
+	}
+	dir := r.commonDir
+	if name == "HEAD" {
+		dir = r.GitDir
+	}
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	if err == nil {
+		line := strings.TrimSpace(string(data))
+		if strings.HasPrefix(line, "ref:") {
+			return r.readRef(strings.TrimSpace(strings.TrimPrefix(line, "ref:")), depth+1)
+		}
+		return ParseHash(line)
+	}
+	if !os.IsNotExist(err) {
+		// A directory with the same name as the ref (refs/heads/feature/...)
+		// means this is not a ref; anything else is a real error.
+		if info, statErr := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); statErr != nil || !info.IsDir() {
+			return ZeroHash, err
+		}
+	}
+	refs, err := r.packedRefs()
+	if err != nil {
+		return ZeroHash, err
+	}
+	if h, ok := refs[name]; ok {
+		return h, nil
+	}
+	return ZeroHash, fmt.Errorf("ref %s: %w", name, ErrNotExist)
+}
+
+func (r *Repository) packedRefs() (map[string]Hash, error) {
+	refs := map[string]Hash{}
+	f, err := os.Open(filepath.Join(r.commonDir, "packed-refs"))
+	if os.IsNotExist(err) {
+		return refs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		hash, name, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		if h, err := ParseHash(hash); err == nil {
+			refs[name] = h
+		}
+	}
+	return refs, scanner.Err()
+}
+
+// expandShortHash resolves an abbreviated object name of at least four
+// characters. Ambiguous prefixes are rejected.
+func (r *Repository) expandShortHash(prefix string) (Hash, error) {
+	prefix = strings.ToLower(prefix)
+	if len(prefix) < 4 || len(prefix) > 40 {
+		return ZeroHash, ErrNotExist
+	}
+	if _, err := hex.DecodeString(prefix[:len(prefix)&^1]); err != nil {
+		return ZeroHash, ErrNotExist
+	}
+	var matches []Hash
+	entries, _ := os.ReadDir(filepath.Join(r.commonDir, "objects", prefix[:2]))
+	for _, e := range entries {
+		name := prefix[:2] + e.Name()
+		if strings.HasPrefix(name, prefix) {
+			if h, err := ParseHash(name); err == nil {
+				matches = append(matches, h)
+			}
+		}
+	}
+	if err := r.loadPacks(); err != nil {
+		return ZeroHash, err
+	}
+	for _, p := range r.packs {
+		for _, h := range p.hashes {
+			if strings.HasPrefix(h.String(), prefix) && !containsHash(matches, h) {
+				matches = append(matches, h)
+			}
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	if len(matches) > 1 {
+		return ZeroHash, fmt.Errorf("short object name %s is ambiguous", prefix)
+	}
+	return ZeroHash, ErrNotExist
+}
+
+func containsHash(hashes []Hash, h Hash) bool {
+	for _, x := range hashes {
+		if x == h {
+			return true
+		}
+	}
+	return false
+}
+
+// Discover opens the repository whose working tree contains path, searching
+// parent directories like git does. It also returns the slash separated
+// location of path inside the working tree ("" for the root). A bundle file
+// is opened with OpenBundle.
+func Discover(path string) (*Repository, string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if info, err := os.Stat(abs); err == nil && info.Mode().IsRegular() && IsBundle(abs) {
+		repo, err := OpenBundle(abs)
+		return repo, "", err
+	}
+	dir := abs
+	for {
+		if repo, err := Open(dir); err == nil {
+			rel, err := filepath.Rel(dir, abs)
+			if err != nil {
+				return nil, "", err
+			}
+			if rel == "." {
+				rel = ""
+			}
+			return repo, filepath.ToSlash(rel), nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, "", fmt.Errorf("git repository containing %s: %w", path, ErrNotExist)
+		}
+		dir = parent
+	}
+}
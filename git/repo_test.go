@@ -0,0 +1,454 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestRepo creates a repository with the git binary, which is only needed
+// to build fixtures; the package itself never shells out.
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available")
+	}
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q")
+	return dir
+}
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test Author", "GIT_AUTHOR_EMAIL=author@example.com",
+		"GIT_COMMITTER_NAME=Test Author", "GIT_COMMITTER_EMAIL=author@example.com",
+		"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir,
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func writeFile(t *testing.T, dir, name, contents string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogAndChangedPaths(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, dir, "a.txt", "a\n")
+	writeFile(t, dir, "src/b.txt", "b\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "first")
+	writeFile(t, dir, "src/b.txt", "b\nb\n")
+	runGit(t, dir, "commit", "-q", "-a", "-m", "second\n\nwith a body")
+
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.String() != runGit(t, dir, "rev-parse", "HEAD") {
+		t.Fatalf("HEAD = %s", head)
+	}
+	commits, err := repo.Log(head, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 2 || commits[0].Subject() != "second" || commits[1].Subject() != "first" {
+		t.Fatalf("unexpected log: %+v", commits)
+	}
+	if commits[0].Author.Name != "Test Author" || commits[0].Author.Email != "author@example.com" {
+		t.Errorf("unexpected author: %+v", commits[0].Author)
+	}
+
+	changed, err := repo.ChangedPaths(commits[1].Tree, commits[0].Tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(changed, ",") != "src/b.txt" {
+		t.Errorf("changed paths = %v", changed)
+	}
+	changed, err = repo.ChangedPaths(ZeroHash, commits[1].Tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(changed, ",") != "a.txt,src/b.txt" {
+		t.Errorf("root commit paths = %v", changed)
+	}
+}
+
+func TestPackedObjectsAndRefs(t *testing.T) {
+	dir := newTestRepo(t)
+	var content strings.Builder
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&content, "line %d of a file that is edited often\n", i)
+		writeFile(t, dir, "notes.txt", content.String())
+		runGit(t, dir, "add", ".")
+		runGit(t, dir, "commit", "-q", "-m", fmt.Sprintf("edit %d", i))
+	}
+	runGit(t, dir, "tag", "-a", "v1", "-m", "release")
+	runGit(t, dir, "gc", "-q", "--aggressive")
+
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	for _, rev := range []string{"HEAD", "v1", "HEAD~3", runGit(t, dir, "rev-parse", "--short", "HEAD~5")} {
+		want := runGit(t, dir, "rev-parse", rev+"^{commit}")
+		if strings.Contains(rev, "~") {
+			// Ancestry syntax is not supported; resolve it with git instead.
+			rev = want
+		}
+		got, err := repo.ResolveRef(rev)
+		if err != nil {
+			t.Fatalf("ResolveRef(%s): %v", rev, err)
+		}
+		if got.String() != want {
+			t.Errorf("ResolveRef(%s) = %s, want %s", rev, got, want)
+		}
+	}
+
+	head, _ := repo.Head()
+	commits, err := repo.Log(head, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 30 {
+		t.Fatalf("got %d commits, want 30", len(commits))
+	}
+	for _, c := range commits[:10] {
+		var found bool
+		err := repo.WalkTree(c.Tree, func(path string, e TreeEntry) error {
+			found = true
+			data, err := repo.ReadBlob(e.Hash)
+			if err != nil {
+				return err
+			}
+			want := runGit(t, dir, "cat-file", "-p", e.Hash.String())
+			if strings.TrimSpace(string(data)) != want {
+				t.Errorf("blob %s of %s differs from git cat-file", path, c.Hash.Short())
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !found {
+			t.Errorf("tree of %s is empty", c.Hash.Short())
+		}
+	}
+}
+
+func TestDiscoverSubdirectory(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, dir, "pkg/lib/x.go", "package lib\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "init")
+
+	_, prefix, err := Discover(filepath.Join(dir, "pkg", "lib"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefix != "pkg/lib" {
+		t.Errorf("prefix = %q, want pkg/lib", prefix)
+	}
+}
+
+func TestModifiedFiles(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, dir, "a.txt", "a\n")
+	writeFile(t, dir, "src/b.txt", "b\n")
+	writeFile(t, dir, "src/c.txt", "c\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "first")
+
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.Commit(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modified, err := repo.ModifiedFiles(commit.Tree, dir, 0); err != nil || len(modified) != 0 {
+		t.Fatalf("clean tree reported %v, %v", modified, err)
+	}
+	if hash := runGit(t, dir, "hash-object", "a.txt"); BlobHash([]byte("a\n")).String() != hash {
+		t.Errorf("BlobHash differs from git hash-object %s", hash)
+	}
+
+	writeFile(t, dir, "src/b.txt", "changed\n")
+	writeFile(t, dir, "untracked.txt", "new\n")
+	if err := os.Remove(filepath.Join(dir, "src", "c.txt")); err != nil {
+		t.Fatal(err)
+	}
+	modified, err := repo.ModifiedFiles(commit.Tree, dir, 0)
+	if err != nil || fmt.Sprint(modified) != "[src/b.txt src/c.txt]" {
+		t.Errorf("ModifiedFiles = %v, %v", modified, err)
+	}
+	if modified, _ := repo.ModifiedFiles(commit.Tree, dir, 1); len(modified) != 1 {
+		t.Errorf("limit 1 returned %v", modified)
+	}
+}
+
+func TestBundleAndBareRepository(t *testing.T) {
+	dir := newTestRepo(t)
+	runGit(t, dir, "checkout", "-q", "-b", "main")
+	for i := 0; i < 3; i++ {
+		// Similar contents, so the pack holds deltas.
+		writeFile(t, dir, "big.txt", strings.Repeat(fmt.Sprintf("line %d\n", i), 200)+strings.Repeat("same\n", 500))
+		writeFile(t, dir, fmt.Sprintf("src/f%d.txt", i), "f\n")
+		runGit(t, dir, "add", ".")
+		runGit(t, dir, "commit", "-q", "-m", fmt.Sprintf("commit %d", i))
+	}
+	runGit(t, dir, "tag", "-a", "v1", "-m", "tag")
+	head := runGit(t, dir, "rev-parse", "HEAD")
+	bundle := filepath.Join(t.TempDir(), "repo.bundle")
+	runGit(t, dir, "bundle", "create", bundle, "--all")
+	bare := filepath.Join(t.TempDir(), "repo.git")
+	runGit(t, dir, "clone", "-q", "--bare", dir, bare)
+
+	if !IsBundle(bundle) || IsBundle(filepath.Join(dir, "big.txt")) {
+		t.Error("IsBundle misdetects")
+	}
+	for _, path := range []string{bundle, bare} {
+		repo, prefix, err := Discover(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		defer repo.Close()
+		if !repo.Bare || prefix != "" {
+			t.Errorf("%s: bare %v, prefix %q", path, repo.Bare, prefix)
+		}
+		h, err := repo.Head()
+		if err != nil || h.String() != head {
+			t.Fatalf("%s: HEAD = %s, %v", path, h, err)
+		}
+		if tag, err := repo.ResolveRef("v1"); err != nil || tag != h {
+			t.Errorf("%s: v1 = %s, %v", path, tag, err)
+		}
+		if branch := repo.HeadBranch(); branch != "main" {
+			t.Errorf("%s: branch %q", path, branch)
+		}
+		commits, err := repo.Log(h, 10)
+		if err != nil || len(commits) != 3 {
+			t.Fatalf("%s: %d commits, %v", path, len(commits), err)
+		}
+		var blob Hash
+		err = repo.WalkTree(commits[0].Tree, func(p string, e TreeEntry) error {
+			if p == "big.txt" {
+				blob = e.Hash
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := repo.ReadBlob(blob)
+		if err != nil || !strings.HasPrefix(string(data), "line 2\n") {
+			t.Errorf("%s: big.txt = %.20q, %v", path, data, err)
+		}
+	}
+}
+
+func TestIncrementalBundle(t *testing.T) {
+	dir := newTestRepo(t)
+	for i := 0; i < 2; i++ {
+		// The second version of big.txt is stored as a delta against the
+		// first, which only the prerequisite commit has.
+		writeFile(t, dir, "big.txt", strings.Repeat("same\n", 500)+fmt.Sprintf("line %d\n", i))
+		writeFile(t, dir, fmt.Sprintf("f%d.txt", i), fmt.Sprintf("file %d\n", i))
+		runGit(t, dir, "add", ".")
+		runGit(t, dir, "commit", "-q", "-m", fmt.Sprintf("commit %d", i))
+	}
+	head := runGit(t, dir, "rev-parse", "HEAD")
+	bundle := filepath.Join(t.TempDir(), "inc.bundle")
+	runGit(t, dir, "bundle", "create", bundle, "HEAD~1..HEAD")
+
+	repo, err := OpenBundle(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	h, err := repo.Head()
+	if err != nil || h.String() != head {
+		t.Fatalf("HEAD = %s, %v", h, err)
+	}
+	commits, err := repo.Log(h, 10)
+	if err != nil || len(commits) != 1 {
+		t.Fatalf("%d commits, %v", len(commits), err)
+	}
+	blobs := map[string]Hash{}
+	err = repo.WalkTree(commits[0].Tree, func(p string, e TreeEntry) error {
+		blobs[p] = e.Hash
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := repo.ReadBlob(blobs["f1.txt"]); err != nil || string(data) != "file 1\n" {
+		t.Errorf("f1.txt = %q, %v", data, err)
+	}
+	if _, err := repo.ReadBlob(blobs["f0.txt"]); !errors.Is(err, ErrNotExist) {
+		t.Errorf("f0.txt of the prerequisite commit: %v, want ErrNotExist", err)
+	}
+}
+
+func TestSubmodules(t *testing.T) {
+	modules, err := ParseGitmodules([]byte(`# comment
+[submodule "lib"]
+	path = vendor/lib/
+	url = https://example.com/lib.git
+[core]
+	path = ignored
+[submodule "docs"]
+	url = "git@example.com:docs.git"
+	path = "docs"
+[submodule "broken"]
+	url = https://example.com/broken.git
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Submodule{
+		{Name: "lib", Path: "vendor/lib", URL: "https://example.com/lib.git"},
+		{Name: "docs", Path: "docs", URL: "git@example.com:docs.git"},
+	}
+	if fmt.Sprint(modules) != fmt.Sprint(want) {
+		t.Errorf("ParseGitmodules = %v, want %v", modules, want)
+	}
+	for _, hostile := range []string{"../sibling", "lib/../../sibling", "/etc", `..\sibling`, "C:/Windows"} {
+		if _, err := ParseGitmodules([]byte("[submodule \"x\"]\n\tpath = " + hostile + "\n")); err == nil {
+			t.Errorf("ParseGitmodules accepted the path %s", hostile)
+		}
+	}
+
+	dir := newTestRepo(t)
+	writeFile(t, dir, "main.go", "package main\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "first")
+	pinned := runGit(t, dir, "rev-parse", "HEAD")
+	runGit(t, dir, "update-index", "--add", "--cacheinfo", "160000,"+pinned+",vendor/lib")
+	runGit(t, dir, "commit", "-q", "-m", "add submodule")
+
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	head, _ := repo.Head()
+	commit, err := repo.Commit(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := repo.TreeEntryAt(commit.Tree, "vendor/lib")
+	if err != nil || e.Mode != ModeSubmodule || e.Hash.String() != pinned {
+		t.Errorf("vendor/lib = %+v, %v", e, err)
+	}
+	if _, err := repo.TreeEntryAt(commit.Tree, "main.go/x"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("main.go/x: %v", err)
+	}
+}
+
+func TestMalformedPacks(t *testing.T) {
+	// A size header that never ends would shift past 63 bits.
+	if _, _, err := readPackObjectHeader(bytes.NewReader(bytes.Repeat([]byte{0xff}, 20))); err == nil {
+		t.Error("readPackObjectHeader accepted an endless size")
+	}
+	if _, err := readOffsetDelta(bytes.NewReader(bytes.Repeat([]byte{0xff}, 20))); err == nil {
+		t.Error("readOffsetDelta accepted an endless offset")
+	}
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write([]byte("short"))
+	zw.Close()
+	for _, size := range []int64{maxObjectSize + 1, 1 << 40, 100} {
+		if _, err := inflate(bytes.NewReader(compressed.Bytes()), size); err == nil {
+			t.Errorf("inflate accepted 5 bytes as %d", size)
+		}
+	}
+	if data, err := inflate(bytes.NewReader(compressed.Bytes()), 5); err != nil || string(data) != "short" {
+		t.Errorf("inflate = %q, %v", data, err)
+	}
+	// A delta claiming a huge result is rejected before allocating it.
+	huge := []byte{0x05, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f, 0x01, 'x'}
+	if _, err := applyDelta([]byte("short"), huge); err == nil {
+		t.Error("applyDelta accepted a huge result size")
+	}
+	if _, _, err := readDeltaSize(bytes.Repeat([]byte{0xff}, 20)); err == nil {
+		t.Error("readDeltaSize accepted an endless size")
+	}
+
+	// A pack whose header claims more objects than it holds.
+	p := &packfile{r: bytes.NewReader([]byte("PACK\x00\x00\x00\x02\xff\xff\xff\xff")), size: 12}
+	if _, err := p.scan(); err == nil {
+		t.Error("scan accepted an impossible object count")
+	}
+}
+
+func TestUnreadablePacksAreReportedAgain(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, dir, "a.txt", "a\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "first")
+	runGit(t, dir, "gc", "-q")
+	blob, err := ParseHash(runGit(t, dir, "rev-parse", "HEAD:a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, _ := filepath.Glob(filepath.Join(dir, ".git", "objects", "pack", "*.idx"))
+	if len(idx) != 1 {
+		t.Fatalf("packs = %q", idx)
+	}
+	good, err := os.ReadFile(idx[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(idx[0], []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := repo.ReadBlob(blob); err == nil || errors.Is(err, ErrNotExist) {
+			t.Errorf("read %d of a corrupt pack: %v", i+1, err)
+		}
+	}
+	if err := os.WriteFile(idx[0], good, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := repo.ReadBlob(blob); err != nil || string(data) != "a\n" {
+		t.Errorf("after repair: %q, %v", data, err)
+	}
+}
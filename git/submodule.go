@@ -0,0 +1,117 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Submodule is an entry of a .gitmodules file.
+type Submodule struct {
+	Name string
+	Path string // slash separated, relative to the working tree root
+	URL  string
+}
+
+// ParseGitmodules parses the contents of a .gitmodules file, which uses the
+// git config syntax. Submodules are returned in the order of the file;
+// sections without a path are skipped. A path that is absolute or leads out
+// of the working tree with ".." is an error.
+func ParseGitmodules(data []byte) ([]Submodule, error) {
+	var submodules []Submodule
+	var current *Submodule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			end := strings.Index(line, "]")
+			if end < 0 {
+				return nil, fmt.Errorf(".gitmodules:%d: malformed section header", n)
+			}
+			current = nil
+			section, name, _ := strings.Cut(line[1:end], " ")
+			if strings.EqualFold(section, "submodule") {
+				submodules = append(submodules, Submodule{Name: strings.Trim(strings.TrimSpace(name), `"`)})
+				current = &submodules[len(submodules)-1]
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "path":
+			if !safeSubmodulePath(value) {
+				return nil, fmt.Errorf(".gitmodules:%d: submodule path %q is outside the working tree", n, value)
+			}
+			current.Path = path.Clean(strings.TrimRight(value, "/"))
+		case "url":
+			current.URL = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	var valid []Submodule
+	for _, s := range submodules {
+		if s.Path != "" && s.Path != "." {
+			valid = append(valid, s)
+		}
+	}
+	return valid, nil
+}
+
+// safeSubmodulePath reports whether the submodule path p stays inside the
+// working tree: it is relative and has no ".." element. A hostile
+// .gitmodules could otherwise have files read from anywhere.
+func safeSubmodulePath(p string) bool {
+	if strings.HasPrefix(p, "/") || strings.HasPrefix(p, `\`) || len(p) >= 2 && p[1] == ':' {
+		return false
+	}
+	for _, element := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if element == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// TreeEntryAt returns the entry at the slash separated path p below the tree
+// h, reading only the trees along the way.
+func (r *Repository) TreeEntryAt(h Hash, p string) (TreeEntry, error) {
+	names := strings.Split(path.Clean(p), "/")
+	for i, name := range names {
+		entries, err := r.Tree(h)
+		if err != nil {
+			return TreeEntry{}, err
+		}
+		found := false
+		for _, e := range entries {
+			if e.Name != name {
+				continue
+			}
+			if i == len(names)-1 {
+				return e, nil
+			}
+			if !e.IsTree() {
+				break
+			}
+			h, found = e.Hash, true
+			break
+		}
+		if !found {
+			break
+		}
+	}
+	return TreeEntry{}, fmt.Errorf("tree entry %s: %w", p, ErrNotExist)
+}
@@ -0,0 +1,176 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+)
+
+// File modes used in tree entries.
+const (
+	ModeTree       = 0o040000
+	ModeFile       = 0o100644
+	ModeExecutable = 0o100755
+	ModeSymlink    = 0o120000
+	ModeSubmodule  = 0o160000
+)
+
+// TreeEntry is a single entry of a tree object.
+type TreeEntry struct {
+	Name string
+	Mode uint32
+	Hash Hash
+}
+
+// IsTree reports whether the entry is a subdirectory.
+func (e TreeEntry) IsTree() bool {
+	return e.Mode == ModeTree
+}
+
+// Tree reads and parses the tree h.
+func (r *Repository) Tree(h Hash) ([]TreeEntry, error) {
+	typ, data, err := r.readObject(h)
+	if err != nil {
+		return nil, err
+	}
+	if typ != TreeObject {
+		return nil, fmt.Errorf("object %s is a %s, not a tree", h, typ)
+	}
+	entries, err := parseTree(data)
+	if err != nil {
+		return nil, fmt.Errorf("tree %s: %w", h, err)
+	}
+	return entries, nil
+}
+
+func parseTree(data []byte) ([]TreeEntry, error) {
+	var entries []TreeEntry
+	for len(data) > 0 {
+		sp := bytes.IndexByte(data, ' ')
+		if sp < 0 {
+			return nil, fmt.Errorf("malformed entry")
+		}
+		mode, err := strconv.ParseUint(string(data[:sp]), 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("malformed mode: %w", err)
+		}
+		data = data[sp+1:]
+		nul := bytes.IndexByte(data, 0)
+		if nul < 0 || len(data) < nul+21 {
+			return nil, fmt.Errorf("malformed entry")
+		}
+		entry := TreeEntry{Name: string(data[:nul]), Mode: uint32(mode)}
+		copy(entry.Hash[:], data[nul+1:nul+21])
+		entries = append(entries, entry)
+		data = data[nul+21:]
+	}
+	return entries, nil
+}
+
+// WalkTree calls fn for every non-tree entry below the tree h, with the entry's
+// slash separated path relative to the root tree. Entries are visited in path
+// order.
+func (r *Repository) WalkTree(h Hash, fn func(path string, entry TreeEntry) error) error {
+	return r.walkTree(h, "", fn)
+}
+
+func (r *Repository) walkTree(h Hash, prefix string, fn func(string, TreeEntry) error) error {
+	entries, err := r.Tree(h)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	for _, e := range entries {
+		p := path.Join(prefix, e.Name)
+		if e.IsTree() {
+			if err := r.walkTree(e.Hash, p, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(p, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChangedPaths returns the paths of files that differ between the trees from
+// and to. A zero from hash is treated as an empty tree, so the root commit
+// reports every file it adds.
+func (r *Repository) ChangedPaths(from, to Hash) ([]string, error) {
+	var changed []string
+	if err := r.diffTrees(from, to, "", &changed); err != nil {
+		return nil, err
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+func (r *Repository) treeMap(h Hash) (map[string]TreeEntry, error) {
+	m := map[string]TreeEntry{}
+	if h.IsZero() {
+		return m, nil
+	}
+	entries, err := r.Tree(h)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		m[e.Name] = e
+	}
+	return m, nil
+}
+
+func (r *Repository) diffTrees(from, to Hash, prefix string, changed *[]string) error {
+	if from == to {
+		return nil
+	}
+	a, err := r.treeMap(from)
+	if err != nil {
+		return err
+	}
+	b, err := r.treeMap(to)
+	if err != nil {
+		return err
+	}
+	for name, eb := range b {
+		ea, ok := a[name]
+		if ok && ea.Hash == eb.Hash && ea.Mode == eb.Mode {
+			continue
+		}
+		if err := r.diffEntry(ea, ok, eb, true, path.Join(prefix, name), changed); err != nil {
+			return err
+		}
+	}
+	for name, ea := range a {
+		if _, ok := b[name]; !ok {
+			if err := r.diffEntry(ea, true, TreeEntry{}, false, path.Join(prefix, name), changed); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Repository) diffEntry(a TreeEntry, hasA bool, b TreeEntry, hasB bool, p string, changed *[]string) error {
+	var fromTree, toTree Hash
+	aTree, bTree := hasA && a.IsTree(), hasB && b.IsTree()
+	if aTree {
+		fromTree = a.Hash
+	}
+	if bTree {
+		toTree = b.Hash
+	}
+	if aTree || bTree {
+		if err := r.diffTrees(fromTree, toTree, p, changed); err != nil {
+			return err
+		}
+	}
+	if (hasA && !aTree) || (hasB && !bTree) {
+		*changed = append(*changed, p)
+	}
+	return nil
+}
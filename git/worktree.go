@@ -0,0 +1,52 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// errStop ends a tree walk early without reporting an error.
+var errStop = errors.New("stop")
+
+// BlobHash returns the object name git gives a blob with the given contents.
+func BlobHash(data []byte) Hash {
+	return objectHash(BlobObject, data)
+}
+
+// ModifiedFiles compares the files of the tree h with the working tree at
+// workTree and returns the slash separated paths of those that were changed or
+// deleted. Untracked files are not reported, and submodules are not looked
+// into. With limit > 0, it stops after finding that many.
+func (r *Repository) ModifiedFiles(h Hash, workTree string, limit int) ([]string, error) {
+	var modified []string
+	err := r.WalkTree(h, func(p string, e TreeEntry) error {
+		var data []byte
+		var err error
+		name := filepath.Join(workTree, filepath.FromSlash(p))
+		switch e.Mode {
+		case ModeSubmodule:
+			return nil
+		case ModeSymlink:
+			var target string
+			target, err = os.Readlink(name)
+			data = []byte(filepath.ToSlash(target))
+		default:
+			data, err = os.ReadFile(name)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err != nil || BlobHash(data) != e.Hash {
+			modified = append(modified, p)
+			if limit > 0 && len(modified) >= limit {
+				return errStop
+			}
+		}
+		return nil
+	})
+	if err != nil && err != errStop {
+		return nil, err
+	}
+	return modified, nil
+}
@@ -4,13 +4,13 @@ go 1.20
 
 require (
 	github.com/gobwas/glob v0.2.3
+	github.com/pkoukk/tiktoken-go v0.1.6
 	github.com/spf13/cobra v1.6.1
+	github.com/spf13/pflag v1.0.5
 )
 
 require (
 	github.com/dlclark/regexp2 v1.10.0 // indirect
 	github.com/google/uuid v1.3.0 // indirect
 	github.com/inconshreveable/mousetrap v1.0.1 // indirect
-	github.com/pkoukk/tiktoken-go v0.1.6 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
 )
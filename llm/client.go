@@ -0,0 +1,243 @@
+// Package llm talks to OpenAI-compatible chat completion endpoints, such as
+// the OpenAI API itself, vLLM, llama.cpp's server or Ollama.
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the OpenAI API, used when no base URL is configured.
+const DefaultBaseURL = "https://api.openai.com/v1"
+
+// DefaultAPIKeyEnv is the environment variable the API key is read from.
+const DefaultAPIKeyEnv = "OPENAI_API_KEY"
+
+// Message is a single chat message.
+type Message struct {
+	Role    string `json:"role"` // system, user or assistant
+	Content string `json:"content"`
+}
+
+// Config describes an endpoint and the model to use on it.
+type Config struct {
+	BaseURL       string // up to and including /v1
+	Model         string
+	APIKey        string // sent as a bearer token; local servers often need none
+	ContextWindow int64  // tokens the model accepts, prompt and answer together; 0 is unlimited
+	MaxTokens     int64  // tokens reserved for the answer; 0 leaves it to the server
+
+	// Retries is how often Complete retries a request that failed with a
+	// network error, a rate limit or a server error. The delay starts at
+	// RetryDelay (one second if zero) and doubles with every attempt.
+	Retries    int
+	RetryDelay time.Duration
+}
+
+// Client sends chat completion requests.
+type Client struct {
+	Config
+	HTTPClient *http.Client // nil means http.DefaultClient
+}
+
+// NewClient returns a client for cfg. An empty base URL selects
+// DefaultBaseURL.
+func NewClient(cfg Config) *Client {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	return &Client{Config: cfg}
+}
+
+// APIKeyFromEnv reads the API key from the environment variable name, or
+// from DefaultAPIKeyEnv when name is empty.
+func APIKeyFromEnv(name string) string {
+	if name == "" {
+		name = DefaultAPIKeyEnv
+	}
+	return os.Getenv(name)
+}
+
+// WindowError reports a prompt that does not fit the model's context window.
+type WindowError struct {
+	PromptTokens  int64
+	MaxTokens     int64
+	ContextWindow int64
+}
+
+func (e *WindowError) Error() string {
+	if e.MaxTokens > 0 {
+		return fmt.Sprintf("the prompt has %d tokens, which with %d tokens reserved for the answer exceeds the context window of %d tokens", e.PromptTokens, e.MaxTokens, e.ContextWindow)
+	}
+	return fmt.Sprintf("the prompt has %d tokens, which exceeds the context window of %d tokens", e.PromptTokens, e.ContextWindow)
+}
+
+// CheckWindow returns a *WindowError if a prompt of promptTokens tokens and
+// the answer reserved by MaxTokens do not fit the context window.
+func (c *Client) CheckWindow(promptTokens int64) error {
+	if c.ContextWindow > 0 && promptTokens+c.MaxTokens > c.ContextWindow {
+		return &WindowError{PromptTokens: promptTokens, MaxTokens: c.MaxTokens, ContextWindow: c.ContextWindow}
+	}
+	return nil
+}
+
+// APIError is an error response from the endpoint.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("chat completion failed with status %d: %s", e.StatusCode, e.Message)
+}
+
+type chatRequest struct {
+	Model     string    `json:"model"`
+	Messages  []Message `json:"messages"`
+	MaxTokens int64     `json:"max_tokens,omitempty"`
+	Stream    bool      `json:"stream"`
+}
+
+type chatChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+}
+
+// Stream sends messages and writes the answer to w as it arrives. It returns
+// the whole answer. Servers that ignore the stream option and answer with a
+// single response are handled too.
+func (c *Client) Stream(ctx context.Context, messages []Message, w io.Writer) (string, error) {
+	body, err := json.Marshal(chatRequest{Model: c.Model, Messages: messages, MaxTokens: c.MaxTokens, Stream: true})
+	if err != nil {
+		return "", fmt.Errorf("error encoding request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", readAPIError(resp)
+	}
+
+	var answer strings.Builder
+	out := io.MultiWriter(&answer, w)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		var chunk chatChunk
+		if err := json.NewDecoder(resp.Body).Decode(&chunk); err != nil {
+			return "", fmt.Errorf("error decoding response: %w", err)
+		}
+		if len(chunk.Choices) > 0 {
+			io.WriteString(out, chunk.Choices[0].Message.Content)
+		}
+		return answer.String(), nil
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue // blank separators, comments and other fields
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return answer.String(), nil
+		}
+		var chunk chatChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return answer.String(), fmt.Errorf("error decoding stream: %w", err)
+		}
+		if len(chunk.Choices) > 0 {
+			if _, err := io.WriteString(out, chunk.Choices[0].Delta.Content); err != nil {
+				return answer.String(), err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return answer.String(), fmt.Errorf("error reading stream: %w", err)
+	}
+	return answer.String(), nil
+}
+
+// readAPIError turns an error response into an *APIError, using the message
+// of an OpenAI style error body when there is one.
+func readAPIError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	message := strings.TrimSpace(string(data))
+	if json.Unmarshal(data, &body) == nil && body.Error.Message != "" {
+		message = body.Error.Message
+	}
+	if message == "" {
+		message = resp.Status
+	}
+	return &APIError{StatusCode: resp.StatusCode, Message: message}
+}
+
+// Complete sends messages and returns the answer, retrying as configured by
+// Retries. It also returns the number of attempts made.
+func (c *Client) Complete(ctx context.Context, messages []Message) (string, int, error) {
+	delay := c.RetryDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	for attempt := 1; ; attempt++ {
+		answer, err := c.Stream(ctx, messages, io.Discard)
+		if err == nil || attempt > c.Retries || !retryable(ctx, err) {
+			return answer, attempt, err
+		}
+		select {
+		case <-ctx.Done():
+			return "", attempt, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// retryable reports whether a failed request is worth sending again: rate
+// limits, server errors and network failures are, other API errors are not.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// standIn is a minimal chat completions endpoint that streams back the
+// words of answer.
+func standIn(t *testing.T, answer string, got *chatRequest) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, `{"error": {"message": "bad path or key"}}`, http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, word := range strings.SplitAfter(answer, " ") {
+			data, _ := json.Marshal(map[string]any{"choices": []any{map[string]any{"delta": map[string]string{"content": word}}}})
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestStream(t *testing.T) {
+	var got chatRequest
+	srv := standIn(t, "It parses the config.", &got)
+	client := NewClient(Config{BaseURL: srv.URL + "/v1/", Model: "test-model", APIKey: "secret", MaxTokens: 100})
+
+	var out strings.Builder
+	messages := []Message{{Role: "user", Content: "What does it do?"}}
+	answer, err := client.Stream(context.Background(), messages, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer != "It parses the config." || out.String() != answer {
+		t.Errorf("answer %q, streamed %q", answer, out.String())
+	}
+	if got.Model != "test-model" || !got.Stream || got.MaxTokens != 100 || len(got.Messages) != 1 || got.Messages[0].Content != "What does it do?" {
+		t.Errorf("request = %+v", got)
+	}
+
+	client.APIKey = "wrong"
+	_, err = client.Stream(context.Background(), messages, &out)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Message != "bad path or key" {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestNonStreamingResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices": [{"message": {"role": "assistant", "content": "All at once."}}]}`)
+	}))
+	defer srv.Close()
+	answer, err := NewClient(Config{BaseURL: srv.URL}).Stream(context.Background(), nil, &strings.Builder{})
+	if err != nil || answer != "All at once." {
+		t.Errorf("answer %q, %v", answer, err)
+	}
+}
+
+func TestCheckWindow(t *testing.T) {
+	client := NewClient(Config{ContextWindow: 1000, MaxTokens: 200})
+	if err := client.CheckWindow(800); err != nil {
+		t.Errorf("prompt that fits was refused: %v", err)
+	}
+	var windowErr *WindowError
+	if err := client.CheckWindow(801); !errors.As(err, &windowErr) {
+		t.Errorf("oversized prompt was accepted: %v", err)
+	}
+	if err := NewClient(Config{}).CheckWindow(1 << 40); err != nil {
+		t.Errorf("no window configured, but got %v", err)
+	}
+}
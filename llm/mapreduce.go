@@ -0,0 +1,243 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chand1012/git2gpt/prompt"
+)
+
+// MapReduceOptions controls MapReduce.
+type MapReduceOptions struct {
+	// BatchTokens is the token budget of the files in one batch, and of the
+	// partial answers combined in one reduce call.
+	BatchTokens int64
+	// Concurrency is the number of requests in flight at once; values below
+	// 1 mean 1.
+	Concurrency int
+	// Render turns a batch into the text sent to the model. Nil renders the
+	// plain text format with the default preamble.
+	Render func(ctx context.Context, batch *prompt.GitRepo) (string, error)
+	// CountTokens counts the tokens of a prompt. Nil uses
+	// prompt.EstimateTokens.
+	CountTokens func(text string) int64
+	// OnStep is called after every request, for progress reports. Calls may
+	// come from several goroutines at once.
+	OnStep func(step Step)
+}
+
+// Transcript records a MapReduce run.
+type Transcript struct {
+	Question string    `json:"question"`
+	Model    string    `json:"model"`
+	Started  time.Time `json:"started"`
+	Map      []Step    `json:"map"`
+	Reduce   []Step    `json:"reduce,omitempty"`
+	Answer   string    `json:"answer"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Step is a single request of a MapReduce run. Map steps list the files of
+// their batch instead of the whole prompt.
+type Step struct {
+	Phase        string        `json:"phase"` // map or reduce
+	Index        int           `json:"index"`
+	Round        int           `json:"round,omitempty"` // reduce round, when answers are combined in several rounds
+	Files        []string      `json:"files,omitempty"`
+	Prompt       string        `json:"prompt,omitempty"`
+	PromptTokens int64         `json:"prompt_tokens"`
+	Answer       string        `json:"answer"`
+	Attempts     int           `json:"attempts"`
+	Duration     time.Duration `json:"duration_ns"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// WriteFile saves the transcript as JSON, creating the directory if needed.
+func (t *Transcript) WriteFile(path string) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling transcript: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error writing transcript: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing transcript: %w", err)
+	}
+	return nil
+}
+
+const mapInstructions = `This is part %d of %d of the repository; the other parts are shown separately. Using only the files above, collect everything relevant to the question below: facts, file paths, names and short code references. If nothing here is relevant, answer only "Nothing relevant in this part." Another step will combine the notes from all parts.
+
+Question: %s`
+
+const reduceInstructions = `Below are notes on the question, each taken from a different part of the same repository. Combine them into one answer to the question. Rely only on the notes, resolve overlaps, and ignore parts with nothing relevant.
+
+Question: %s
+
+%s`
+
+// MapReduce answers a question about a repository too large for one request.
+// The files are split into batches of opts.BatchTokens, each batch is asked
+// for notes on the question (map), and the notes are combined into the
+// answer (reduce), in several rounds if they do not fit one request. A
+// repository that fits one batch is asked directly. The transcript is
+// returned even when an error ends the run.
+func MapReduce(ctx context.Context, c *Client, repo *prompt.GitRepo, question string, opts MapReduceOptions) (*Transcript, error) {
+	if opts.Render == nil {
+		opts.Render = func(ctx context.Context, batch *prompt.GitRepo) (string, error) {
+			return prompt.RenderRepoContext(ctx, batch, prompt.FormatText, "", false)
+		}
+	}
+	if opts.CountTokens == nil {
+		opts.CountTokens = prompt.EstimateTokens
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	t := &Transcript{Question: question, Model: c.Model, Started: time.Now()}
+	answer, err := mapReduce(ctx, c, repo, question, opts, t)
+	t.Answer = answer
+	if err != nil {
+		t.Error = err.Error()
+	}
+	return t, err
+}
+
+func mapReduce(ctx context.Context, c *Client, repo *prompt.GitRepo, question string, opts MapReduceOptions, t *Transcript) (string, error) {
+	batches := prompt.SplitRepo(repo, opts.BatchTokens)
+	t.Map = make([]Step, len(batches))
+	err := forEach(ctx, len(batches), opts.Concurrency, func(ctx context.Context, i int) error {
+		batch := batches[i]
+		batch.Guidance = repo.Guidance
+		batch.Task = question
+		if len(batches) > 1 {
+			batch.Task = fmt.Sprintf(mapInstructions, i+1, len(batches), question)
+		}
+		step := Step{Phase: "map", Index: i}
+		for _, file := range batch.Files {
+			step.Files = append(step.Files, filepath.ToSlash(file.Path))
+		}
+		text, err := opts.Render(ctx, batch)
+		if err == nil {
+			err = run(ctx, c, text, opts, &step)
+		}
+		t.Map[i] = step
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(batches) == 1 {
+		return t.Map[0].Answer, nil
+	}
+
+	notes := make([]string, len(t.Map))
+	for i, step := range t.Map {
+		notes[i] = fmt.Sprintf("Notes from part %d of %d:\n%s", i+1, len(t.Map), strings.TrimSpace(step.Answer))
+	}
+	for round := 1; ; round++ {
+		groups := groupNotes(notes, opts.BatchTokens, opts.CountTokens)
+		steps := make([]Step, len(groups))
+		err := forEach(ctx, len(groups), opts.Concurrency, func(ctx context.Context, i int) error {
+			steps[i] = Step{Phase: "reduce", Index: i, Round: round}
+			steps[i].Prompt = fmt.Sprintf(reduceInstructions, question, strings.Join(groups[i], "\n\n"))
+			return run(ctx, c, steps[i].Prompt, opts, &steps[i])
+		})
+		t.Reduce = append(t.Reduce, steps...)
+		if err != nil {
+			return "", err
+		}
+		if len(steps) == 1 {
+			return steps[0].Answer, nil
+		}
+		notes = make([]string, len(steps))
+		for i, step := range steps {
+			notes[i] = fmt.Sprintf("Combined notes %d of %d:\n%s", i+1, len(steps), strings.TrimSpace(step.Answer))
+		}
+	}
+}
+
+// run sends one prompt and records it in step.
+func run(ctx context.Context, c *Client, text string, opts MapReduceOptions, step *Step) error {
+	start := time.Now()
+	step.PromptTokens = opts.CountTokens(text)
+	err := c.CheckWindow(step.PromptTokens)
+	if err == nil {
+		step.Answer, step.Attempts, err = c.Complete(ctx, []Message{{Role: "user", Content: text}})
+	}
+	step.Duration = time.Since(start)
+	if err != nil {
+		step.Error = err.Error()
+		err = fmt.Errorf("%s step %d: %w", step.Phase, step.Index+1, err)
+	}
+	if opts.OnStep != nil {
+		opts.OnStep(*step)
+	}
+	return err
+}
+
+// groupNotes packs notes into groups of at most budget tokens, keeping at
+// least two notes per group so every round makes progress.
+func groupNotes(notes []string, budget int64, count func(string) int64) [][]string {
+	var groups [][]string
+	var current []string
+	var used int64
+	for _, note := range notes {
+		n := count(note)
+		if len(current) >= 2 && budget > 0 && used+n > budget {
+			groups = append(groups, current)
+			current, used = nil, 0
+		}
+		current = append(current, note)
+		used += n
+	}
+	if len(current) == 1 && len(groups) > 0 {
+		groups[len(groups)-1] = append(groups[len(groups)-1], current[0])
+	} else if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
+
+// forEach calls fn for 0..n-1 with at most limit calls running at once. The
+// first error cancels the context of the remaining calls and is returned.
+func forEach(ctx context.Context, n, limit int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(ctx, i); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
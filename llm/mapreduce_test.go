@@ -0,0 +1,152 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chand1012/git2gpt/prompt"
+)
+
+type words struct{}
+
+func (words) Name() string { return "test:words" }
+
+func (words) CountTokens(text string) (int64, error) {
+	return int64(len(strings.Fields(text))), nil
+}
+
+func countWords(text string) int64 {
+	n, _ := words{}.CountTokens(text)
+	return n
+}
+
+// scriptedEndpoint answers map requests with the paths of their files and
+// reduce requests with the notes they combine. The first request fails with
+// a rate limit, to exercise retries.
+type scriptedEndpoint struct {
+	mu       sync.Mutex
+	requests int
+	inFlight int32
+	maxSeen  int32
+}
+
+var partPattern = regexp.MustCompile(`This is part (\d+) of (\d+)`)
+
+func (s *scriptedEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := atomic.AddInt32(&s.inFlight, 1)
+	defer atomic.AddInt32(&s.inFlight, -1)
+	for {
+		seen := atomic.LoadInt32(&s.maxSeen)
+		if n <= seen || atomic.CompareAndSwapInt32(&s.maxSeen, seen, n) {
+			break
+		}
+	}
+	s.mu.Lock()
+	s.requests++
+	first := s.requests == 1
+	s.mu.Unlock()
+	if first {
+		http.Error(w, `{"error": {"message": "slow down"}}`, http.StatusTooManyRequests)
+		return
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	var req chatRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	content := req.Messages[0].Content
+	var answer string
+	switch {
+	case partPattern.MatchString(content):
+		m := partPattern.FindStringSubmatch(content)
+		answer = "saw part " + m[1]
+	case strings.Contains(content, "Below are notes"):
+		answer = "combined(" + strings.Join(regexp.MustCompile(`saw part \d+|combined\([^)]*\)`).FindAllString(content, -1), ", ") + ")"
+	default:
+		answer = "direct answer"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"choices": []any{map[string]any{"message": map[string]string{"content": answer}}}})
+}
+
+func TestMapReduce(t *testing.T) {
+	endpoint := &scriptedEndpoint{}
+	srv := httptest.NewServer(endpoint)
+	defer srv.Close()
+	client := NewClient(Config{BaseURL: srv.URL, Retries: 2, RetryDelay: time.Millisecond})
+
+	repo := &prompt.GitRepo{}
+	for i := 0; i < 6; i++ {
+		repo.Files = append(repo.Files, prompt.GitFile{
+			Path:     fmt.Sprintf("file%d.go", i),
+			Contents: strings.Repeat("word ", 10),
+			Tokens:   10,
+		})
+	}
+	var steps int32
+	opts := MapReduceOptions{
+		BatchTokens: 20,
+		Concurrency: 2,
+		Render: func(ctx context.Context, batch *prompt.GitRepo) (string, error) {
+			return prompt.TextFormatter{}.Format(ctx, batch, words{})
+		},
+		CountTokens: countWords,
+		OnStep:      func(Step) { atomic.AddInt32(&steps, 1) },
+	}
+	transcript, err := MapReduce(context.Background(), client, repo, "What do the files do?", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transcript.Map) != 3 || transcript.Map[1].Files[0] != "file2.go" {
+		t.Fatalf("map steps = %+v", transcript.Map)
+	}
+	if transcript.Map[0].Attempts+transcript.Map[1].Attempts+transcript.Map[2].Attempts != 4 {
+		t.Errorf("the rate limited request was not retried exactly once")
+	}
+	for _, part := range []string{"saw part 1", "saw part 2", "saw part 3"} {
+		if !strings.Contains(transcript.Answer, part) {
+			t.Errorf("answer %q lacks %q", transcript.Answer, part)
+		}
+	}
+	if endpoint.maxSeen > 2 {
+		t.Errorf("%d requests ran at once, limit is 2", endpoint.maxSeen)
+	}
+	if int(steps) != len(transcript.Map)+len(transcript.Reduce) {
+		t.Errorf("OnStep called %d times", steps)
+	}
+
+	path := filepath.Join(t.TempDir(), "transcripts", "run.json")
+	if err := transcript.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMapReduceSmallRepoAndRounds(t *testing.T) {
+	srv := httptest.NewServer(&scriptedEndpoint{requests: 1})
+	defer srv.Close()
+	client := NewClient(Config{BaseURL: srv.URL})
+	render := func(ctx context.Context, batch *prompt.GitRepo) (string, error) {
+		return prompt.TextFormatter{}.Format(ctx, batch, words{})
+	}
+
+	small := &prompt.GitRepo{Files: []prompt.GitFile{{Path: "a.go", Contents: "x", Tokens: 1}}}
+	transcript, err := MapReduce(context.Background(), client, small, "Q?", MapReduceOptions{BatchTokens: 100, Render: render, CountTokens: countWords})
+	if err != nil || transcript.Answer != "direct answer" || len(transcript.Reduce) != 0 {
+		t.Errorf("small repo: %+v, %v", transcript, err)
+	}
+
+	// With a tiny budget the notes need more than one reduce round.
+	notes := groupNotes([]string{"a b", "c d", "e f", "g h", "i j"}, 4, countWords)
+	if len(notes) != 2 || len(notes[1]) != 3 {
+		t.Errorf("groupNotes = %q", notes)
+	}
+}
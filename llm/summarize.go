@@ -0,0 +1,45 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// summaryInstructions asks for the summary. Changing it changes the name of
+// the summarizer, so summaries cached with older instructions are not reused.
+const summaryInstructions = `Summarize the file %s below for a reader who needs to understand the rest of the repository without reading it. In at most %d sentences, say what it is for, name its main types, functions or sections, and mention what it depends on. Answer with the summary only.
+
+%s`
+
+const summaryInstructionsVersion = "1"
+
+// Summarizer summarizes files with a chat completions endpoint. It
+// implements prompt.Summarizer.
+type Summarizer struct {
+	Client    *Client
+	Sentences int // length of the summaries; 0 means 5
+}
+
+// Name identifies the model and instructions, so cached summaries are reused
+// across endpoints serving the same model.
+func (s *Summarizer) Name() string {
+	return fmt.Sprintf("llm:%s:%d:v%s", s.Client.Model, s.sentences(), summaryInstructionsVersion)
+}
+
+func (s *Summarizer) sentences() int {
+	if s.Sentences <= 0 {
+		return 5
+	}
+	return s.Sentences
+}
+
+// Summarize asks for a summary of one file.
+func (s *Summarizer) Summarize(ctx context.Context, path, contents string) (string, error) {
+	text := fmt.Sprintf(summaryInstructions, path, s.sentences(), contents)
+	answer, _, err := s.Client.Complete(ctx, []Message{{Role: "user", Content: text}})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(answer), nil
+}
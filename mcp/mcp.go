@@ -0,0 +1,177 @@
+// Package mcp implements a Model Context Protocol server that exposes a
+// repository to agents over newline-delimited JSON-RPC 2.0, typically on
+// stdin and stdout.
+//
+// The server offers the tools list_files, read_files, snapshot_repo and
+// token_stats, and publishes every selected file of the repository as a
+// resource.
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ProtocolVersion is the MCP revision the server implements.
+const ProtocolVersion = "2024-11-05"
+
+// JSON-RPC error codes.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+func invalidParams(format string, args ...any) error {
+	return &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf(format, args...)}
+}
+
+// Serve reads requests from r and writes responses to w until r is exhausted.
+// Requests are handled one at a time, in order.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	return s.ServeContext(context.Background(), r, w)
+}
+
+// ServeContext is like Serve, but also returns, without an error, once ctx is
+// done. A request being handled is cancelled with it. A read from r that is
+// still blocked is abandoned, so r should not be reused.
+func (s *Server) ServeContext(ctx context.Context, r io.Reader, w io.Writer) error {
+	type read struct {
+		line []byte
+		err  error
+	}
+	reads := make(chan read)
+	go func() {
+		br := bufio.NewReader(r)
+		for {
+			line, err := br.ReadBytes('\n')
+			select {
+			case reads <- read{line, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	enc := json.NewEncoder(w)
+	for {
+		var next read
+		select {
+		case <-ctx.Done():
+			return nil
+		case next = <-reads:
+		}
+		if len(bytes.TrimSpace(next.line)) > 0 {
+			if resp, ok := s.handleMessage(ctx, next.line); ok {
+				if err := enc.Encode(resp); err != nil {
+					return err
+				}
+			}
+		}
+		if errors.Is(next.err, io.EOF) {
+			return nil
+		}
+		if next.err != nil {
+			return next.err
+		}
+	}
+}
+
+// handleMessage processes one JSON-RPC message. Notifications produce no
+// response.
+func (s *Server) handleMessage(ctx context.Context, line []byte) (response, bool) {
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: codeParseError, Message: err.Error()}}, true
+	}
+	if len(req.ID) == 0 {
+		// Notifications such as notifications/initialized need no reply.
+		return response{}, false
+	}
+	resp := response{JSONRPC: "2.0", ID: req.ID}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		resp.Error = &rpcError{Code: codeInvalidRequest, Message: "invalid request"}
+		return resp, true
+	}
+	result, err := s.dispatch(ctx, req.Method, req.Params)
+	if err != nil {
+		var re *rpcError
+		if !errors.As(err, &re) {
+			re = &rpcError{Code: codeInternalError, Message: err.Error()}
+		}
+		resp.Error = re
+		return resp, true
+	}
+	resp.Result = result
+	return resp, true
+}
+
+func (s *Server) dispatch(ctx context.Context, method string, params json.RawMessage) (any, error) {
+	switch method {
+	case "initialize":
+		return map[string]any{
+			"protocolVersion": ProtocolVersion,
+			"capabilities": map[string]any{
+				"tools":     map[string]any{},
+				"resources": map[string]any{},
+			},
+			"serverInfo": map[string]any{"name": "git2gpt", "version": s.Version},
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return map[string]any{"tools": toolDefinitions}, nil
+	case "tools/call":
+		var p struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, invalidParams("invalid tools/call params: %s", err)
+		}
+		return s.callTool(ctx, p.Name, p.Arguments)
+	case "resources/list":
+		return s.listResources(ctx)
+	case "resources/read":
+		var p struct {
+			URI string `json:"uri"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, invalidParams("invalid resources/read params: %s", err)
+		}
+		return s.readResource(ctx, p.URI)
+	}
+	return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %q not found", method)}
+}
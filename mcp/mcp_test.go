@@ -0,0 +1,253 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// client is a minimal in-process MCP client connected to a Server through
+// pipes.
+type client struct {
+	t      *testing.T
+	w      io.WriteCloser
+	r      *bufio.Reader
+	nextID int
+}
+
+func newClient(t *testing.T, s *Server) *client {
+	t.Helper()
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := s.Serve(reqR, respW)
+		respW.Close()
+		done <- err
+	}()
+	c := &client{t: t, w: reqW, r: bufio.NewReader(respR)}
+	t.Cleanup(func() {
+		reqW.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return c
+}
+
+func (c *client) send(line string) {
+	c.t.Helper()
+	if _, err := io.WriteString(c.w, line+"\n"); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) call(method string, params any) (json.RawMessage, *rpcError) {
+	c.t.Helper()
+	c.nextID++
+	msg, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": c.nextID, "method": method, "params": params})
+	c.send(string(msg))
+	line, err := c.r.ReadBytes('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	var resp struct {
+		ID     int             `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.Unmarshal(line, &resp); err != nil {
+		c.t.Fatal(err)
+	}
+	if resp.ID != c.nextID {
+		c.t.Fatalf("response id %d, want %d", resp.ID, c.nextID)
+	}
+	return resp.Result, resp.Error
+}
+
+func (c *client) tool(name string, args any) (string, bool) {
+	c.t.Helper()
+	raw, rpcErr := c.call("tools/call", map[string]any{"name": name, "arguments": args})
+	if rpcErr != nil {
+		c.t.Fatalf("%s: %s", name, rpcErr.Message)
+	}
+	var result toolResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		c.t.Fatal(err)
+	}
+	return result.Content[0].Text, result.IsError
+}
+
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"main.go":        "package main\n",
+		"docs/guide.md":  "# Guide\n",
+		".env":           "SECRET=1\n",
+		".gptignore":     ".env\n",
+		"src/lib/lib.go": "package lib\n",
+	} {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestProtocol(t *testing.T) {
+	c := newClient(t, &Server{RepoPath: newTestRepo(t), UseGitignore: true, Version: "test"})
+
+	raw, rpcErr := c.call("initialize", map[string]any{"protocolVersion": ProtocolVersion, "capabilities": map[string]any{}})
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	if !strings.Contains(string(raw), `"name":"git2gpt"`) {
+		t.Errorf("unexpected initialize result: %s", raw)
+	}
+	// Notifications get no response; the next call must still line up.
+	c.send(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+
+	raw, _ = c.call("tools/list", nil)
+	for _, name := range []string{"list_files", "read_files", "snapshot_repo", "token_stats"} {
+		if !strings.Contains(string(raw), `"name":"`+name+`"`) {
+			t.Errorf("tools/list is missing %s", name)
+		}
+	}
+
+	if _, rpcErr := c.call("no/such/method", nil); rpcErr == nil || rpcErr.Code != codeMethodNotFound {
+		t.Errorf("unknown method error = %+v", rpcErr)
+	}
+	c.send(`{not json`)
+	line, _ := c.r.ReadBytes('\n')
+	if !strings.Contains(string(line), `"code":-32700`) {
+		t.Errorf("parse error response = %s", line)
+	}
+}
+
+func TestTools(t *testing.T) {
+	c := newClient(t, &Server{RepoPath: newTestRepo(t), UseGitignore: true})
+
+	text, _ := c.tool("list_files", map[string]any{})
+	if !strings.Contains(text, "main.go") || !strings.Contains(text, "src/lib/lib.go") || strings.Contains(text, ".env") {
+		t.Errorf("list_files = %q", text)
+	}
+	text, _ = c.tool("list_files", map[string]any{"include": []string{"**.go"}, "ignore": []string{"src/**"}})
+	if !strings.Contains(text, "main.go") || strings.Contains(text, "lib.go") || strings.Contains(text, "guide.md") {
+		t.Errorf("list_files with selection = %q", text)
+	}
+
+	text, isErr := c.tool("read_files", map[string]any{"paths": []string{"./docs/guide.md"}})
+	if isErr || !strings.Contains(text, "# Guide") {
+		t.Errorf("read_files = %q", text)
+	}
+	for _, p := range []string{".env", "../outside.txt"} {
+		if _, isErr := c.tool("read_files", map[string]any{"paths": []string{p}}); !isErr {
+			t.Errorf("read_files(%s) succeeded", p)
+		}
+	}
+
+	text, _ = c.tool("snapshot_repo", map[string]any{"format": "json", "include": []string{"docs/**"}})
+	var repo struct {
+		FileCount int `json:"file_count"`
+	}
+	if err := json.Unmarshal([]byte(text), &repo); err != nil || repo.FileCount != 1 {
+		t.Errorf("snapshot_repo = %q (%v)", text, err)
+	}
+	if _, isErr := c.tool("snapshot_repo", map[string]any{"include": []string{"["}}); !isErr {
+		t.Errorf("invalid pattern was accepted")
+	}
+
+	text, _ = c.tool("token_stats", map[string]any{"top": 1})
+	if !strings.Contains(text, "Files: 3") || !strings.Contains(text, "Total tokens:") {
+		t.Errorf("token_stats = %q", text)
+	}
+}
+
+func TestResources(t *testing.T) {
+	c := newClient(t, &Server{RepoPath: newTestRepo(t), UseGitignore: true})
+
+	raw, _ := c.call("resources/list", nil)
+	if !strings.Contains(string(raw), "git2gpt:///src/lib/lib.go") || strings.Contains(string(raw), ".env") {
+		t.Errorf("resources/list = %s", raw)
+	}
+	raw, rpcErr := c.call("resources/read", map[string]any{"uri": "git2gpt:///main.go"})
+	if rpcErr != nil || !strings.Contains(string(raw), `"text":"package main\n"`) {
+		t.Errorf("resources/read = %s %+v", raw, rpcErr)
+	}
+	if _, rpcErr := c.call("resources/read", map[string]any{"uri": "git2gpt:///.env"}); rpcErr == nil {
+		t.Errorf("ignored file was readable as a resource")
+	}
+}
+
+func TestServeContextCancel(t *testing.T) {
+	// The reader never delivers a line, like a client that stays connected.
+	reqR, reqW := io.Pipe()
+	defer reqW.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- (&Server{RepoPath: t.TempDir()}).ServeContext(ctx, reqR, io.Discard) }()
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ServeContext: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeContext did not return after the context was cancelled")
+	}
+}
+
+// countingTokenizer counts words and how many texts it was given.
+type countingTokenizer struct{ calls int }
+
+func (*countingTokenizer) Name() string { return "test:counting" }
+
+func (t *countingTokenizer) CountTokens(text string) (int64, error) {
+	t.calls++
+	return int64(len(strings.Fields(text))), nil
+}
+
+func TestUnchangedFilesAreNotReadAgain(t *testing.T) {
+	dir := newTestRepo(t)
+	tok := &countingTokenizer{}
+	c := newClient(t, &Server{RepoPath: dir, UseGitignore: true, Tokenizer: tok})
+
+	first, _ := c.tool("list_files", map[string]any{})
+	read := tok.calls
+	if read == 0 {
+		t.Fatal("list_files counted no tokens")
+	}
+	second, _ := c.tool("list_files", map[string]any{"include": []string{"**/*.go"}})
+	c.tool("read_files", map[string]any{"paths": []string{"main.go"}})
+	if tok.calls != read {
+		t.Errorf("unchanged files were tokenized again: %d counts after %d", tok.calls, read)
+	}
+	if !strings.Contains(first, "docs/guide.md") || strings.Contains(second, "docs/guide.md") {
+		t.Errorf("selections were mixed up:\n%s\n%s", first, second)
+	}
+
+	main := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(main, []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(main, later, later)
+	text, _ := c.tool("read_files", map[string]any{"paths": []string{"main.go"}})
+	if !strings.Contains(text, "func main() {}") {
+		t.Errorf("read_files returned the old contents:\n%s", text)
+	}
+	if tok.calls != read+1 {
+		t.Errorf("%d counts after changing one file, want %d", tok.calls, read+1)
+	}
+}
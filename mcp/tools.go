@@ -0,0 +1,333 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/chand1012/git2gpt/prompt"
+)
+
+// Server serves a single repository.
+type Server struct {
+	RepoPath        string // repository to expose
+	IgnoreFilePath  string // .gptignore to use instead of the repository's own
+	IncludeFilePath string // .gptinclude to use instead of the repository's own
+	UseGitignore    bool   // apply the repository's .gitignore
+	Version         string // reported to clients in serverInfo
+	// Tokenizer counts the tokens of files and outputs; nil means
+	// prompt.DefaultTokenizer. Use DiskCache.Tokenizer to cache the counts.
+	Tokenizer prompt.Tokenizer
+
+	// files keeps the files read by earlier requests, so a request only
+	// reads and tokenizes the files whose size or modification time changed
+	// since. Requests are handled one at a time, so it needs no lock.
+	files *prompt.TokenCache
+}
+
+// selection holds the arguments shared by the tools that choose files.
+type selection struct {
+	Include []string `json:"include"`
+	Ignore  []string `json:"ignore"`
+	Budget  int64    `json:"budget"`
+}
+
+var selectionProperties = map[string]any{
+	"include": map[string]any{
+		"type":        "array",
+		"items":       map[string]any{"type": "string"},
+		"description": "Glob patterns of files to include, replacing the repository's .gptinclude.",
+	},
+	"ignore": map[string]any{
+		"type":        "array",
+		"items":       map[string]any{"type": "string"},
+		"description": "Additional glob patterns of files to leave out.",
+	},
+	"budget": map[string]any{
+		"type":        "integer",
+		"description": "Maximum number of tokens; files are dropped until the rest fits.",
+	},
+}
+
+func withProperties(extra map[string]any, required ...string) map[string]any {
+	props := map[string]any{}
+	for k, v := range selectionProperties {
+		props[k] = v
+	}
+	for k, v := range extra {
+		props[k] = v
+	}
+	schema := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+var toolDefinitions = []map[string]any{
+	{
+		"name":        "list_files",
+		"description": "List the files of the repository that git2gpt would include, with their token counts.",
+		"inputSchema": withProperties(nil),
+	},
+	{
+		"name":        "read_files",
+		"description": "Return the contents of the given files, with paths relative to the repository root.",
+		"inputSchema": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"paths": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			},
+			"required": []string{"paths"},
+		},
+	},
+	{
+		"name":        "snapshot_repo",
+		"description": "Render the repository in git2gpt's text, JSON or XML format.",
+		"inputSchema": withProperties(map[string]any{
+			"format": map[string]any{"type": "string", "enum": []string{prompt.FormatText, prompt.FormatJSON, prompt.FormatXML}},
+			"scrub_comments": map[string]any{
+				"type":        "boolean",
+				"description": "Remove code comments to save tokens.",
+			},
+		}),
+	},
+	{
+		"name":        "token_stats",
+		"description": "Summarize token usage: total tokens, file count and the largest files.",
+		"inputSchema": withProperties(map[string]any{
+			"top": map[string]any{"type": "integer", "description": "Number of largest files to list (default 10)."},
+		}),
+	},
+}
+
+type toolResult struct {
+	Content []textContent `json:"content"`
+	IsError bool          `json:"isError,omitempty"`
+}
+
+type textContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func textResult(text string) toolResult {
+	return toolResult{Content: []textContent{{Type: "text", Text: text}}}
+}
+
+// callTool runs a tool. Failures of the tool itself are reported in the
+// result with isError set, as MCP asks, rather than as protocol errors.
+func (s *Server) callTool(ctx context.Context, name string, args json.RawMessage) (any, error) {
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	var text string
+	var err error
+	switch name {
+	case "list_files":
+		text, err = s.listFilesTool(ctx, args)
+	case "read_files":
+		text, err = s.readFilesTool(ctx, args)
+	case "snapshot_repo":
+		text, err = s.snapshotTool(ctx, args)
+	case "token_stats":
+		text, err = s.tokenStatsTool(ctx, args)
+	default:
+		return nil, invalidParams("unknown tool %q", name)
+	}
+	if err != nil {
+		return toolResult{Content: []textContent{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+	}
+	return textResult(text), nil
+}
+
+// load runs the prompt pipeline with the selection applied on top of the
+// repository's own include and ignore files. Every request walks the
+// repository again, but unchanged files come from s.files.
+func (s *Server) load(ctx context.Context, sel selection) (*prompt.GitRepo, error) {
+	if err := prompt.ValidatePatterns(append(sel.Include, sel.Ignore...)); err != nil {
+		return nil, err
+	}
+	includeList, err := prompt.LoadIncludeList(s.RepoPath, s.IncludeFilePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(sel.Include) > 0 {
+		includeList = sel.Include
+	}
+	ignoreList, err := prompt.LoadIgnoreList(s.RepoPath, s.IgnoreFilePath, s.UseGitignore)
+	if err != nil {
+		return nil, err
+	}
+	if s.files == nil {
+		s.files = prompt.NewTokenCache()
+	}
+	opts := prompt.ProcessOptions{Cache: s.files, OnError: prompt.SkipOnError, IgnoreGitignore: !s.UseGitignore, Tokenizer: s.Tokenizer}
+	repo, err := prompt.ProcessGitRepoContext(ctx, s.RepoPath, includeList, append(ignoreList, sel.Ignore...), opts)
+	if err != nil {
+		return nil, err
+	}
+	prompt.ApplyTokenBudget(repo, sel.Budget)
+	return repo, nil
+}
+
+func (s *Server) listFilesTool(ctx context.Context, args json.RawMessage) (string, error) {
+	var sel selection
+	if err := json.Unmarshal(args, &sel); err != nil {
+		return "", err
+	}
+	repo, err := s.load(ctx, sel)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, f := range repo.Files {
+		fmt.Fprintf(&b, "%s (%d tokens)\n", filepath.ToSlash(f.Path), f.Tokens)
+	}
+	fmt.Fprintf(&b, "%d files\n", repo.FileCount)
+	return b.String(), nil
+}
+
+func (s *Server) readFilesTool(ctx context.Context, args json.RawMessage) (string, error) {
+	var p struct {
+		Paths []string `json:"paths"`
+	}
+	if err := json.Unmarshal(args, &p); err != nil {
+		return "", err
+	}
+	if len(p.Paths) == 0 {
+		return "", fmt.Errorf("no paths given")
+	}
+	files, err := s.selectedFiles(ctx)
+	if err != nil {
+		return "", err
+	}
+	var selected []prompt.GitFile
+	for _, requested := range p.Paths {
+		clean := path.Clean(strings.TrimPrefix(filepath.ToSlash(requested), "./"))
+		f, ok := files[clean]
+		if !ok {
+			return "", fmt.Errorf("%s is not a file of the repository or is excluded by its ignore rules", requested)
+		}
+		f.Path = clean
+		selected = append(selected, f)
+	}
+	delims := prompt.ChooseDelimiters(selected)
+	var b strings.Builder
+	for _, f := range selected {
+		fmt.Fprintf(&b, "%s\n%s\n%s\n", delims.File, f.Path, f.Contents)
+	}
+	b.WriteString(delims.End)
+	return b.String(), nil
+}
+
+// selectedFiles returns the files selected by the repository's own rules,
+// keyed by slash separated path. Only these files can be read, so the ignore
+// rules also keep secrets away from agents.
+func (s *Server) selectedFiles(ctx context.Context) (map[string]prompt.GitFile, error) {
+	repo, err := s.load(ctx, selection{})
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]prompt.GitFile{}
+	for _, f := range repo.Files {
+		files[filepath.ToSlash(f.Path)] = f
+	}
+	return files, nil
+}
+
+func (s *Server) snapshotTool(ctx context.Context, args json.RawMessage) (string, error) {
+	var p struct {
+		selection
+		Format        string `json:"format"`
+		ScrubComments bool   `json:"scrub_comments"`
+	}
+	if err := json.Unmarshal(args, &p); err != nil {
+		return "", err
+	}
+	repo, err := s.load(ctx, p.selection)
+	if err != nil {
+		return "", err
+	}
+	return prompt.RenderRepoWith(ctx, repo, p.Format, "", p.ScrubComments, prompt.RequestOptions{}, s.Tokenizer)
+}
+
+func (s *Server) tokenStatsTool(ctx context.Context, args json.RawMessage) (string, error) {
+	var p struct {
+		selection
+		Top int `json:"top"`
+	}
+	if err := json.Unmarshal(args, &p); err != nil {
+		return "", err
+	}
+	if p.Top <= 0 {
+		p.Top = 10
+	}
+	repo, err := s.load(ctx, p.selection)
+	if err != nil {
+		return "", err
+	}
+	var total int64
+	for _, f := range repo.Files {
+		total += f.Tokens
+	}
+	files := append([]prompt.GitFile(nil), repo.Files...)
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Tokens > files[j].Tokens })
+	if len(files) > p.Top {
+		files = files[:p.Top]
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Files: %d\nTotal tokens: %d\nLargest files:\n", repo.FileCount, total)
+	for _, f := range files {
+		fmt.Fprintf(&b, "  %s: %d tokens\n", filepath.ToSlash(f.Path), f.Tokens)
+	}
+	return b.String(), nil
+}
+
+type resource struct {
+	URI      string `json:"uri"`
+	Name     string `json:"name"`
+	MimeType string `json:"mimeType"`
+}
+
+// resourceURI names a repository file in the git2gpt URI scheme, e.g.
+// git2gpt:///src/main.go.
+func resourceURI(p string) string {
+	return (&url.URL{Scheme: "git2gpt", Path: "/" + p}).String()
+}
+
+func (s *Server) listResources(ctx context.Context) (any, error) {
+	files, err := s.selectedFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resources := []resource{}
+	for p := range files {
+		resources = append(resources, resource{URI: resourceURI(p), Name: p, MimeType: "text/plain"})
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Name < resources[j].Name })
+	return map[string]any{"resources": resources}, nil
+}
+
+func (s *Server) readResource(ctx context.Context, uri string) (any, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "git2gpt" {
+		return nil, invalidParams("unknown resource %q", uri)
+	}
+	files, err := s.selectedFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := files[strings.TrimPrefix(u.Path, "/")]
+	if !ok {
+		return nil, invalidParams("unknown resource %q", uri)
+	}
+	return map[string]any{
+		"contents": []map[string]any{{"uri": uri, "mimeType": "text/plain", "text": f.Contents}},
+	}, nil
+}
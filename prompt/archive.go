@@ -0,0 +1,419 @@
+package prompt
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ArchiveLimits guards against decompression bombs. An archive exceeding
+// any of them is rejected rather than truncated.
+type ArchiveLimits struct {
+	MaxFileSize  int64 // uncompressed bytes of a single file
+	MaxTotalSize int64 // uncompressed bytes of all files together
+	MaxFiles     int   // number of entries
+}
+
+// DefaultArchiveLimits are generous for source code and small enough to keep
+// in memory.
+var DefaultArchiveLimits = ArchiveLimits{
+	MaxFileSize:  64 << 20,
+	MaxTotalSize: 1 << 30,
+	MaxFiles:     200000,
+}
+
+// IsArchive reports whether path names an archive ProcessArchive can read,
+// judging by its extension: .zip, .tar, .tar.gz or .tgz.
+func IsArchive(p string) bool {
+	return archiveKind(p) != ""
+}
+
+func archiveKind(p string) string {
+	lower := strings.ToLower(p)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	}
+	return ""
+}
+
+// ArchiveError reports an archive that was rejected as unsafe: an entry that
+// would escape the archive root, or contents beyond the ArchiveLimits.
+type ArchiveError struct {
+	Archive string
+	Entry   string
+	Reason  string
+}
+
+func (e *ArchiveError) Error() string {
+	if e.Entry == "" {
+		return fmt.Sprintf("archive %s rejected: %s", e.Archive, e.Reason)
+	}
+	return fmt.Sprintf("archive %s rejected: entry %q %s", e.Archive, e.Entry, e.Reason)
+}
+
+// OpenArchive reads the regular files of a zip, tar or gzipped tar archive
+// into memory, without extracting anything to disk, and returns them as a
+// file system. Links and special files are left out. If every entry is below
+// a single top-level directory, as in most source drops, that directory is
+// the root of the file system.
+func OpenArchive(archivePath string, limits ArchiveLimits) (fs.FS, error) {
+	r := &archiveReader{archive: archivePath, limits: limits, fsys: newMemFS()}
+	var err error
+	switch archiveKind(archivePath) {
+	case "zip":
+		err = r.readZip()
+	case "tar", "tar.gz":
+		err = r.readTar(archiveKind(archivePath) == "tar.gz")
+	default:
+		return nil, fmt.Errorf("%s is not a zip, tar or tar.gz archive", archivePath)
+	}
+	if err != nil {
+		var archiveErr *ArchiveError
+		if errors.As(err, &archiveErr) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error reading archive %s: %w", archivePath, err)
+	}
+	return r.fsys.stripTopDir(), nil
+}
+
+type archiveReader struct {
+	archive string
+	limits  ArchiveLimits
+	fsys    *memFS
+	total   int64
+	entries int
+}
+
+func (r *archiveReader) readZip() error {
+	// Insecure names are rejected by entryName below, with the entry named.
+	zr, err := zip.OpenReader(r.archive)
+	if err != nil && !(errors.Is(err, zip.ErrInsecurePath) && zr != nil) {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		name, err := r.entryName(f.Name)
+		if err != nil {
+			return err
+		}
+		if name == "" || !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = r.add(name, f.Mode(), f.Modified, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *archiveReader) readTar(gzipped bool) error {
+	f, err := os.Open(r.archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var in io.Reader = f
+	if gzipped {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		in = gz
+	}
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name, err := r.entryName(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if name == "" || !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		if err := r.add(name, hdr.FileInfo().Mode(), hdr.ModTime, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// entryName cleans the name of an archive entry. It rejects names that would
+// escape the archive root and returns "" for the root itself.
+func (r *archiveReader) entryName(name string) (string, error) {
+	r.entries++
+	if r.limits.MaxFiles > 0 && r.entries > r.limits.MaxFiles {
+		return "", &ArchiveError{Archive: r.archive, Reason: fmt.Sprintf("has more than %d entries", r.limits.MaxFiles)}
+	}
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(slashed, "/") || (len(slashed) >= 2 && slashed[1] == ':') {
+		return "", &ArchiveError{Archive: r.archive, Entry: name, Reason: "has an absolute path"}
+	}
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return "", &ArchiveError{Archive: r.archive, Entry: name, Reason: "escapes the archive root"}
+		}
+	}
+	cleaned := path.Clean(slashed)
+	if cleaned == "." {
+		return "", nil
+	}
+	return cleaned, nil
+}
+
+// add reads a regular file, enforcing the size limits while reading, since
+// the sizes recorded in an archive cannot be trusted.
+func (r *archiveReader) add(name string, mode fs.FileMode, modTime time.Time, contents io.Reader) error {
+	limit := int64(-1)
+	if r.limits.MaxFileSize > 0 {
+		limit = r.limits.MaxFileSize
+	}
+	overTotal := false
+	if remaining := r.limits.MaxTotalSize - r.total; r.limits.MaxTotalSize > 0 && (limit < 0 || remaining < limit) {
+		limit, overTotal = remaining, true
+	}
+	if limit >= 0 {
+		contents = io.LimitReader(contents, limit+1)
+	}
+	data, err := io.ReadAll(contents)
+	if err != nil {
+		return err
+	}
+	if limit >= 0 && int64(len(data)) > limit {
+		reason := fmt.Sprintf("is larger than %d bytes", r.limits.MaxFileSize)
+		if overTotal {
+			reason = fmt.Sprintf("brings the archive over %d bytes", r.limits.MaxTotalSize)
+		}
+		return &ArchiveError{Archive: r.archive, Entry: name, Reason: reason}
+	}
+	r.total += int64(len(data))
+	if err := r.fsys.addFile(name, data, mode.Perm(), modTime); err != nil {
+		return &ArchiveError{Archive: r.archive, Entry: name, Reason: err.Error()}
+	}
+	return nil
+}
+
+// ArchiveOptions holds the settings of ProcessArchive.
+type ArchiveOptions struct {
+	ProcessOptions
+	// IgnoreFile and IncludeFile name pattern files on disk. When empty, the
+	// .gptignore and .gptinclude at the root of the archive are used.
+	IgnoreFile   string
+	IncludeFile  string
+	UseGitignore bool
+	Limits       ArchiveLimits
+}
+
+// ProcessArchive is ProcessGitRepoContext for an archive opened with
+// OpenArchive. The ignore and include rules apply relative to the root of
+// the archive. Files are not cached, since archives have no stable file
+// information to key them on.
+func ProcessArchive(ctx context.Context, archivePath string, opts ArchiveOptions) (*GitRepo, error) {
+	fsys, err := OpenArchive(archivePath, opts.Limits)
+	if err != nil {
+		return nil, err
+	}
+	var includeList []string
+	if opts.IncludeFile != "" {
+		includeList, err = getIncludeList(opts.IncludeFile)
+		includeList = expandDirsFS(fsys, includeList)
+	} else {
+		includeList, err = includeListFS(fsys, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ignoreList []string
+	if opts.IgnoreFile != "" {
+		var patterns, gitignore []string
+		patterns, err = getIgnoreList(opts.IgnoreFile)
+		if err == nil && opts.UseGitignore {
+			gitignore, err = readPatternsFS(fsys, ".gitignore")
+		}
+		ignoreList = append(patterns, ".git/**", ".gitignore", ".gptignore", ".gptinclude")
+		ignoreList = expandDirsFS(fsys, append(ignoreList, gitignore...))
+	} else {
+		ignoreList, err = ignoreListFS(fsys, "", opts.UseGitignore)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var repo GitRepo
+	walk := walkOptions{ProcessOptions: opts.ProcessOptions}
+	walk.Cache = nil
+	err = processFS(ctx, fsys, includeList, ignoreList, &repo, walk)
+	localizePaths(&repo, archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("error processing archive %s: %w", archivePath, err)
+	}
+	return &repo, nil
+}
+
+// memFS is a read-only in-memory file system.
+type memFS struct {
+	files map[string]*memFile // by slash separated path; directories included
+}
+
+type memFile struct {
+	name    string // base name
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+	entries []fs.DirEntry // of directories, sorted by name
+}
+
+func newMemFS() *memFS {
+	return &memFS{files: map[string]*memFile{".": {name: ".", mode: fs.ModeDir | 0755}}}
+}
+
+// addFile adds a file and its parent directories. A later entry with the
+// same name replaces an earlier one, as extracting the archive would, but a
+// name cannot be both a file and a directory: which one extraction kept
+// would depend on the tool, so such archives are rejected.
+func (m *memFS) addFile(name string, data []byte, mode fs.FileMode, modTime time.Time) error {
+	if f, ok := m.files[name]; ok && f.mode.IsDir() {
+		return fmt.Errorf("is also a directory")
+	}
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if f, ok := m.files[dir]; ok && !f.mode.IsDir() {
+			return fmt.Errorf("is below %s, which is also a file", dir)
+		}
+	}
+	m.files[name] = &memFile{name: path.Base(name), data: data, mode: mode, modTime: modTime}
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		if _, ok := m.files[dir]; ok {
+			break
+		}
+		m.files[dir] = &memFile{name: path.Base(dir), mode: fs.ModeDir | 0755, modTime: modTime}
+	}
+	return nil
+}
+
+// index fills in the directory entries once all files are added.
+func (m *memFS) index() {
+	for _, f := range m.files {
+		f.entries = nil
+	}
+	names := make([]string, 0, len(m.files))
+	for name := range m.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "." {
+			continue
+		}
+		parent := m.files[path.Dir(name)]
+		parent.entries = append(parent.entries, fs.FileInfoToDirEntry(m.files[name].info()))
+	}
+}
+
+// stripTopDir returns the file system below the single top-level directory
+// holding every file, if there is one, and indexes the directories.
+func (m *memFS) stripTopDir() *memFS {
+	m.index()
+	root := m.files["."]
+	if len(root.entries) != 1 || !root.entries[0].IsDir() {
+		return m
+	}
+	prefix := root.entries[0].Name() + "/"
+	stripped := &memFS{files: map[string]*memFile{}}
+	for name, f := range m.files {
+		switch {
+		case name == root.entries[0].Name():
+			stripped.files["."] = &memFile{name: ".", mode: f.mode, modTime: f.modTime}
+		case strings.HasPrefix(name, prefix):
+			stripped.files[strings.TrimPrefix(name, prefix)] = f
+		}
+	}
+	stripped.index()
+	return stripped
+}
+
+func (m *memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	f, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &openMemFile{memFile: f, Reader: bytes.NewReader(f.data)}, nil
+}
+
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	f, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	if !f.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return append([]fs.DirEntry(nil), f.entries...), nil
+}
+
+func (f *memFile) info() fs.FileInfo { return memFileInfo{f} }
+
+type memFileInfo struct{ f *memFile }
+
+func (i memFileInfo) Name() string       { return i.f.name }
+func (i memFileInfo) Size() int64        { return int64(len(i.f.data)) }
+func (i memFileInfo) Mode() fs.FileMode  { return i.f.mode }
+func (i memFileInfo) ModTime() time.Time { return i.f.modTime }
+func (i memFileInfo) IsDir() bool        { return i.f.mode.IsDir() }
+func (i memFileInfo) Sys() any           { return nil }
+
+type openMemFile struct {
+	*memFile
+	*bytes.Reader
+	offset int // of ReadDir
+}
+
+func (f *openMemFile) Stat() (fs.FileInfo, error) { return f.info(), nil }
+func (f *openMemFile) Close() error               { return nil }
+
+func (f *openMemFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries := f.entries[f.offset:]
+	if n > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
+		}
+		if len(entries) > n {
+			entries = entries[:n]
+		}
+	}
+	f.offset += len(entries)
+	return entries, nil
+}
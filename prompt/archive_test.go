@@ -0,0 +1,145 @@
+package prompt
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var archiveFiles = map[string]string{
+	"drop-1.0/.gptignore":      "vendor\n",
+	"drop-1.0/main.go":         "package main\n",
+	"drop-1.0/vendor/lib.go":   "package lib\n",
+	"drop-1.0/docs/readme.txt": "hello\n",
+}
+
+func writeZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, contents := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(contents))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTarGz(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, contents := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(contents))
+	}
+	tw.WriteHeader(&tar.Header{Name: "drop-1.0/link", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink})
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessArchive(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "drop.zip")
+	tgzPath := filepath.Join(dir, "drop.tar.gz")
+	writeZip(t, zipPath, archiveFiles)
+	writeTarGz(t, tgzPath, archiveFiles)
+
+	for _, archive := range []string{zipPath, tgzPath} {
+		repo, err := ProcessArchive(context.Background(), archive, ArchiveOptions{Limits: DefaultArchiveLimits})
+		if err != nil {
+			t.Fatalf("%s: %v", archive, err)
+		}
+		var paths []string
+		for _, file := range repo.Files {
+			paths = append(paths, filepath.ToSlash(file.Path))
+		}
+		// The top-level directory is the root, so .gptignore applies.
+		if strings.Join(paths, ",") != "docs/readme.txt,main.go" {
+			t.Errorf("%s: files = %v", archive, paths)
+		}
+	}
+
+	includeFile := filepath.Join(dir, "include")
+	os.WriteFile(includeFile, []byte("docs\n"), 0644)
+	repo, err := ProcessArchive(context.Background(), zipPath, ArchiveOptions{IncludeFile: includeFile})
+	if err != nil || len(repo.Files) != 1 || repo.Files[0].Contents != "hello\n" {
+		t.Errorf("include file on disk: %+v, %v", repo, err)
+	}
+}
+
+func TestArchiveGuards(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"../escape.txt", "/etc/passwd", `a\..\..\b`} {
+		path := filepath.Join(dir, "evil.zip")
+		writeZip(t, path, map[string]string{"ok.txt": "ok", name: "x"})
+		_, err := OpenArchive(path, DefaultArchiveLimits)
+		var archiveErr *ArchiveError
+		if !errors.As(err, &archiveErr) || archiveErr.Entry != name {
+			t.Errorf("%q: err = %v", name, err)
+		}
+	}
+
+	path := filepath.Join(dir, "bomb.tgz")
+	writeTarGz(t, path, map[string]string{"a": strings.Repeat("0", 600), "b": strings.Repeat("0", 600)})
+	limits := ArchiveLimits{MaxFileSize: 1000, MaxTotalSize: 1000}
+	if _, err := OpenArchive(path, limits); err == nil || !strings.Contains(err.Error(), "over 1000 bytes") {
+		t.Errorf("total limit: %v", err)
+	}
+	limits = ArchiveLimits{MaxFileSize: 500}
+	if _, err := OpenArchive(path, limits); err == nil || !strings.Contains(err.Error(), "larger than 500 bytes") {
+		t.Errorf("file limit: %v", err)
+	}
+	// A name that is both a file and a directory is rejected in either order.
+	for _, names := range [][]string{{"a", "a/b"}, {"a/b", "a"}, {"x/a", "x/a/b/c"}} {
+		path := filepath.Join(dir, "conflict.zip")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw := zip.NewWriter(f)
+		for _, name := range names {
+			w, err := zw.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write([]byte(name))
+		}
+		zw.Close()
+		f.Close()
+		_, err = OpenArchive(path, DefaultArchiveLimits)
+		var archiveErr *ArchiveError
+		if !errors.As(err, &archiveErr) || archiveErr.Entry != names[1] {
+			t.Errorf("%q: err = %v", names, err)
+		}
+	}
+	limits = ArchiveLimits{MaxFiles: 2}
+	if _, err := OpenArchive(path, limits); err == nil {
+		t.Error("entry limit not enforced")
+	}
+}
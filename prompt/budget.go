@@ -0,0 +1,72 @@
+package prompt
+
+import "fmt"
+
+// ApplyTokenBudget drops files from repo until the combined token count of the
+// remaining files fits within budget. Files are kept in order; a file that
+// does not fit is skipped so that smaller files after it can still be
+// included. It returns the paths of the dropped files. A non-positive budget
+// keeps every file.
+func ApplyTokenBudget(repo *GitRepo, budget int64) []string {
+	if budget <= 0 {
+		return nil
+	}
+	var kept []GitFile
+	var dropped []string
+	var used int64
+	for _, file := range repo.Files {
+		if used+file.Tokens > budget {
+			dropped = append(dropped, file.Path)
+			continue
+		}
+		used += file.Tokens
+		kept = append(kept, file)
+	}
+	repo.Files = kept
+	repo.FileCount = len(kept)
+	return dropped
+}
+
+// SplitRepo divides the files of repo into batches whose combined token
+// counts fit within budget, keeping the files in order. A file larger than
+// budget on its own is cut into pieces on syntactic boundaries with
+// ChunkFile; the pieces are marked partial and their paths name the lines
+// they hold. The batches carry the files only. A non-positive budget gives a
+// single batch.
+func SplitRepo(repo *GitRepo, budget int64) []*GitRepo {
+	return splitRepo(repo, budget, DefaultTokenizer)
+}
+
+func splitRepo(repo *GitRepo, budget int64, tok Tokenizer) []*GitRepo {
+	var files []GitFile
+	for _, file := range repo.Files {
+		if budget <= 0 || file.Tokens <= budget {
+			files = append(files, file)
+			continue
+		}
+		for _, chunk := range ChunkFile(file, ChunkOptions{MaxTokens: budget, Tokenizer: tok}) {
+			piece := file
+			piece.Path = fmt.Sprintf("%s (lines %d-%d)", file.Path, chunk.StartLine, chunk.EndLine)
+			piece.Contents = chunk.Content
+			piece.Tokens = chunk.Tokens
+			piece.Partial = true
+			files = append(files, piece)
+		}
+	}
+	var batches []*GitRepo
+	current := &GitRepo{}
+	var used int64
+	for _, file := range files {
+		if len(current.Files) > 0 && budget > 0 && used+file.Tokens > budget {
+			batches = append(batches, current)
+			current, used = &GitRepo{}, 0
+		}
+		current.Files = append(current.Files, file)
+		current.FileCount++
+		used += file.Tokens
+	}
+	if len(current.Files) > 0 || len(batches) == 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
@@ -0,0 +1,103 @@
+package prompt
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// TokenCache remembers the contents and token counts of files between runs in
+// the same process, so unchanged files are neither re-read nor re-tokenized. A
+// file is considered unchanged while its size and modification time stay the
+// same. The zero value is not usable; create one with NewTokenCache. A nil
+// *TokenCache disables caching.
+type TokenCache struct {
+	files map[string]cachedFile
+}
+
+type cachedFile struct {
+	size    int64
+	modTime time.Time
+	file    GitFile
+}
+
+// NewTokenCache returns an empty cache.
+func NewTokenCache() *TokenCache {
+	return &TokenCache{files: make(map[string]cachedFile)}
+}
+
+func (c *TokenCache) lookup(path string, info os.FileInfo) (GitFile, bool) {
+	if c == nil {
+		return GitFile{}, false
+	}
+	entry, ok := c.files[path]
+	if !ok || entry.size != info.Size() || !entry.modTime.Equal(info.ModTime()) {
+		return GitFile{}, false
+	}
+	return entry.file, true
+}
+
+func (c *TokenCache) store(path string, info os.FileInfo, file GitFile) {
+	if c == nil {
+		return
+	}
+	c.files[path] = cachedFile{size: info.Size(), modTime: info.ModTime(), file: file}
+}
+
+// FileStamp is the size and modification time of a file, by which
+// TokenCache and StatGitRepo tell that it changed without reading it.
+type FileStamp struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// StatGitRepo walks repoPath as ProcessGitRepoContext does, selecting the
+// same files, but only stats them instead of reading them, so a repository
+// can be polled for changes cheaply. The stamps are keyed by the path of the
+// file on disk, below repoPath.
+func StatGitRepo(ctx context.Context, repoPath string, includeList, ignoreList []string, opts ProcessOptions) (map[string]FileStamp, error) {
+	stamps := map[string]FileStamp{}
+	var repo GitRepo
+	if err := processRepository(ctx, repoPath, includeList, ignoreList, &repo, walkOptions{ProcessOptions: opts, stamps: stamps}); err != nil {
+		return nil, fmt.Errorf("error processing repository: %w", err)
+	}
+	return stamps, nil
+}
+
+// RepoDiff lists the files that differ between two snapshots of a repository.
+type RepoDiff struct {
+	Added    []string
+	Modified []string
+	Removed  []string
+}
+
+// Empty reports whether the snapshots contain the same files.
+func (d RepoDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Modified) == 0 && len(d.Removed) == 0
+}
+
+// DiffRepos compares the files of two snapshots by path and contents.
+func DiffRepos(old, new *GitRepo) RepoDiff {
+	var diff RepoDiff
+	before := map[string]string{}
+	for _, file := range old.Files {
+		before[file.Path] = file.Contents
+	}
+	for _, file := range new.Files {
+		contents, ok := before[file.Path]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, file.Path)
+		case contents != file.Contents:
+			diff.Modified = append(diff.Modified, file.Path)
+		}
+		delete(before, file.Path)
+	}
+	for _, file := range old.Files {
+		if _, ok := before[file.Path]; ok {
+			diff.Removed = append(diff.Removed, file.Path)
+		}
+	}
+	return diff
+}
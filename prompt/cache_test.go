@@ -0,0 +1,69 @@
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenCacheReusesUnchangedFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	unchanged := filepath.Join(tempDir, "unchanged.txt")
+	changed := filepath.Join(tempDir, "changed.txt")
+	if err := os.WriteFile(unchanged, []byte("same"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(changed, []byte("before"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewTokenCache()
+	first, err := ProcessGitRepoCached(tempDir, nil, nil, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Poison the cached entry: a cache hit must return it instead of the file.
+	info, _ := os.Stat(unchanged)
+	entry := cache.files[unchanged]
+	entry.file.Tokens = 12345
+	cache.store(unchanged, info, entry.file)
+
+	if err := os.WriteFile(changed, []byte("after!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(changed, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "added.txt"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := ProcessGitRepoCached(tempDir, nil, nil, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range second.Files {
+		switch file.Path {
+		case "unchanged.txt":
+			if file.Tokens != 12345 {
+				t.Errorf("unchanged file was re-read")
+			}
+		case "changed.txt":
+			if file.Contents != "after!" {
+				t.Errorf("changed file served from cache: %q", file.Contents)
+			}
+		}
+	}
+
+	diff := DiffRepos(first, second)
+	if strings.Join(diff.Added, ",") != "added.txt" || strings.Join(diff.Modified, ",") != "changed.txt" || len(diff.Removed) != 0 {
+		t.Errorf("unexpected diff: %+v", diff)
+	}
+	if !DiffRepos(second, second).Empty() {
+		t.Errorf("diff of identical snapshots is not empty")
+	}
+}
@@ -0,0 +1,267 @@
+package prompt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Chunk is a piece of a file sized for retrieval and embedding pipelines.
+type Chunk struct {
+	ID        string `json:"id"`   // stable for the same path and contents
+	Path      string `json:"path"` // slash separated, relative to the repository
+	Language  string `json:"language,omitempty"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Tokens    int64  `json:"tokens"`
+	Hash      string `json:"hash"` // SHA-256 of Content
+	Commit    string `json:"commit,omitempty"`
+	Content   string `json:"content"`
+}
+
+// ChunkOptions controls how files are split into chunks.
+type ChunkOptions struct {
+	MaxTokens int64 // upper bound for a chunk, unless a single line is longer
+	Overlap   int64 // tokens of the previous chunk repeated at the start of the next
+	Tokenizer Tokenizer
+}
+
+// DefaultChunkOptions are the sizes used by git2gpt chunks.
+var DefaultChunkOptions = ChunkOptions{MaxTokens: 512, Overlap: 64}
+
+// ChunkRepo splits every file of repo into chunks. Files read from a git
+// repository are tagged with its current commit.
+func ChunkRepo(repo *GitRepo, opts ChunkOptions) ([]Chunk, error) {
+	if opts.MaxTokens <= 0 {
+		return nil, fmt.Errorf("the maximum chunk size must be positive")
+	}
+	if opts.Overlap < 0 || opts.Overlap >= opts.MaxTokens {
+		return nil, fmt.Errorf("the overlap must be at least 0 and smaller than the maximum chunk size")
+	}
+	commits := map[string]string{}
+	var chunks []Chunk
+	for _, file := range repo.Files {
+		commit, ok := commits[file.Root]
+		if !ok && file.Root != "" {
+			commit = LoadRepoInfo(file.Root).Commit
+			commits[file.Root] = commit
+		}
+		for _, chunk := range ChunkFile(file, opts) {
+			chunk.Commit = commit
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks, nil
+}
+
+// ChunkFile splits a file on syntactic boundaries: top-level declarations
+// for languages with an outliner, blank-line separated paragraphs otherwise.
+// Pieces are packed into chunks of at most opts.MaxTokens.
+func ChunkFile(file GitFile, opts ChunkOptions) []Chunk {
+	if file.Contents == "" {
+		return nil
+	}
+	tok := opts.Tokenizer
+	if tok == nil {
+		tok = DefaultTokenizer
+	}
+	lines := strings.Split(strings.TrimSuffix(file.Contents, "\n"), "\n")
+	lineTokens := make([]int64, len(lines))
+	for i, line := range lines {
+		lineTokens[i] = estimateLineTokens(tok, line)
+	}
+	language := Language(file.Path)
+	var boundaries []int
+	if outline, ok := outliners[language]; ok {
+		boundaries = outline(file.Contents, lines)
+	}
+	if boundaries == nil {
+		boundaries = paragraphBoundaries(lines)
+	}
+
+	// Units are the line ranges between boundaries; [start, end) with
+	// zero-based line indexes.
+	type span struct{ start, end int }
+	var units []span
+	for i, b := range boundaries {
+		end := len(lines)
+		if i+1 < len(boundaries) {
+			end = boundaries[i+1]
+		}
+		units = append(units, span{b, end})
+	}
+	sum := func(s span) int64 {
+		var n int64
+		for i := s.start; i < s.end; i++ {
+			n += lineTokens[i]
+		}
+		return n
+	}
+
+	// Pack units into chunks, splitting units that are too large by lines.
+	var spans []span
+	current := span{-1, -1}
+	var size int64
+	add := func(s span) {
+		n := sum(s)
+		if current.start >= 0 && size+n > opts.MaxTokens {
+			spans = append(spans, current)
+			current = span{-1, -1}
+		}
+		if current.start < 0 {
+			current, size = s, 0
+			// Repeat the end of the previous chunk, within the overlap and
+			// without growing past the maximum or swallowing that chunk.
+			for opts.Overlap > 0 && len(spans) > 0 && current.start > spans[len(spans)-1].start+1 {
+				next := lineTokens[current.start-1]
+				if size+next > opts.Overlap || size+next+n > opts.MaxTokens {
+					break
+				}
+				current.start--
+				size += next
+			}
+		} else {
+			current.end = s.end
+		}
+		size += n
+	}
+	for _, u := range units {
+		if sum(u) <= opts.MaxTokens {
+			add(u)
+			continue
+		}
+		for i := u.start; i < u.end; i++ {
+			add(span{i, i + 1})
+		}
+	}
+	if current.start >= 0 {
+		spans = append(spans, current)
+	}
+
+	path := filepath.ToSlash(file.Path)
+	seen := map[string]int{}
+	chunks := make([]Chunk, 0, len(spans))
+	for _, s := range spans {
+		content := strings.Join(lines[s.start:s.end], "\n")
+		digest := sha256.Sum256([]byte(content))
+		hash := hex.EncodeToString(digest[:])
+		// Identical chunks of one file are told apart by their occurrence.
+		idSum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d", path, hash, seen[hash])))
+		seen[hash]++
+		chunks = append(chunks, Chunk{
+			ID:        hex.EncodeToString(idSum[:8]),
+			Path:      path,
+			Language:  language,
+			StartLine: s.start + 1,
+			EndLine:   s.end,
+			Tokens:    countTokens(tok, content),
+			Hash:      hash,
+			Content:   content,
+		})
+	}
+	return chunks
+}
+
+// estimateLineTokens counts the tokens of a line plus its newline. Lines are
+// counted one at a time, so failures fall back to an estimate of four bytes
+// per token instead of being reported for every line.
+func estimateLineTokens(tok Tokenizer, line string) int64 {
+	n, err := tok.CountTokens(line + "\n")
+	if err != nil {
+		return int64(len(line)+4) / 4
+	}
+	return n
+}
+
+// Language returns the name of the language of a file from its extension,
+// or "" if it is not known.
+func Language(path string) string {
+	return languages[strings.ToLower(filepath.Ext(path))]
+}
+
+// An outliner returns the zero-based indexes of the lines where top-level
+// declarations start, always including 0, or nil if the file cannot be
+// outlined.
+type outliner func(contents string, lines []string) []int
+
+var outliners = map[string]outliner{
+	"Go":         outlineGo,
+	"Python":     outlineByPattern(regexp.MustCompile(`^(?:async\s+def|def|class)\s`), "@", "#"),
+	"JavaScript": outlineByPattern(jsDeclPattern, "@", "//"),
+	"TypeScript": outlineByPattern(jsDeclPattern, "@", "//"),
+}
+
+var jsDeclPattern = regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:async\s+)?(?:function\b|class\b|(?:const|let|var)\s+\w+\s*=\s*(?:async\s+)?(?:function\b|\())`)
+
+// outlineGo starts a unit at every top-level declaration, including its doc
+// comment.
+func outlineGo(contents string, lines []string) []int {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", contents, parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+	starts := map[int]bool{0: true}
+	for _, decl := range f.Decls {
+		pos := decl.Pos()
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Doc != nil {
+				pos = d.Doc.Pos()
+			}
+		case *ast.GenDecl:
+			if d.Doc != nil {
+				pos = d.Doc.Pos()
+			}
+		}
+		starts[fset.Position(pos).Line-1] = true
+	}
+	return sortedLines(starts)
+}
+
+// outlineByPattern starts a unit at every unindented line matching decl,
+// moving up over the decorators and comments directly above it.
+func outlineByPattern(decl *regexp.Regexp, decorator, comment string) outliner {
+	return func(contents string, lines []string) []int {
+		starts := map[int]bool{0: true}
+		for i, line := range lines {
+			if !decl.MatchString(line) {
+				continue
+			}
+			start := i
+			for start > 0 && (strings.HasPrefix(lines[start-1], decorator) || strings.HasPrefix(lines[start-1], comment)) {
+				start--
+			}
+			starts[start] = true
+		}
+		return sortedLines(starts)
+	}
+}
+
+// paragraphBoundaries starts a unit at every non-blank line that follows a
+// blank one.
+func paragraphBoundaries(lines []string) []int {
+	starts := []int{0}
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) != "" && strings.TrimSpace(lines[i-1]) == "" {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+func sortedLines(set map[int]bool) []int {
+	lines := make([]int, 0, len(set))
+	for line := range set {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
@@ -0,0 +1,106 @@
+package prompt
+
+import (
+	"strings"
+	"testing"
+)
+
+const chunkSource = `package main
+
+import "fmt"
+
+// greet says hello to
+// the given name.
+func greet(name string) {
+	fmt.Println("hello", name)
+}
+
+func main() {
+	greet("world")
+}
+`
+
+func TestChunkGo(t *testing.T) {
+	opts := ChunkOptions{MaxTokens: 18, Tokenizer: wordTokenizer{}}
+	chunks := ChunkFile(GitFile{Path: "main.go", Contents: chunkSource}, opts)
+	var ranges []string
+	for _, c := range chunks {
+		ranges = append(ranges, strings.SplitN(c.Content, "\n", 2)[0])
+		if c.Tokens > opts.MaxTokens || c.Language != "Go" {
+			t.Errorf("chunk %+v", c)
+		}
+	}
+	// Declarations are not split, and a doc comment stays with its function.
+	want := []string{"package main", "// greet says hello to", "func main() {"}
+	if strings.Join(ranges, "|") != strings.Join(want, "|") {
+		t.Errorf("chunks start with %q, want %q", ranges, want)
+	}
+	if chunks[1].StartLine != 5 || chunks[1].EndLine != 10 {
+		t.Errorf("greet chunk spans lines %d-%d", chunks[1].StartLine, chunks[1].EndLine)
+	}
+
+	// Changing one function keeps the IDs of the other chunks.
+	again := ChunkFile(GitFile{Path: "main.go", Contents: chunkSource}, opts)
+	changed := ChunkFile(GitFile{Path: "main.go", Contents: strings.Replace(chunkSource, `"world"`, `"there"`, 1)}, opts)
+	for i := range chunks {
+		if again[i].ID != chunks[i].ID {
+			t.Errorf("chunk %d ID changed between runs", i)
+		}
+	}
+	if changed[0].ID != chunks[0].ID || changed[1].ID != chunks[1].ID || changed[2].ID == chunks[2].ID {
+		t.Error("IDs do not follow the contents of their chunks")
+	}
+}
+
+func TestChunkParagraphsAndOverlap(t *testing.T) {
+	text := "one two\nthree four\n\nfive six\nseven eight\n\nnine ten\n"
+	opts := ChunkOptions{MaxTokens: 5, Overlap: 2, Tokenizer: wordTokenizer{}}
+	chunks := ChunkFile(GitFile{Path: "notes.txt", Contents: text}, opts)
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks: %+v", len(chunks), chunks)
+	}
+	// The second chunk repeats the last line of the first, which is blank
+	// and fits, and then the line before it, which does not.
+	if chunks[1].StartLine != 3 || chunks[1].EndLine != 6 {
+		t.Errorf("second chunk spans lines %d-%d", chunks[1].StartLine, chunks[1].EndLine)
+	}
+	for _, c := range chunks {
+		if c.Tokens > opts.MaxTokens {
+			t.Errorf("chunk has %d tokens: %q", c.Tokens, c.Content)
+		}
+	}
+
+	// A paragraph larger than the maximum is split by lines.
+	long := ChunkFile(GitFile{Path: "long.txt", Contents: strings.Repeat("a b c\n", 4)}, ChunkOptions{MaxTokens: 6, Tokenizer: wordTokenizer{}})
+	if len(long) != 2 || long[0].EndLine != 2 || long[1].StartLine != 3 {
+		t.Errorf("long paragraph chunks: %+v", long)
+	}
+
+	if _, err := ChunkRepo(&GitRepo{}, ChunkOptions{MaxTokens: 4, Overlap: 4}); err == nil {
+		t.Error("overlap as large as the maximum was accepted")
+	}
+}
+
+func TestSplitRepo(t *testing.T) {
+	repo := &GitRepo{Files: []GitFile{
+		{Path: "a.txt", Contents: "a b c", Tokens: 3},
+		{Path: "b.txt", Contents: "d e", Tokens: 2},
+		{Path: "big.txt", Contents: "one two three\n\nfour five six\n", Tokens: 6},
+	}}
+	batches := splitRepo(repo, 5, wordTokenizer{})
+	var got []string
+	for _, batch := range batches {
+		var paths []string
+		for _, file := range batch.Files {
+			paths = append(paths, file.Path)
+		}
+		got = append(got, strings.Join(paths, "+"))
+	}
+	want := "a.txt+b.txt|big.txt (lines 1-2)|big.txt (lines 3-3)"
+	if strings.Join(got, "|") != want {
+		t.Errorf("batches = %q, want %q", got, want)
+	}
+	if !batches[1].Files[0].Partial {
+		t.Error("piece of a split file is not marked partial")
+	}
+}
@@ -0,0 +1,198 @@
+package prompt
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// fileIDAlphabet is Crockford's base 32 in lower case, which leaves out
+// letters that are easily mistaken for digits.
+const fileIDAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+// fileIDLength is the number of base 32 digits of a file ID that does not
+// collide with another.
+const fileIDLength = 4
+
+var fileIDEncoding = base32.NewEncoding(fileIDAlphabet).WithPadding(base32.NoPadding)
+
+// AssignFileIDs gives every file of repo a short ID derived from its path,
+// such as F3kq9, so a file keeps its ID when the output is generated again
+// with other files. IDs are the letter F and the first four base 32 digits
+// of a hash of the path, extended by as many digits as needed to tell files
+// apart whose digits collide. Files with the same path in different
+// repositories are told apart by their root as well. Citations are resolved
+// with the manifest saved for the output; see NewManifest.
+func AssignFileIDs(repo *GitRepo) {
+	paths := map[string]int{}
+	for _, file := range repo.Files {
+		paths[filepath.ToSlash(file.Path)]++
+	}
+	digests := make([]string, len(repo.Files))
+	for i, file := range repo.Files {
+		key := filepath.ToSlash(file.Path)
+		if paths[key] > 1 {
+			key = file.Root + "\x00" + key
+		}
+		sum := sha256.Sum256([]byte(key))
+		digests[i] = fileIDEncoding.EncodeToString(sum[:])
+	}
+	for i := range repo.Files {
+		n := fileIDLength
+		for j := range digests {
+			for j != i && n < len(digests[i]) && digests[j][:n] == digests[i][:n] {
+				n++
+			}
+		}
+		repo.Files[i].ID = "F" + digests[i][:n]
+	}
+}
+
+// NumberLines prefixes every line of every file with its line number, in the
+// format used by excerpts. Excerpted files already carry line numbers and
+// are left alone. Token counts are updated.
+func NumberLines(repo *GitRepo) {
+	NumberLinesWith(repo, DefaultTokenizer)
+}
+
+// NumberLinesWith is NumberLines counting tokens with tok.
+func NumberLinesWith(repo *GitRepo, tok Tokenizer) {
+	for i := range repo.Files {
+		file := &repo.Files[i]
+		if file.Partial || file.Contents == "" {
+			continue
+		}
+		lines := strings.Split(strings.TrimSuffix(file.Contents, "\n"), "\n")
+		width := len(strconv.Itoa(len(lines)))
+		var b strings.Builder
+		for n, line := range lines {
+			fmt.Fprintf(&b, "%*d: %s\n", width, n+1, line)
+		}
+		file.Contents = strings.TrimSuffix(b.String(), "\n")
+		file.Tokens = countTokens(tok, file.Contents)
+		file.lineNumbers = true
+	}
+}
+
+// ManifestSuffix is appended to the output file name to name its manifest.
+const ManifestSuffix = ".manifest.json"
+
+// Manifest records where the files of an output came from and what was sent
+// of them, so citations such as F3kq9:L30 can be mapped back to real paths and
+// the tree can later be checked against it with VerifyManifest.
+type Manifest struct {
+	Digest string         `json:"digest"` // see SnapshotDigest
+	Files  []ManifestFile `json:"files"`
+}
+
+// ManifestFile describes one file of the output.
+type ManifestFile struct {
+	ID     string `json:"id,omitempty"`
+	Path   string `json:"path"`            // relative to Root
+	Root   string `json:"root"`            // absolute path of the repository or bundle
+	Ref    string `json:"ref,omitempty"`   // commit the file was read from, for bare repositories, bundles and --ref
+	Lines  int    `json:"lines,omitempty"` // zero for excerpts
+	Size   int64  `json:"size"`            // of the file as read, before any transform
+	SHA256 string `json:"sha256"`          // of the file as read
+	Tokens int64  `json:"tokens"`          // of the contents that were sent
+	// Transforms names what was done to the file before sending it, such as
+	// TransformLineNumbers.
+	Transforms []string `json:"transforms,omitempty"`
+}
+
+// NewManifest describes the files of repo, in output order.
+func NewManifest(repo *GitRepo) *Manifest {
+	return NewRenderedManifest(repo, false)
+}
+
+// NewRenderedManifest is NewManifest for output rendered with scrubComments,
+// which scrubs comments while rendering rather than changing the files.
+func NewRenderedManifest(repo *GitRepo, scrubComments bool) *Manifest {
+	m := &Manifest{Files: []ManifestFile{}}
+	for _, file := range repo.Files {
+		entry := ManifestFile{ID: file.ID, Path: filepath.ToSlash(file.Path), Root: file.Root, Ref: file.Ref, Tokens: file.Tokens}
+		if !file.Partial && file.Contents != "" {
+			entry.Lines = strings.Count(strings.TrimSuffix(file.Contents, "\n"), "\n") + 1
+		}
+		entry.Size, entry.SHA256 = file.source()
+		entry.Transforms = file.transforms(scrubComments)
+		m.Files = append(m.Files, entry)
+	}
+	m.Digest = manifestDigest(m.Files)
+	return m
+}
+
+// WriteFile saves the manifest as JSON.
+func (m *Manifest) WriteFile(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling manifest: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing manifest: %w", err)
+	}
+	return nil
+}
+
+// ReadManifest loads a manifest saved by WriteFile.
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("error parsing manifest %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// Citation refers to a file of the output and optionally a range of lines.
+// Start and End are zero when no lines are given.
+type Citation struct {
+	ID         string
+	Start, End int
+}
+
+var citationPattern = regexp.MustCompile(`^(F[0-9a-z]+)(?::L?(\d+)(?:-L?(\d+))?)?$`)
+
+// ParseCitation parses citations of the forms F3kq9, F3kq9:L30 and
+// F3kq9:L30-42.
+func ParseCitation(s string) (Citation, error) {
+	m := citationPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return Citation{}, fmt.Errorf("invalid citation %q, expected a form like F3kq9:L30-42", s)
+	}
+	c := Citation{ID: m[1]}
+	if m[2] != "" {
+		c.Start, _ = strconv.Atoi(m[2])
+		c.End = c.Start
+	}
+	if m[3] != "" {
+		c.End, _ = strconv.Atoi(m[3])
+	}
+	if c.Start < 0 || c.End < c.Start || (m[2] != "" && c.Start == 0) {
+		return Citation{}, fmt.Errorf("invalid line range in citation %q", s)
+	}
+	return c, nil
+}
+
+// Resolve finds the file a citation refers to and checks its line range.
+func (m *Manifest) Resolve(c Citation) (ManifestFile, error) {
+	for _, f := range m.Files {
+		if f.ID != c.ID {
+			continue
+		}
+		if f.Lines > 0 && c.End > f.Lines {
+			return f, fmt.Errorf("%s (%s) has only %d lines", c.ID, f.Path, f.Lines)
+		}
+		return f, nil
+	}
+	return ManifestFile{}, fmt.Errorf("no file with ID %s in the manifest", c.ID)
+}
@@ -0,0 +1,124 @@
+package prompt
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCitation(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Citation
+		ok   bool
+	}{
+		{"F12", Citation{ID: "F12"}, true},
+		{"F12:L30", Citation{ID: "F12", Start: 30, End: 30}, true},
+		{"F12:L30-42", Citation{ID: "F12", Start: 30, End: 42}, true},
+		{"F3:L7-L9", Citation{ID: "F3", Start: 7, End: 9}, true},
+		{" F1:2 ", Citation{ID: "F1", Start: 2, End: 2}, true},
+		{"F3kq9:L30-42", Citation{ID: "F3kq9", Start: 30, End: 42}, true},
+		{"F3KQ9", Citation{}, false},
+		{"F12:L42-30", Citation{}, false},
+		{"F12:L0", Citation{}, false},
+		{"src/main.go:30", Citation{}, false},
+	} {
+		got, err := ParseCitation(tc.in)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("ParseCitation(%q) = %+v, %v", tc.in, got, err)
+		}
+	}
+}
+
+func TestFileIDsAndManifest(t *testing.T) {
+	repo := &GitRepo{Files: []GitFile{
+		{Path: "main.go", Root: "/repo", Contents: "package main\n\nfunc main() {}\n"},
+		{Path: filepath.Join("src", "util.go"), Root: "/repo", Contents: strings.Repeat("x\n", 10)},
+	}}
+	AssignFileIDs(repo)
+	NumberLinesWith(repo, wordTokenizer{})
+	mainID, utilID := repo.Files[0].ID, repo.Files[1].ID
+	if len(mainID) != 1+fileIDLength || len(utilID) != 1+fileIDLength || mainID == utilID {
+		t.Errorf("file IDs = %q, %q", mainID, utilID)
+	}
+	// Line numbers are counted as tokens with the tokenizer given.
+	if repo.Files[0].Tokens != 8 {
+		t.Errorf("numbered main.go has %d tokens, want 8", repo.Files[0].Tokens)
+	}
+	if want := "1: package main\n2: \n3: func main() {}"; repo.Files[0].Contents != want {
+		t.Errorf("numbered contents = %q, want %q", repo.Files[0].Contents, want)
+	}
+	if !strings.HasPrefix(repo.Files[1].Contents, " 1: x\n") {
+		t.Errorf("numbers are not aligned: %q", repo.Files[1].Contents)
+	}
+
+	output, err := renderText(context.Background(), repo, "", false, wordTokenizer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "["+mainID+"] main.go\n") || !strings.Contains(output, "F3kq9:L30-42") {
+		t.Errorf("output lacks IDs or citation instructions:\n%s", output)
+	}
+
+	path := filepath.Join(t.TempDir(), "out.txt"+ManifestSuffix)
+	if err := NewManifest(repo).WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := ReadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := manifest.Resolve(Citation{ID: utilID, Start: 3, End: 10})
+	if err != nil || file.Path != "src/util.go" || file.Root != "/repo" {
+		t.Errorf("Resolve = %+v, %v", file, err)
+	}
+	if _, err := manifest.Resolve(Citation{ID: utilID, Start: 3, End: 11}); err == nil {
+		t.Error("line past the end of the file was accepted")
+	}
+	if _, err := manifest.Resolve(Citation{ID: "F9"}); err == nil {
+		t.Error("unknown ID was accepted")
+	}
+}
+
+func TestFileIDsAreStable(t *testing.T) {
+	var files []GitFile
+	for i := 0; i < 3000; i++ {
+		files = append(files, GitFile{Path: fmt.Sprintf("pkg/file%d.go", i), Root: "/repo"})
+	}
+	repo := &GitRepo{Files: files}
+	AssignFileIDs(repo)
+	ids := map[string]string{}
+	extended := 0
+	for _, f := range repo.Files {
+		if other, ok := ids[f.ID]; ok {
+			t.Fatalf("%s and %s share the ID %s", other, f.Path, f.ID)
+		}
+		ids[f.ID] = f.Path
+		if len(f.ID) > 1+fileIDLength {
+			extended++
+		}
+	}
+	// Four digits leave room for about a million IDs, so some of 3000
+	// collide and are extended.
+	if extended == 0 {
+		t.Error("no ID was extended")
+	}
+
+	// Adding or removing files leaves the IDs of the others alone, as long
+	// as their digits do not collide with the new ones.
+	again := &GitRepo{Files: []GitFile{{Path: "new.go"}, repo.Files[7], repo.Files[2]}}
+	again.Files[1].ID, again.Files[2].ID = "", ""
+	AssignFileIDs(again)
+	if again.Files[1].ID != repo.Files[7].ID || again.Files[2].ID != repo.Files[2].ID {
+		t.Errorf("IDs changed: %q, %q; want %q, %q", again.Files[1].ID, again.Files[2].ID, repo.Files[7].ID, repo.Files[2].ID)
+	}
+
+	// The same path in two repositories gets two IDs.
+	twice := &GitRepo{Files: []GitFile{{Path: "main.go", Root: "/a"}, {Path: "main.go", Root: "/b"}}}
+	AssignFileIDs(twice)
+	if twice.Files[0].ID == twice.Files[1].ID {
+		t.Errorf("main.go in two repositories has one ID %s", twice.Files[0].ID)
+	}
+}
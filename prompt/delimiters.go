@@ -0,0 +1,214 @@
+package prompt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Delimiters are the marker lines of the plain text format. File starts each
+// file section and is followed by a line with the path, History starts the
+// commit history and End ends the repository.
+type Delimiters struct {
+	File    string
+	History string
+	End     string
+}
+
+// ClassicDelimiters are the markers git2gpt has always used. They are kept
+// whenever no included file contains one of them as a line.
+var ClassicDelimiters = Delimiters{File: "----", History: "--HISTORY--", End: "--END--"}
+
+// delimitersWithBoundary returns the markers for a boundary string, such as
+// ----[3f9a1c2e] and --END[3f9a1c2e]--. An empty boundary gives
+// ClassicDelimiters.
+func delimitersWithBoundary(boundary string) Delimiters {
+	if boundary == "" {
+		return ClassicDelimiters
+	}
+	tag := "[" + boundary + "]"
+	return Delimiters{File: "----" + tag, History: "--HISTORY" + tag + "--", End: "--END" + tag + "--"}
+}
+
+// ChooseDelimiters picks markers that cannot be confused with the contents
+// of files. The classic markers are used unless a file has a line equal to
+// one of them; then a boundary derived from the contents is added, checked
+// not to occur anywhere in them, in the manner of MIME multipart boundaries.
+// The choice depends only on the contents, so the same files always get the
+// same markers.
+func ChooseDelimiters(files []GitFile) Delimiters {
+	if !anyLineEquals(files, ClassicDelimiters) {
+		return ClassicDelimiters
+	}
+	h := sha256.New()
+	for _, file := range files {
+		h.Write([]byte(file.Contents))
+	}
+	seed := h.Sum(nil)
+	for {
+		boundary := hex.EncodeToString(seed[:4])
+		if !anyContains(files, boundary) {
+			return delimitersWithBoundary(boundary)
+		}
+		next := sha256.Sum256(seed)
+		seed = next[:]
+	}
+}
+
+// anyLineEquals reports whether a line written for one of files, from its
+// path line or its contents, equals one of the markers of d.
+func anyLineEquals(files []GitFile, d Delimiters) bool {
+	for _, file := range files {
+		for _, text := range []string{pathLine(file), file.Contents} {
+			for _, line := range strings.Split(text, "\n") {
+				line = strings.TrimSuffix(line, "\r")
+				if line == d.File || line == d.History || line == d.End {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// pathLine is the line after the file marker: the path, preceded by the
+// file ID if there is one and by the submodule and its pinned commit for
+// the files of a submodule, as in [F3kq9] [lib/sub@1a2b3c4] lib/sub/x.go.
+func pathLine(file GitFile) string {
+	line := file.Path
+	if file.Submodule != "" {
+		sub := file.Submodule
+		if file.SubmoduleCommit != "" {
+			sub += "@" + file.SubmoduleCommit
+		}
+		line = fmt.Sprintf("[%s] %s", sub, line)
+	}
+	if file.ID != "" {
+		line = fmt.Sprintf("[%s] %s", file.ID, line)
+	}
+	return line
+}
+
+func anyContains(files []GitFile, s string) bool {
+	for _, file := range files {
+		if strings.Contains(file.Contents, s) || strings.Contains(file.Path, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// describe rewrites a preamble written for the classic markers to name d.
+func (d Delimiters) describe(preamble string) string {
+	if d == ClassicDelimiters {
+		return preamble
+	}
+	return strings.NewReplacer(
+		"--END--", d.End,
+		"--HISTORY--", d.History,
+		"----", d.File,
+	).Replace(preamble)
+}
+
+// ParsedText is the plain text format taken apart by ParseText.
+type ParsedText struct {
+	Delimiters Delimiters
+	Preamble   string    // text before the first marker
+	Files      []GitFile // paths, contents and file IDs
+	History    string    // the history section without its marker, if any
+	Trailer    string    // text after the end marker, such as instructions
+}
+
+var fileMarkerPattern = regexp.MustCompile(`(?m)^----(?:\[([0-9a-f]+)\])?$`)
+var endMarkerPattern = regexp.MustCompile(`(?m)^--END(?:\[([0-9a-f]+)\])?--$`)
+var fileIDPattern = regexp.MustCompile(`^\[(F\d+)\] (.*)$`)
+
+// ParseText parses output of the plain text format back into files. The
+// markers are recognised whether or not they carry a boundary.
+func ParseText(text string) (*ParsedText, error) {
+	// The first marker line tells which boundary is in use.
+	var boundary string
+	fileLoc := fileMarkerPattern.FindStringSubmatchIndex(text)
+	endLoc := endMarkerPattern.FindStringSubmatchIndex(text)
+	switch {
+	case fileLoc != nil && (endLoc == nil || fileLoc[0] < endLoc[0]):
+		if fileLoc[2] >= 0 {
+			boundary = text[fileLoc[2]:fileLoc[3]]
+		}
+	case endLoc != nil:
+		if endLoc[2] >= 0 {
+			boundary = text[endLoc[2]:endLoc[3]]
+		}
+	default:
+		return nil, fmt.Errorf("no git2gpt markers found")
+	}
+	d := delimitersWithBoundary(boundary)
+	parsed := &ParsedText{Delimiters: d}
+
+	// Work on "\n"+text so every marker, even on the first line, is found
+	// as "\n"+marker.
+	body := "\n" + text
+	endAt := indexLine(body, d.End, 0)
+	if endAt < 0 {
+		return nil, fmt.Errorf("missing end marker %s", d.End)
+	}
+	parsed.Trailer = strings.TrimPrefix(body[endAt+1+len(d.End):], "\n")
+	body = body[:endAt+1]
+
+	historyAt := indexLine(body, d.History, 0)
+	if historyAt >= 0 {
+		parsed.History = strings.TrimPrefix(body[historyAt+1+len(d.History):], "\n")
+		body = body[:historyAt+1]
+	}
+
+	pos := indexLine(body, d.File, 0)
+	if pos < 0 {
+		parsed.Preamble = strings.TrimPrefix(body, "\n")
+		return parsed, nil
+	}
+	parsed.Preamble = body[1 : pos+1]
+	for pos >= 0 {
+		start := pos + 1 + len(d.File) + 1 // past "\n" + marker + "\n"
+		if start > len(body) {
+			return nil, fmt.Errorf("file marker without a path")
+		}
+		next := indexLine(body, d.File, start-1)
+		section := body[start:]
+		if next >= 0 {
+			section = body[start : next+1]
+		}
+		pathLine, contents, ok := strings.Cut(section, "\n")
+		if !ok {
+			return nil, fmt.Errorf("file section without contents after %q", pathLine)
+		}
+		// The writer ends every file with a newline of its own.
+		contents = strings.TrimSuffix(contents, "\n")
+		file := GitFile{Path: pathLine, Contents: contents}
+		if m := fileIDPattern.FindStringSubmatch(pathLine); m != nil {
+			file.ID, file.Path = m[1], m[2]
+		}
+		parsed.Files = append(parsed.Files, file)
+		pos = next
+	}
+	return parsed, nil
+}
+
+// indexLine returns the index of the "\n" that precedes the first line of s
+// equal to marker, searching from the "\n" at or after from. It returns -1 if
+// there is none.
+func indexLine(s, marker string, from int) int {
+	for {
+		i := strings.Index(s[from:], "\n"+marker)
+		if i < 0 {
+			return -1
+		}
+		at := from + i
+		end := at + 1 + len(marker)
+		if end == len(s) || s[end] == '\n' {
+			return at
+		}
+		from = at + 1
+	}
+}
@@ -0,0 +1,106 @@
+package prompt
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTextRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		files   []GitFile
+		history []Commit
+		classic bool
+	}{
+		{
+			name:    "plain",
+			files:   []GitFile{{Path: "main.go", Contents: "package main\n"}, {Path: "empty.txt"}},
+			classic: true,
+		},
+		{
+			name: "markdown rule",
+			files: []GitFile{
+				{Path: "README.md", Contents: "# Title\n\n----\n\ntext"},
+				{Path: "notes.md", Contents: "--END--\n--HISTORY--\n\n"},
+			},
+		},
+		{
+			name:    "history",
+			files:   []GitFile{{Path: "a.yaml", Contents: "a: 1\n---\nb: 2\n----\n", ID: "F1"}},
+			history: []Commit{{Hash: "abc1234", Author: "A <a@example.com>", Date: "2024-01-01T00:00:00Z", Message: "----\n--END--"}},
+		},
+		{
+			name:  "marker as path",
+			files: []GitFile{{Path: "--END--", Contents: "text\n"}, {Path: "main.go", Contents: "package main\n"}},
+		},
+		{
+			name:    "marker as path with file ID",
+			files:   []GitFile{{Path: "--END--", Contents: "text\n", ID: "F1"}},
+			classic: true,
+		},
+		{
+			name:  "marker with carriage return",
+			files: []GitFile{{Path: "win.txt", Contents: "----\r\nline\r\n"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &GitRepo{Files: tc.files, History: tc.history}
+			output, err := renderText(context.Background(), repo, "", false, wordTokenizer{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := ParseText(output + "\nExplain the code.")
+			if err != nil {
+				t.Fatalf("ParseText: %v\n%s", err, output)
+			}
+			if (parsed.Delimiters == ClassicDelimiters) != tc.classic {
+				t.Errorf("delimiters = %+v", parsed.Delimiters)
+			}
+			if !strings.Contains(parsed.Preamble, parsed.Delimiters.File) || !strings.Contains(parsed.Preamble, parsed.Delimiters.End) {
+				t.Errorf("preamble does not describe %+v:\n%s", parsed.Delimiters, parsed.Preamble)
+			}
+			if len(parsed.Files) != len(tc.files) {
+				t.Fatalf("parsed %d files, want %d:\n%s", len(parsed.Files), len(tc.files), output)
+			}
+			for i, want := range tc.files {
+				got := parsed.Files[i]
+				if got.Path != want.Path || got.Contents != want.Contents || got.ID != want.ID {
+					t.Errorf("file %d = %+v, want %+v", i, got, want)
+				}
+			}
+			if (parsed.History != "") != (len(tc.history) > 0) {
+				t.Errorf("history = %q", parsed.History)
+			}
+			if parsed.Trailer != "Explain the code." {
+				t.Errorf("trailer = %q", parsed.Trailer)
+			}
+		})
+	}
+}
+
+func TestChooseDelimiters(t *testing.T) {
+	files := []GitFile{{Path: "a.md", Contents: "----\n"}}
+	d := ChooseDelimiters(files)
+	if d != ChooseDelimiters(files) {
+		t.Error("delimiters are not deterministic")
+	}
+	// Put the chosen boundary into the contents; a different one is needed.
+	files = append(files, GitFile{Path: "b.md", Contents: d.File + "\n"})
+	if d2 := ChooseDelimiters(files); d2 == d || strings.Contains(files[1].Contents, d2.File) {
+		t.Errorf("boundary %q collides with the contents", d2.File)
+	}
+	// A path that breaks its line can still put a marker on a line of its own.
+	if ChooseDelimiters([]GitFile{{Path: "odd\n----", Contents: "text\n"}}) == ClassicDelimiters {
+		t.Error("a marker line in a path was missed")
+	}
+}
+
+func TestParseTextErrors(t *testing.T) {
+	if _, err := ParseText("no markers here"); err == nil {
+		t.Error("text without markers was accepted")
+	}
+	if _, err := ParseText("----\na.go\ncode\n"); err == nil {
+		t.Error("text without end marker was accepted")
+	}
+}
@@ -0,0 +1,274 @@
+package prompt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chand1012/git2gpt/utils"
+)
+
+// DefaultCacheMaxSize is the size the on-disk cache is trimmed to after a run
+// unless another limit is configured.
+const DefaultCacheMaxSize = 256 << 20
+
+// cacheFormatVersion is part of every key, so changing how entries are
+// computed or stored invalidates old entries instead of misreading them.
+const cacheFormatVersion = "1"
+
+// DiskCache persists token counts and transformed file contents between runs.
+// Entries are keyed by the SHA-256 of the input text together with the
+// tokenizer or transform that produced them, so a hit always yields exactly
+// what a cold computation would.
+type DiskCache struct {
+	dir string
+}
+
+type diskCacheEntry struct {
+	Tokens   *int64  `json:"tokens,omitempty"`
+	Contents *[]byte `json:"contents,omitempty"` // a pointer, so empty results are cached too
+}
+
+// DefaultCacheDir returns the git2gpt directory inside the user cache
+// directory.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "git2gpt"), nil
+}
+
+// OpenDiskCache opens (and creates if needed) a cache rooted at dir.
+func OpenDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error opening cache: %w", err)
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+// Dir returns the directory the cache is stored in.
+func (c *DiskCache) Dir() string {
+	return c.dir
+}
+
+// Tokenizer returns tok with its counts read from and stored in c. Rendering
+// with the returned tokenizer also caches the files scrubbed of comments. A
+// nil c returns tok unchanged, and a nil tok means DefaultTokenizer.
+func (c *DiskCache) Tokenizer(tok Tokenizer) Tokenizer {
+	if tok == nil {
+		tok = DefaultTokenizer
+	}
+	if c == nil {
+		return tok
+	}
+	return &cachedTokenizer{Tokenizer: tok, cache: c}
+}
+
+// cachedTokenizer keeps the name of the tokenizer it wraps, so in-memory
+// TokenCache entries do not depend on whether the disk cache is used.
+type cachedTokenizer struct {
+	Tokenizer
+	cache *DiskCache
+}
+
+func (t *cachedTokenizer) CountTokens(text string) (int64, error) {
+	key := cacheKey("tokens", t.Name(), text)
+	if entry, ok := t.cache.get(key); ok && entry.Tokens != nil {
+		return *entry.Tokens, nil
+	}
+	n, err := t.Tokenizer.CountTokens(text)
+	if err != nil {
+		// Failed counts are not cached, so they are retried next time.
+		return 0, err
+	}
+	t.cache.put(key, diskCacheEntry{Tokens: &n})
+	return n, nil
+}
+
+// diskCacheOf returns the cache behind a tokenizer from DiskCache.Tokenizer,
+// or nil.
+func diskCacheOf(tok Tokenizer) *DiskCache {
+	if t, ok := tok.(*cachedTokenizer); ok {
+		return t.cache
+	}
+	return nil
+}
+
+func cacheKey(kind, settings, input string) string {
+	contentHash := sha256.Sum256([]byte(input))
+	k := sha256.Sum256([]byte(strings.Join([]string{cacheFormatVersion, kind, settings, hex.EncodeToString(contentHash[:])}, "\x00")))
+	return hex.EncodeToString(k[:])
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key[2:])
+}
+
+// summaryDir holds the summaries of --summarize inside the cache directory.
+// They cost requests to a model, so pruning leaves them alone.
+const summaryDir = "summaries"
+
+func (c *DiskCache) summaryPath(key string) string {
+	return filepath.Join(c.dir, summaryDir, key[:2], key[2:])
+}
+
+func (c *DiskCache) get(key string) (diskCacheEntry, bool) {
+	if c == nil {
+		return diskCacheEntry{}, false
+	}
+	return c.read(c.path(key))
+}
+
+func (c *DiskCache) put(key string, entry diskCacheEntry) {
+	if c == nil {
+		return
+	}
+	c.write(c.path(key), entry)
+}
+
+func (c *DiskCache) getSummary(key string) (diskCacheEntry, bool) {
+	if c == nil {
+		return diskCacheEntry{}, false
+	}
+	return c.read(c.summaryPath(key))
+}
+
+func (c *DiskCache) putSummary(key string, entry diskCacheEntry) {
+	if c == nil {
+		return
+	}
+	c.write(c.summaryPath(key), entry)
+}
+
+func (c *DiskCache) read(p string) (diskCacheEntry, bool) {
+	var entry diskCacheEntry
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return entry, false
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return entry, false
+	}
+	// Refresh the modification time so pruning evicts the least recently
+	// used entries first.
+	now := time.Now()
+	os.Chtimes(p, now, now)
+	return entry, true
+}
+
+func (c *DiskCache) write(p string, entry diskCacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return
+	}
+	// Write to a temporary file and rename it into place so concurrent runs
+	// never observe a partially written entry.
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// removeComments removes code comments from contents, reusing a result
+// cached in c when one exists. A nil c scrubs without a cache.
+func removeComments(c *DiskCache, contents string) string {
+	if c == nil {
+		return utils.RemoveCodeComments(contents)
+	}
+	key := cacheKey("transform", "scrub-comments", contents)
+	if entry, ok := c.get(key); ok && entry.Contents != nil {
+		return string(*entry.Contents)
+	}
+	scrubbed := utils.RemoveCodeComments(contents)
+	data := []byte(scrubbed)
+	c.put(key, diskCacheEntry{Contents: &data})
+	return scrubbed
+}
+
+// PruneResult reports what a prune removed.
+type PruneResult struct {
+	Removed    int
+	FreedBytes int64
+	Remaining  int64
+}
+
+// Prune removes entries not used within maxAge (when positive) and then the
+// least recently used entries until the cache is no larger than maxSize
+// (when positive). Summaries are kept, and do not count towards maxSize.
+func (c *DiskCache) Prune(maxSize int64, maxAge time.Duration) (PruneResult, error) {
+	return c.prune(maxSize, maxAge, false)
+}
+
+// Clear removes every entry from the cache, summaries included.
+func (c *DiskCache) Clear() (PruneResult, error) {
+	return c.prune(0, 0, true)
+}
+
+func (c *DiskCache) prune(maxSize int64, maxAge time.Duration, all bool) (PruneResult, error) {
+	type cacheFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var result PruneResult
+	var files []cacheFile
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if !all && path == filepath.Join(c.dir, summaryDir) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, cacheFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		result.Remaining += info.Size()
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("error pruning cache: %w", err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	cutoff := time.Now().Add(-maxAge)
+	for _, f := range files {
+		expired := maxAge > 0 && f.modTime.Before(cutoff)
+		oversized := maxSize > 0 && result.Remaining > maxSize
+		if !all && !expired && !oversized {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			return result, fmt.Errorf("error pruning cache: %w", err)
+		}
+		result.Removed++
+		result.FreedBytes += f.size
+		result.Remaining -= f.size
+	}
+	return result, nil
+}
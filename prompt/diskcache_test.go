@@ -0,0 +1,180 @@
+package prompt
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chand1012/git2gpt/utils"
+)
+
+// countingTokenizer counts words like wordTokenizer and records how often it
+// was asked. With fail set, every count fails.
+type countingTokenizer struct {
+	name  string
+	calls int
+	fail  bool
+}
+
+func (t *countingTokenizer) Name() string { return t.name }
+
+func (t *countingTokenizer) CountTokens(text string) (int64, error) {
+	t.calls++
+	if t.fail {
+		return 0, errors.New("offline")
+	}
+	return int64(len(strings.Fields(text))), nil
+}
+
+func TestDiskCacheTokensAndTransforms(t *testing.T) {
+	cache, err := OpenDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inner := &countingTokenizer{name: "test"}
+	tok := cache.Tokenizer(inner)
+	if tok.Name() != "test" {
+		t.Errorf("cached tokenizer is named %q", tok.Name())
+	}
+	if n, err := tok.CountTokens("some text"); err != nil || n != 2 {
+		t.Fatalf("cold count = %d, %v", n, err)
+	}
+	if n, _ := tok.CountTokens("some text"); n != 2 || inner.calls != 1 {
+		t.Fatalf("warm count = %d after %d calls", n, inner.calls)
+	}
+	other := &countingTokenizer{name: "other-encoding"}
+	if cache.Tokenizer(other).CountTokens("some text"); other.calls != 1 {
+		t.Errorf("entries for different tokenizers were shared")
+	}
+	// Without the cache, nothing is read from it.
+	if countTokens(inner, "some text"); inner.calls != 2 {
+		t.Errorf("an uncached tokenizer read the disk cache")
+	}
+
+	// Failed counts must not be cached as zero.
+	failing := cache.Tokenizer(&countingTokenizer{name: "test", fail: true})
+	if _, err := failing.CountTokens("unreachable words"); err == nil {
+		t.Fatal("the failure of the wrapped tokenizer was lost")
+	}
+	if n, _ := tok.CountTokens("unreachable words"); n != 2 {
+		t.Errorf("failed count was cached")
+	}
+
+	code := "package main\n// comment\nfunc main() {} /* block */\n"
+	cold := utils.RemoveCodeComments(code)
+	if got := removeComments(diskCacheOf(tok), code); got != cold {
+		t.Fatalf("cache miss result differs: %q", got)
+	}
+	if got := removeComments(diskCacheOf(tok), code); got != cold {
+		t.Fatalf("cache hit result differs: %q", got)
+	}
+	empty := "// only a comment"
+	if got := removeComments(cache, empty); got != "" {
+		t.Fatalf("scrubbed comment-only file = %q", got)
+	}
+	if entry, ok := cache.get(cacheKey("transform", "scrub-comments", empty)); !ok || entry.Contents == nil || len(*entry.Contents) != 0 {
+		t.Fatalf("empty transform result was not cached")
+	}
+}
+
+// TestDiskCacheColdAndWarm reads and renders a repository twice with the
+// same cache: the second run must produce exactly the output of the first
+// without counting anything again.
+func TestDiskCacheColdAndWarm(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"main.go":     "package main\n\n// main does nothing.\nfunc main() {}\n",
+		"lib/util.go": "package lib\n\n/* Util is a helper. */\nfunc Util() int { return 1 }\n",
+		"README.md":   "A small repository.\n",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cache, err := OpenDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(format string) (string, int) {
+		inner := &countingTokenizer{name: "test:words"}
+		tok := cache.Tokenizer(inner)
+		repo, err := ProcessGitRepoContext(context.Background(), dir, nil, nil, ProcessOptions{Tokenizer: tok})
+		if err != nil {
+			t.Fatal(err)
+		}
+		output, err := RenderRepoWith(context.Background(), repo, format, "", true, RequestOptions{}, tok)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return output, inner.calls
+	}
+	for _, format := range []string{FormatText, FormatJSON, FormatXML, FormatAnthropic} {
+		cold, coldCalls := run(format)
+		warm, warmCalls := run(format)
+		if cold != warm {
+			t.Errorf("%s: warm output differs from cold output:\n%s\n---\n%s", format, cold, warm)
+		}
+		if format == FormatText && coldCalls == 0 {
+			t.Errorf("%s: the cold run counted nothing", format)
+		}
+		if warmCalls != 0 {
+			t.Errorf("%s: the warm run counted %d texts again", format, warmCalls)
+		}
+		uncached, err := ProcessGitRepoContext(context.Background(), dir, nil, nil, ProcessOptions{Tokenizer: wordTokenizer{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, _ := RenderRepoWith(context.Background(), uncached, format, "", true, RequestOptions{}, wordTokenizer{}); want != cold {
+			t.Errorf("%s: cached output differs from the output without a cache", format)
+		}
+	}
+}
+
+func TestDiskCachePrune(t *testing.T) {
+	cache, err := OpenDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := int64(1)
+	oldKey := cacheKey("tokens", "test", "old")
+	newKey := cacheKey("tokens", "test", "new")
+	cache.put(oldKey, diskCacheEntry{Tokens: &n})
+	cache.put(newKey, diskCacheEntry{Tokens: &n})
+	past := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(cache.path(oldKey), past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := cache.Prune(0, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Removed != 1 {
+		t.Fatalf("removed %d entries, want 1", result.Removed)
+	}
+	if _, ok := cache.get(oldKey); ok {
+		t.Errorf("expired entry survived")
+	}
+	if _, ok := cache.get(newKey); !ok {
+		t.Errorf("recent entry was removed")
+	}
+
+	if _, err := cache.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Dir(cache.path(newKey))); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.get(newKey); ok {
+		t.Errorf("entry survived Clear")
+	}
+}
@@ -0,0 +1,125 @@
+package prompt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ReadFileList reads the paths given to --files-from: one per line, or
+// separated by NUL bytes if the input contains any, as printed by
+// `git ls-files -z` or `find -print0`. Blank entries are skipped.
+func ReadFileList(r io.Reader) ([]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file list: %w", err)
+	}
+	sep := []byte("\n")
+	if bytes.IndexByte(data, 0) >= 0 {
+		sep = []byte{0}
+	}
+	var paths []string
+	for _, entry := range bytes.Split(data, sep) {
+		p := strings.TrimSuffix(string(entry), "\r")
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// ProcessFileList is ProcessGitRepoContext for an explicit list of files
+// instead of a walk of the repository. Paths are relative to repoPath, or
+// absolute paths inside it, and are read in the order given; duplicates are
+// read once. Files matching ignoreList are left out, so pass nil to read
+// every listed file. A path outside the repository, including through a
+// symbolic link, is an error regardless of the error policy.
+func ProcessFileList(ctx context.Context, repoPath string, paths, ignoreList []string, opts ProcessOptions) (*GitRepo, error) {
+	root, err := filepath.Abs(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("error processing repository: %w", err)
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, fmt.Errorf("error processing repository: %w", err)
+	}
+	m, err := newMatcher(nil, ignoreList)
+	if err != nil {
+		return nil, err
+	}
+
+	var repo GitRepo
+	walk := walkOptions{ProcessOptions: opts, cacheRoot: repoPath}
+	fsys := os.DirFS(root)
+	var progress Progress
+	seen := map[string]bool{}
+	for _, listed := range paths {
+		if err := checkCanceled(ctx, progress); err != nil {
+			return nil, err
+		}
+		rel, err := listedPath(root, realRoot, listed)
+		if err != nil {
+			return nil, err
+		}
+		if seen[rel] {
+			continue
+		}
+		seen[rel] = true
+		progress.FilesScanned++
+		if m.match(rel) {
+			err = readListedFile(fsys, rel, &repo, walk, &progress)
+		}
+		walk.report(progress)
+		if err != nil {
+			return nil, fmt.Errorf("error processing repository: %w", err)
+		}
+	}
+	repo.FileCount = len(repo.Files)
+	localizePaths(&repo, root)
+	return &repo, nil
+}
+
+// listedPath turns a path from a file list into a slash separated path
+// relative to root, refusing paths that lead outside it.
+func listedPath(root, realRoot, listed string) (string, error) {
+	outside := fmt.Errorf("%s is outside the repository %s", listed, root)
+	p := filepath.FromSlash(listed)
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(root, p)
+	}
+	rel, err := filepath.Rel(root, filepath.Clean(p))
+	if err != nil {
+		return "", outside
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", outside
+	}
+	// A symbolic link may still lead elsewhere. Files that do not exist are
+	// left for the error policy to report.
+	if real, err := filepath.EvalSymlinks(p); err == nil {
+		if real != realRoot && !strings.HasPrefix(real, realRoot+string(filepath.Separator)) {
+			return "", outside
+		}
+	}
+	return path.Clean(rel), nil
+}
+
+func readListedFile(fsys fs.FS, rel string, repo *GitRepo, opts walkOptions, progress *Progress) error {
+	info, err := fs.Stat(fsys, rel)
+	if err != nil {
+		return handleFileError(opts.OnError, repo, rel, err)
+	}
+	if info.IsDir() {
+		return handleFileError(opts.OnError, repo, rel, fmt.Errorf("%s is a directory", rel))
+	}
+	stat := func() (fs.FileInfo, error) { return info, nil }
+	return readFile(fsys, rel, stat, repo, opts, progress)
+}
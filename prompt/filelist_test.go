@@ -0,0 +1,81 @@
+package prompt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadFileList(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want []string
+	}{
+		{"a.go\nsrc/b.go\r\n\n", []string{"a.go", "src/b.go"}},
+		{"with space.txt\x00new\nline.txt\x00", []string{"with space.txt", "new\nline.txt"}},
+		{"", nil},
+	} {
+		got, err := ReadFileList(strings.NewReader(tc.in))
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ReadFileList(%q) = %q, %v; want %q", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestProcessFileList(t *testing.T) {
+	root := t.TempDir()
+	repoDir := filepath.Join(root, "repo")
+	for name, contents := range map[string]string{
+		"repo/main.go":     "package main\n",
+		"repo/src/util.go": "package src\n",
+		"repo/debug.log":   "noise\n",
+		"secret.txt":       "outside\n",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(root, "secret.txt"), filepath.Join(repoDir, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	listed := []string{"src/util.go", "./main.go", filepath.Join(repoDir, "debug.log"), "src/../main.go"}
+	repo, err := ProcessFileList(ctx, repoDir, listed, nil, ProcessOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range repo.Files {
+		paths = append(paths, filepath.ToSlash(f.Path))
+	}
+	if want := []string{"src/util.go", "main.go", "debug.log"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("files = %q, want %q", paths, want)
+	}
+
+	repo, err = ProcessFileList(ctx, repoDir, listed, []string{"*.log"}, ProcessOptions{})
+	if err != nil || repo.FileCount != 2 {
+		t.Errorf("with ignore rules: %+v, %v", repo, err)
+	}
+
+	for _, p := range []string{"../secret.txt", filepath.Join(root, "secret.txt"), "link.txt"} {
+		if _, err := ProcessFileList(ctx, repoDir, []string{p}, nil, ProcessOptions{}); err == nil {
+			t.Errorf("%s outside the repository was accepted", p)
+		}
+	}
+
+	if _, err := ProcessFileList(ctx, repoDir, []string{"missing.go"}, nil, ProcessOptions{}); err == nil {
+		t.Error("missing file did not fail")
+	}
+	repo, err = ProcessFileList(ctx, repoDir, []string{"missing.go", "src"}, nil, ProcessOptions{OnError: SkipOnError})
+	if err != nil || len(repo.Skipped) != 2 {
+		t.Errorf("skip policy: %+v, %v", repo, err)
+	}
+}
@@ -0,0 +1,110 @@
+package prompt
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// FilterByContent keeps only the files of repo whose contents match re.
+func FilterByContent(repo *GitRepo, re *regexp.Regexp) {
+	var kept []GitFile
+	for _, file := range repo.Files {
+		if re.MatchString(file.Contents) {
+			kept = append(kept, file)
+		}
+	}
+	repo.Files = kept
+	repo.FileCount = len(kept)
+}
+
+// ExcerptMatches replaces the contents of every file with the regions that
+// match re, each widened by context lines on both sides. Overlapping and
+// adjacent regions are merged, lines keep their original line numbers as a
+// prefix and gaps are marked with "...". Excerpted files are marked Partial
+// and their tokens recounted; files without a match are left unchanged.
+func ExcerptMatches(repo *GitRepo, re *regexp.Regexp, context int) {
+	excerptMatches(repo, re, context, DefaultTokenizer)
+}
+
+func excerptMatches(repo *GitRepo, re *regexp.Regexp, context int, tok Tokenizer) {
+	for i := range repo.Files {
+		file := &repo.Files[i]
+		excerpt, ok := excerpt(file.Contents, re, context)
+		if !ok {
+			continue
+		}
+		file.Contents = excerpt
+		file.Partial = true
+		file.Tokens = countTokens(tok, excerpt)
+	}
+}
+
+// lineRange is a range of zero-based line indexes, end inclusive.
+type lineRange struct {
+	start, end int
+}
+
+func excerpt(contents string, re *regexp.Regexp, context int) (string, bool) {
+	matches := re.FindAllStringIndex(contents, -1)
+	if len(matches) == 0 {
+		return "", false
+	}
+	lines := strings.Split(strings.TrimSuffix(contents, "\n"), "\n")
+	// lineStarts[i] is the byte offset at which line i begins.
+	lineStarts := make([]int, len(lines))
+	offset := 0
+	for i, line := range lines {
+		lineStarts[i] = offset
+		offset += len(line) + 1
+	}
+	lineOf := func(pos int) int {
+		lo, hi := 0, len(lineStarts)-1
+		for lo < hi {
+			mid := (lo + hi + 1) / 2
+			if lineStarts[mid] <= pos {
+				lo = mid
+			} else {
+				hi = mid - 1
+			}
+		}
+		return lo
+	}
+
+	var regions []lineRange
+	for _, m := range matches {
+		end := m[1]
+		if end > m[0] {
+			end-- // the last byte of the match
+		}
+		r := lineRange{lineOf(m[0]) - context, lineOf(end) + context}
+		if r.start < 0 {
+			r.start = 0
+		}
+		if r.end >= len(lines) {
+			r.end = len(lines) - 1
+		}
+		if n := len(regions); n > 0 && r.start <= regions[n-1].end+1 {
+			if r.end > regions[n-1].end {
+				regions[n-1].end = r.end
+			}
+			continue
+		}
+		regions = append(regions, r)
+	}
+
+	width := len(fmt.Sprint(regions[len(regions)-1].end + 1))
+	var b strings.Builder
+	for i, r := range regions {
+		if i > 0 || r.start > 0 {
+			b.WriteString("...\n")
+		}
+		for n := r.start; n <= r.end; n++ {
+			fmt.Fprintf(&b, "%*d: %s\n", width, n+1, lines[n])
+		}
+	}
+	if regions[len(regions)-1].end < len(lines)-1 {
+		b.WriteString("...\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n"), true
+}
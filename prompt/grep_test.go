@@ -0,0 +1,52 @@
+package prompt
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestExcerptMatches(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 12; i++ {
+		lines = append(lines, "line")
+	}
+	lines[2] = "call target()"  // line 3
+	lines[4] = "target = 1"     // line 5, overlaps with line 3's context
+	lines[10] = "return target" // line 11
+	repo := &GitRepo{Files: []GitFile{
+		{Path: "a.go", Contents: strings.Join(lines, "\n") + "\n"},
+		{Path: "b.go", Contents: "nothing here\n"},
+	}}
+	re := regexp.MustCompile(`target`)
+
+	FilterByContent(repo, re)
+	if repo.FileCount != 1 || repo.Files[0].Path != "a.go" {
+		t.Fatalf("FilterByContent kept %+v", repo.Files)
+	}
+	ExcerptMatches(repo, re, 1)
+	want := strings.Join([]string{
+		"...",
+		" 2: line",
+		" 3: call target()",
+		" 4: line",
+		" 5: target = 1",
+		" 6: line",
+		"...",
+		"10: line",
+		"11: return target",
+		"12: line",
+	}, "\n")
+	if got := repo.Files[0].Contents; got != want {
+		t.Errorf("excerpt:\n%s\nwant:\n%s", got, want)
+	}
+	if !repo.Files[0].Partial {
+		t.Error("excerpted file is not marked partial")
+	}
+
+	// A match spanning lines covers all of them; context 0 adds nothing.
+	got, _ := excerpt("a\nb\nc\nd\n", regexp.MustCompile(`b\nc`), 0)
+	if got != "...\n2: b\n3: c\n..." {
+		t.Errorf("multi-line excerpt = %q", got)
+	}
+}
@@ -0,0 +1,181 @@
+package prompt
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chand1012/git2gpt/git"
+)
+
+// Commit is a single entry of the repository history appended to the output.
+type Commit struct {
+	Hash    string   `json:"hash" xml:"hash"`
+	Author  string   `json:"author" xml:"author"`
+	Date    string   `json:"date" xml:"date"`
+	Message string   `json:"message" xml:"message"`
+	Files   []string `json:"files" xml:"files>file"` // files touched by the commit, relative to the repository root
+}
+
+// HistoryOptions controls which history is attached to a GitRepo.
+type HistoryOptions struct {
+	Count        int    // number of commits to list; 0 disables the history section
+	OnlyIncluded bool   // only list commits and files that are part of the output
+	FileCommits  bool   // record the last commit that modified each file
+	Rev          string // start the history at this branch, tag or commit instead of HEAD
+}
+
+// LoadHistory reads the history of the git repository containing repoPath and
+// attaches it to repo. It reads the .git directory directly, so no git binary
+// is needed.
+func LoadHistory(repoPath string, repo *GitRepo, opts HistoryOptions) error {
+	if opts.Count <= 0 && !opts.FileCommits {
+		return nil
+	}
+	gitRepo, prefix, err := git.Discover(repoPath)
+	if err != nil {
+		return fmt.Errorf("error reading git history: %w", err)
+	}
+	defer gitRepo.Close()
+	rev := opts.Rev
+	if rev == "" {
+		rev = "HEAD"
+	}
+	head, err := gitRepo.ResolveRef(rev)
+	if err != nil {
+		return fmt.Errorf("error reading git history: %w", err)
+	}
+
+	included := map[string]int{}
+	for i, file := range repo.Files {
+		included[filepath.ToSlash(file.Path)] = i
+	}
+	// The walk goes on until every file has its last commit. Only files in
+	// the starting commit are waited for: no commit touches an untracked or
+	// new file, so waiting for one would walk the whole history.
+	tracked := map[int]bool{}
+	if opts.FileCommits {
+		start, err := gitRepo.Commit(head)
+		if err != nil {
+			return fmt.Errorf("error reading git history: %w", err)
+		}
+		for i, file := range repo.Files {
+			entry, err := gitRepo.TreeEntryAt(start.Tree, path.Join(prefix, filepath.ToSlash(file.Path)))
+			if err == nil && !entry.IsTree() {
+				tracked[i] = true
+			}
+		}
+	}
+	pending := len(tracked)
+
+	var walkErr error
+	err = gitRepo.WalkHistory(head, func(c *git.Commit) bool {
+		var parentTree git.Hash
+		if len(c.Parents) > 0 {
+			parent, err := gitRepo.Commit(c.Parents[0])
+			if err != nil {
+				walkErr = err
+				return false
+			}
+			parentTree = parent.Tree
+		}
+		changed, err := gitRepo.ChangedPaths(parentTree, c.Tree)
+		if err != nil {
+			walkErr = err
+			return false
+		}
+		var files []string
+		for _, p := range changed {
+			rel, ok := relativeToPrefix(p, prefix)
+			if !ok {
+				continue
+			}
+			i, isIncluded := included[rel]
+			if isIncluded && tracked[i] && repo.Files[i].LastCommit == "" {
+				repo.Files[i].LastCommit = c.Hash.Short()
+				pending--
+			}
+			if opts.OnlyIncluded && !isIncluded {
+				continue
+			}
+			files = append(files, rel)
+		}
+		if len(repo.History) < opts.Count && (len(files) > 0 || (!opts.OnlyIncluded && prefix == "")) {
+			repo.History = append(repo.History, newCommit(c, files))
+		}
+		return len(repo.History) < opts.Count || pending > 0
+	})
+	if err == nil {
+		err = walkErr
+	}
+	if err != nil {
+		return fmt.Errorf("error reading git history: %w", err)
+	}
+	return nil
+}
+
+// relativeToPrefix converts a path relative to the working tree root into one
+// relative to the processed directory.
+func relativeToPrefix(p, prefix string) (string, bool) {
+	if prefix == "" {
+		return p, true
+	}
+	if !strings.HasPrefix(p, prefix+"/") {
+		return "", false
+	}
+	return path.Clean(strings.TrimPrefix(p, prefix+"/")), true
+}
+
+func newCommit(c *git.Commit, files []string) Commit {
+	return Commit{
+		Hash:    c.Hash.Short(),
+		Author:  fmt.Sprintf("%s <%s>", c.Author.Name, c.Author.Email),
+		Date:    c.Author.When.Format(time.RFC3339),
+		Message: strings.TrimSpace(c.Message),
+		Files:   files,
+	}
+}
+
+// writeHistory writes the history section of the plain text output. Every
+// line of a commit has a prefix, so none can be taken for a marker.
+func writeHistory(b *strings.Builder, history []Commit, delims Delimiters) {
+	b.WriteString(delims.History + "\n")
+	writeCommits(b, history)
+}
+
+// writeCommits writes the commits of the history section.
+func writeCommits(b *strings.Builder, history []Commit) {
+	for _, c := range history {
+		b.WriteString(fmt.Sprintf("commit %s\n", c.Hash))
+		b.WriteString(fmt.Sprintf("Author: %s\n", c.Author))
+		b.WriteString(fmt.Sprintf("Date: %s\n", c.Date))
+		for _, line := range strings.Split(c.Message, "\n") {
+			b.WriteString(fmt.Sprintf("    %s\n", line))
+		}
+		if len(c.Files) > 0 {
+			b.WriteString(fmt.Sprintf("Files: %s\n", strings.Join(c.Files, ", ")))
+		}
+		b.WriteString("\n")
+	}
+}
+
+// writeHistoryXML writes the history element of the XML output.
+func writeHistoryXML(b *strings.Builder, history []Commit) {
+	b.WriteString("    <history>\n")
+	for _, c := range history {
+		b.WriteString("        <commit>\n")
+		b.WriteString(fmt.Sprintf("            <hash>%s</hash>\n", escapeXML(c.Hash)))
+		b.WriteString(fmt.Sprintf("            <author>%s</author>\n", escapeXML(c.Author)))
+		b.WriteString(fmt.Sprintf("            <date>%s</date>\n", escapeXML(c.Date)))
+		b.WriteString(fmt.Sprintf("            <message>%s</message>\n", escapeXML(c.Message)))
+		b.WriteString("            <files>\n")
+		for _, f := range c.Files {
+			b.WriteString(fmt.Sprintf("                <file>%s</file>\n", escapeXML(f)))
+		}
+		b.WriteString("            </files>\n")
+		b.WriteString("        </commit>\n")
+	}
+	b.WriteString("    </history>\n")
+}
@@ -0,0 +1,150 @@
+package prompt
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeHistoryRepo builds a repository with the git binary and returns its
+// directory and the short hashes of its commits, oldest first.
+func writeHistoryRepo(t *testing.T) (string, []string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Test Author", "GIT_AUTHOR_EMAIL=author@example.com",
+			"GIT_COMMITTER_NAME=Test Author", "GIT_COMMITTER_EMAIL=author@example.com",
+			"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir,
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	var hashes []string
+	commit := func(message string, files map[string]string) {
+		for name, contents := range files {
+			p := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		git("add", ".")
+		git("commit", "-q", "-m", message)
+		hashes = append(hashes, git("rev-parse", "--short=7", "HEAD"))
+	}
+	git("init", "-q")
+	commit("add docs", map[string]string{"README.md": "readme\n", "docs/guide.md": "guide\n"})
+	commit("add app", map[string]string{"app/main.go": "package main\n", "app/util.go": "package main\n"})
+	commit("touch readme", map[string]string{"README.md": "readme\nmore\n"})
+	commit("change main", map[string]string{"app/main.go": "package main\n\nfunc main() {}\n"})
+	commit("edit guide", map[string]string{"docs/guide.md": "guide\nmore\n"})
+	return dir, hashes
+}
+
+func historySummary(history []Commit) []string {
+	var lines []string
+	for _, c := range history {
+		lines = append(lines, c.Message+": "+strings.Join(c.Files, " "))
+	}
+	return lines
+}
+
+func TestLoadHistory(t *testing.T) {
+	dir, hashes := writeHistoryRepo(t)
+	newRepo := func() *GitRepo {
+		return &GitRepo{Files: []GitFile{{Path: "README.md"}, {Path: filepath.Join("app", "main.go")}, {Path: filepath.Join("app", "util.go")}}}
+	}
+
+	repo := newRepo()
+	if err := LoadHistory(dir, repo, HistoryOptions{Count: 3}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"edit guide: docs/guide.md", "change main: app/main.go", "touch readme: README.md"}
+	if got := historySummary(repo.History); !reflect.DeepEqual(got, want) {
+		t.Errorf("history = %q, want %q", got, want)
+	}
+	if repo.History[0].Hash != hashes[4] || repo.History[0].Author != "Test Author <author@example.com>" {
+		t.Errorf("newest commit = %+v", repo.History[0])
+	}
+	for _, f := range repo.Files {
+		if f.LastCommit != "" {
+			t.Errorf("%s has a last commit without FileCommits", f.Path)
+		}
+	}
+
+	// OnlyIncluded drops the commits and files that are not in the output.
+	repo = newRepo()
+	if err := LoadHistory(dir, repo, HistoryOptions{Count: 10, OnlyIncluded: true}); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"change main: app/main.go", "touch readme: README.md", "add app: app/main.go app/util.go", "add docs: README.md"}
+	if got := historySummary(repo.History); !reflect.DeepEqual(got, want) {
+		t.Errorf("included history = %q, want %q", got, want)
+	}
+
+	// FileCommits alone records the last commit of every file and no history.
+	repo = newRepo()
+	if err := LoadHistory(dir, repo, HistoryOptions{FileCommits: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.History) != 0 {
+		t.Errorf("history = %q without Count", historySummary(repo.History))
+	}
+	wantCommits := map[string]string{"README.md": hashes[2], "app/main.go": hashes[3], "app/util.go": hashes[1]}
+	for _, f := range repo.Files {
+		if want := wantCommits[filepath.ToSlash(f.Path)]; f.LastCommit != want {
+			t.Errorf("last commit of %s = %q, want %q", f.Path, f.LastCommit, want)
+		}
+	}
+}
+
+func TestLoadHistorySubdirectory(t *testing.T) {
+	dir, hashes := writeHistoryRepo(t)
+	repo := &GitRepo{Files: []GitFile{{Path: "main.go"}, {Path: "util.go"}}}
+	if err := LoadHistory(filepath.Join(dir, "app"), repo, HistoryOptions{Count: 10, FileCommits: true}); err != nil {
+		t.Fatal(err)
+	}
+	// Only the commits that touch the directory are listed, with paths
+	// relative to it.
+	want := []string{"change main: main.go", "add app: main.go util.go"}
+	if got := historySummary(repo.History); !reflect.DeepEqual(got, want) {
+		t.Errorf("history = %q, want %q", got, want)
+	}
+	if repo.Files[0].LastCommit != hashes[3] || repo.Files[1].LastCommit != hashes[1] {
+		t.Errorf("last commits = %q, %q, want %q, %q", repo.Files[0].LastCommit, repo.Files[1].LastCommit, hashes[3], hashes[1])
+	}
+}
+
+func TestLoadHistoryUntrackedFile(t *testing.T) {
+	dir, hashes := writeHistoryRepo(t)
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not committed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// No commit touches an untracked file, so waiting for one would walk
+	// the whole history. With the oldest commit gone, such a walk fails.
+	root := runGit(t, dir, "rev-parse", hashes[0])
+	if err := os.Remove(filepath.Join(dir, ".git", "objects", root[:2], root[2:])); err != nil {
+		t.Fatal(err)
+	}
+	repo := &GitRepo{Files: []GitFile{{Path: "README.md"}, {Path: filepath.Join("app", "main.go")}, {Path: "notes.txt"}}}
+	if err := LoadHistory(dir, repo, HistoryOptions{FileCommits: true}); err != nil {
+		t.Fatal(err)
+	}
+	if repo.Files[0].LastCommit != hashes[2] || repo.Files[1].LastCommit != hashes[3] || repo.Files[2].LastCommit != "" {
+		t.Errorf("last commits = %q, %q, %q", repo.Files[0].LastCommit, repo.Files[1].LastCommit, repo.Files[2].LastCommit)
+	}
+}
@@ -0,0 +1,245 @@
+package prompt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Transforms recorded in the manifest, naming what was done to a file
+// between reading it and sending it.
+const (
+	TransformScrubComments = "scrub-comments"
+	TransformLineNumbers   = "line-numbers"
+	TransformPartial       = "partial" // only excerpts or a piece of the file were sent
+	TransformSummary       = "summary"
+	TransformSymlink       = "symlink" // the link target was sent instead of the file
+)
+
+// setSource records the size and SHA-256 of data, which file was read from.
+func (f *GitFile) setSource(data []byte) {
+	sum := sha256.Sum256(data)
+	f.sourceSize = int64(len(data))
+	f.sourceSHA256 = hex.EncodeToString(sum[:])
+}
+
+// source returns the size and SHA-256 of the data file was read from. Files
+// built by hand, rather than read, are described by their contents.
+func (f GitFile) source() (int64, string) {
+	if f.sourceSHA256 != "" {
+		return f.sourceSize, f.sourceSHA256
+	}
+	sum := sha256.Sum256([]byte(f.Contents))
+	return int64(len(f.Contents)), hex.EncodeToString(sum[:])
+}
+
+// transforms lists the transforms applied to file. Comments are scrubbed
+// while rendering, so that one is given by scrubComments.
+func (f GitFile) transforms(scrubComments bool) []string {
+	var transforms []string
+	if f.Symlink != "" {
+		transforms = append(transforms, TransformSymlink)
+	}
+	if f.Summary {
+		transforms = append(transforms, TransformSummary)
+	}
+	if f.Partial {
+		transforms = append(transforms, TransformPartial)
+	}
+	if f.lineNumbers {
+		transforms = append(transforms, TransformLineNumbers)
+	}
+	if scrubComments {
+		transforms = append(transforms, TransformScrubComments)
+	}
+	return transforms
+}
+
+// SnapshotDigest returns a single digest of the files of repo as rendered
+// with scrubComments: the SHA-256 of their paths, sizes, checksums and
+// transforms in output order. It does not depend on the tokenizer, the
+// format or the platform, so the same files always give the same digest.
+func SnapshotDigest(repo *GitRepo, scrubComments bool) string {
+	return NewRenderedManifest(repo, scrubComments).Digest
+}
+
+// manifestDigest computes the digest of the files of a manifest.
+func manifestDigest(files []ManifestFile) string {
+	h := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\x00%d\x00%s\x00%s\n", f.Path, f.Size, f.SHA256, strings.Join(f.Transforms, ","))
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// sortFiles puts files in path order, comparing paths one element at a time
+// the way a directory walk visits them, so the order is the same on every
+// platform however the files were gathered.
+func sortFiles(files []GitFile) {
+	sort.SliceStable(files, func(i, j int) bool {
+		return comparePaths(filepath.ToSlash(files[i].Path), filepath.ToSlash(files[j].Path)) < 0
+	})
+}
+
+func comparePaths(a, b string) int {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for k := 0; k < len(as) && k < len(bs); k++ {
+		if c := strings.Compare(as[k], bs[k]); c != 0 {
+			return c
+		}
+	}
+	return len(as) - len(bs)
+}
+
+// Mismatch is a file of a manifest that no longer matches the tree.
+type Mismatch struct {
+	Root   string // the directory, archive or repository the file was checked in
+	Path   string
+	Reason string
+}
+
+// Roots returns the repositories the files of m came from, in order of
+// first appearance.
+func (m *Manifest) Roots() []string {
+	var roots []string
+	for _, f := range m.Files {
+		if !contains(roots, f.Root) {
+			roots = append(roots, f.Root)
+		}
+	}
+	return roots
+}
+
+// VerifyManifest checks that the files listed in m are still the same: same
+// size and SHA-256. Every file is checked in the repository it came from,
+// the directory or archive recorded as its root, or the commit recorded as
+// its ref for files read from the object database. paths, if given, replace
+// the roots of m, one for each of m.Roots in the same order, for a tree that
+// was moved or copied. Files added to the trees since are not reported. A
+// manifest whose digest does not match its own files has been edited, which
+// is an error.
+func VerifyManifest(m *Manifest, paths []string) ([]Mismatch, error) {
+	if m.Digest == "" {
+		return nil, errors.New("the manifest has no checksums; it was written by an older version of git2gpt")
+	}
+	if digest := manifestDigest(m.Files); digest != m.Digest {
+		return nil, fmt.Errorf("the manifest does not match its digest %s; it was modified", m.Digest)
+	}
+	roots := m.Roots()
+	if len(paths) > 0 && len(paths) != len(roots) {
+		return nil, fmt.Errorf("the manifest covers %d repositories, %s, but %d paths were given; give one for each, in that order", len(roots), strings.Join(roots, ", "), len(paths))
+	}
+	var mismatches []Mismatch
+	for i, root := range roots {
+		path := root
+		if len(paths) > 0 {
+			path = paths[i]
+		}
+		if path == "" {
+			return nil, errors.New("the manifest does not record where its files came from; give a path")
+		}
+		var files []ManifestFile
+		for _, f := range m.Files {
+			if f.Root == root {
+				files = append(files, f)
+			}
+		}
+		found, err := verifyRoot(path, files)
+		if err != nil {
+			return nil, err
+		}
+		mismatches = append(mismatches, found...)
+	}
+	return mismatches, nil
+}
+
+// verifyRoot checks files, which all came from one repository, against the
+// directory, archive, bare repository or bundle at path. Files with a Ref are
+// read from that commit, through OpenGitTree.
+func verifyRoot(path string, files []ManifestFile) ([]Mismatch, error) {
+	var fsys fs.FS
+	onDisk := false
+	trees := map[string]*treeFS{}
+	defer func() {
+		for _, tree := range trees {
+			tree.tree.Close()
+		}
+	}()
+
+	var mismatches []Mismatch
+	for _, f := range files {
+		var data []byte
+		var err error
+		if f.Ref != "" {
+			tree, ok := trees[f.Ref]
+			if !ok {
+				t, err := OpenGitTree(path, f.Ref)
+				if err != nil {
+					return nil, err
+				}
+				tree = newTreeFS(t)
+				trees[f.Ref] = tree
+			}
+			if contains(f.Transforms, TransformSymlink) {
+				var target string
+				target, err = tree.ReadLink(f.Path)
+				data = []byte(target)
+			} else {
+				data, err = tree.ReadFile(f.Path)
+			}
+		} else {
+			if fsys == nil {
+				if fsys, onDisk, err = openVerifyFS(path); err != nil {
+					return nil, err
+				}
+			}
+			if contains(f.Transforms, TransformSymlink) && onDisk {
+				var target string
+				target, err = os.Readlink(filepath.Join(path, filepath.FromSlash(f.Path)))
+				data = []byte(filepath.ToSlash(target))
+			} else {
+				data, err = fs.ReadFile(fsys, f.Path)
+			}
+		}
+		if err != nil {
+			reason := err.Error()
+			if errors.Is(err, fs.ErrNotExist) {
+				reason = "missing"
+			}
+			mismatches = append(mismatches, Mismatch{Root: path, Path: f.Path, Reason: reason})
+			continue
+		}
+		var file GitFile
+		file.setSource(data)
+		switch {
+		case file.sourceSize != f.Size:
+			mismatches = append(mismatches, Mismatch{Root: path, Path: f.Path, Reason: fmt.Sprintf("size changed from %d to %d bytes", f.Size, file.sourceSize)})
+		case file.sourceSHA256 != f.SHA256:
+			mismatches = append(mismatches, Mismatch{Root: path, Path: f.Path, Reason: "contents changed"})
+		}
+	}
+	return mismatches, nil
+}
+
+// openVerifyFS opens the working tree or archive at path, and reports
+// whether it is on disk.
+func openVerifyFS(path string) (fs.FS, bool, error) {
+	if IsArchive(path) {
+		archive, err := OpenArchive(path, DefaultArchiveLimits)
+		return archive, false, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false, err
+	}
+	if !info.IsDir() {
+		return nil, false, fmt.Errorf("%s is neither a directory nor an archive", path)
+	}
+	return os.DirFS(path), true, nil
+}
@@ -0,0 +1,212 @@
+package prompt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestManifestDigestAndVerify(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"main.go":     "package main /* entry */\n",
+		"a.txt":       "a\n",
+		"a/b.txt":     "b\n",
+		"a-b.txt":     "ab\n",
+		"docs/x.md":   "# x\n",
+		"docs/y.md":   "# y\n",
+		"unused.json": "{}\n",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo, err := ProcessGitRepoContext(context.Background(), dir, nil, []string{"unused.json"}, ProcessOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	NumberLines(repo)
+
+	manifest := NewRenderedManifest(repo, true)
+	var paths []string
+	for _, f := range manifest.Files {
+		paths = append(paths, f.Path)
+	}
+	if want := []string{"a/b.txt", "a-b.txt", "a.txt", "docs/x.md", "docs/y.md", "main.go"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("paths = %q, want %q", paths, want)
+	}
+	main := manifest.Files[5]
+	// The checksum is of the file as read, before the line numbers.
+	sum := sha256.Sum256([]byte("package main /* entry */\n"))
+	if main.Size != 25 || main.SHA256 != hex.EncodeToString(sum[:]) || main.Lines != 1 {
+		t.Errorf("main.go = %+v", main)
+	}
+	if want := []string{TransformLineNumbers, TransformScrubComments}; !reflect.DeepEqual(main.Transforms, want) {
+		t.Errorf("transforms = %q, want %q", main.Transforms, want)
+	}
+	if NewManifest(repo).Digest == manifest.Digest {
+		t.Error("the digest does not depend on the transforms")
+	}
+
+	output, err := RenderRepo(repo, FormatJSON, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded GitRepo
+	if err := json.Unmarshal([]byte(output), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Digest != manifest.Digest || !strings.HasPrefix(decoded.Digest, "sha256:") {
+		t.Errorf("JSON digest %q, manifest digest %q", decoded.Digest, manifest.Digest)
+	}
+	if strings.Contains(decoded.Files[5].Contents, "entry") {
+		t.Errorf("JSON contents were not scrubbed: %q", decoded.Files[5].Contents)
+	}
+	output, err = RenderRepo(repo, FormatXML, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "<digest>"+manifest.Digest+"</digest>") {
+		t.Errorf("XML output lacks the digest")
+	}
+
+	path := filepath.Join(t.TempDir(), "out.txt"+ManifestSuffix)
+	if err := manifest.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ReadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mismatches, err := VerifyManifest(saved, nil); err != nil || len(mismatches) != 0 {
+		t.Fatalf("unchanged tree: %+v, %v", mismatches, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("A\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "docs", "y.md")); err != nil {
+		t.Fatal(err)
+	}
+	mismatches, err := VerifyManifest(saved, []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Mismatch{{Root: dir, Path: "a.txt", Reason: "contents changed"}, {Root: dir, Path: "docs/y.md", Reason: "missing"}}
+	if !reflect.DeepEqual(mismatches, want) {
+		t.Errorf("mismatches = %+v, want %+v", mismatches, want)
+	}
+
+	saved.Files[0].SHA256 = saved.Files[1].SHA256
+	if _, err := VerifyManifest(saved, nil); err == nil {
+		t.Error("a modified manifest was accepted")
+	}
+}
+
+func TestVerifyManifestMultipleRepositories(t *testing.T) {
+	var dirs []string
+	repo := &GitRepo{}
+	for _, files := range []map[string]string{
+		{"a.b": "first\n", "x.go": "package x\n"},
+		{"a.b": "second\n", "y.go": "package y\n"},
+	} {
+		dir := t.TempDir()
+		for name, contents := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		processed, err := ProcessGitRepoContext(context.Background(), dir, nil, nil, ProcessOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo.Files = append(repo.Files, processed.Files...)
+		dirs = append(dirs, dir)
+	}
+	manifest := NewManifest(repo)
+	if roots := manifest.Roots(); !reflect.DeepEqual(roots, dirs) {
+		t.Fatalf("roots = %q, want %q", roots, dirs)
+	}
+	if mismatches, err := VerifyManifest(manifest, nil); err != nil || len(mismatches) != 0 {
+		t.Fatalf("unchanged trees: %+v, %v", mismatches, err)
+	}
+
+	// A change in the second repository is found, although the first holds a
+	// file of the same name that did not change.
+	if err := os.WriteFile(filepath.Join(dirs[1], "a.b"), []byte("SECOND\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mismatches, err := VerifyManifest(manifest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Mismatch{{Root: dirs[1], Path: "a.b", Reason: "contents changed"}}
+	if !reflect.DeepEqual(mismatches, want) {
+		t.Errorf("mismatches = %+v, want %+v", mismatches, want)
+	}
+
+	// Copies are checked in place of the recorded roots, in order.
+	mismatches, err = VerifyManifest(manifest, []string{dirs[0], dirs[1]})
+	if err != nil || !reflect.DeepEqual(mismatches, want) {
+		t.Errorf("with paths: mismatches = %+v, %v, want %+v", mismatches, err, want)
+	}
+	if _, err := VerifyManifest(manifest, []string{dirs[0]}); err == nil {
+		t.Error("one path was accepted for a manifest of two repositories")
+	}
+}
+
+func TestVerifyManifestGitTrees(t *testing.T) {
+	dir, bare, bundle := writeTreeRepo(t)
+	head := runGit(t, dir, "rev-parse", "HEAD")
+	manifests := map[string]*Manifest{}
+	for _, path := range []string{dir, bare, bundle} {
+		repo, err := processTree(t, context.Background(), path, "HEAD", ProcessOptions{Symlinks: RecordSymlinks})
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifest := NewManifest(repo)
+		abs, _ := filepath.Abs(path)
+		for _, f := range manifest.Files {
+			if f.Root != abs || f.Ref != head {
+				t.Fatalf("%s: %s has root %q and ref %q", path, f.Path, f.Root, f.Ref)
+			}
+		}
+		if mismatches, err := VerifyManifest(manifest, nil); err != nil || len(mismatches) != 0 {
+			t.Errorf("%s: %+v, %v", path, mismatches, err)
+		}
+		manifests[path] = manifest
+	}
+
+	// Files read with a ref are checked against that commit, not the
+	// working tree, which may have moved on.
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "commit", "-q", "-a", "-m", "second")
+	if mismatches, err := VerifyManifest(manifests[dir], nil); err != nil || len(mismatches) != 0 {
+		t.Errorf("after a new commit: %+v, %v", mismatches, err)
+	}
+
+	// A bundle's manifest checks out against the bare clone of the same
+	// repository, and a file the commit lacks is missing.
+	manifest := manifests[bundle]
+	manifest.Files = append(manifest.Files, ManifestFile{Path: "gone.go", Root: manifest.Files[0].Root, Ref: head})
+	manifest.Digest = manifestDigest(manifest.Files)
+	mismatches, err := VerifyManifest(manifest, []string{bare})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Mismatch{{Root: bare, Path: "gone.go", Reason: "missing"}}; !reflect.DeepEqual(mismatches, want) {
+		t.Errorf("mismatches = %+v, want %+v", mismatches, want)
+	}
+}
@@ -0,0 +1,107 @@
+package prompt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// PatternError reports a pattern that is not a valid glob.
+type PatternError struct {
+	File    string // pattern file the pattern came from, empty if given directly
+	Line    int    // line of the pattern in File
+	Pattern string
+	Err     error
+}
+
+func (e *PatternError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("invalid pattern %q: %s", e.Pattern, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: invalid pattern %q: %s", e.File, e.Line, e.Pattern, e.Err)
+}
+
+func (e *PatternError) Unwrap() error {
+	return e.Err
+}
+
+// ValidatePatterns checks that every pattern is a valid glob. The first
+// invalid one is returned as a *PatternError.
+func ValidatePatterns(patterns []string) error {
+	_, err := compilePatterns(patterns)
+	return err
+}
+
+func compilePatterns(patterns []string) ([]glob.Glob, error) {
+	globs := make([]glob.Glob, 0, len(patterns))
+	for _, pattern := range patterns {
+		g, err := glob.Compile(pattern, '/')
+		if err != nil {
+			return nil, &PatternError{Pattern: pattern, Err: err}
+		}
+		globs = append(globs, g)
+	}
+	return globs, nil
+}
+
+// matcher decides which files are processed. Patterns are compiled once, up
+// front, instead of for every file.
+type matcher struct {
+	include []glob.Glob
+	ignore  []glob.Glob
+	// ignoredDirs holds the "dir" part of ignore patterns of the form
+	// "dir/**", which exclude everything below a directory.
+	ignoredDirs []glob.Glob
+}
+
+func newMatcher(includeList, ignoreList []string) (*matcher, error) {
+	include, err := compilePatterns(includeList)
+	if err != nil {
+		return nil, err
+	}
+	ignore, err := compilePatterns(ignoreList)
+	if err != nil {
+		return nil, err
+	}
+	m := &matcher{include: include, ignore: ignore}
+	for _, pattern := range ignoreList {
+		if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+			if g, err := glob.Compile(prefix, '/'); err == nil {
+				m.ignoredDirs = append(m.ignoredDirs, g)
+			}
+		}
+	}
+	return m, nil
+}
+
+// Determines if a file should be included in the output
+// First checks if the file matches the include list (if provided)
+// Then checks if the file is excluded by the ignore list
+func (m *matcher) match(filePath string) bool {
+	filePath = windowsToUnixPath(filePath)
+	if len(m.include) > 0 && !matchAny(m.include, filePath) {
+		return false
+	}
+	return !matchAny(m.ignore, filePath)
+}
+
+// ignored reports whether an ignore pattern matches the path itself.
+func (m *matcher) ignored(path string) bool {
+	return matchAny(m.ignore, windowsToUnixPath(path))
+}
+
+// skipDir reports whether every file below the directory is excluded by an
+// ignore pattern, so the walk need not enter it.
+func (m *matcher) skipDir(dirPath string) bool {
+	return matchAny(m.ignoredDirs, windowsToUnixPath(dirPath))
+}
+
+func matchAny(globs []glob.Glob, s string) bool {
+	for _, g := range globs {
+		if g.Match(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package prompt
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestInvalidPatternsReportFileAndLine(t *testing.T) {
+	tempDir := t.TempDir()
+	ignoreFile := filepath.Join(tempDir, ".gptignore")
+	if err := os.WriteFile(ignoreFile, []byte("# comment\n*.log\n\nsrc/[\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := LoadIgnoreList(tempDir, "", false)
+	var patternErr *PatternError
+	if !errors.As(err, &patternErr) {
+		t.Fatalf("err = %v, want a PatternError", err)
+	}
+	if patternErr.File != ignoreFile || patternErr.Line != 4 || patternErr.Pattern != "src/[" {
+		t.Errorf("unexpected error: %+v", patternErr)
+	}
+	// The lenient variant must not panic and keeps the built-in patterns.
+	if list := GenerateIgnoreList(tempDir, "", false); !contains(list, ".git/**") {
+		t.Errorf("GenerateIgnoreList = %v", list)
+	}
+	if _, err := LoadIgnoreList(tempDir, filepath.Join(tempDir, "missing"), false); err == nil {
+		t.Error("missing explicit ignore file was accepted")
+	}
+	if _, err := ProcessGitRepo(tempDir, []string{"["}, nil); !errors.As(err, &patternErr) {
+		t.Errorf("ProcessGitRepo with an invalid pattern: %v", err)
+	}
+}
+
+// brokenFS fails to open the files named in broken.
+type brokenFS struct {
+	fstest.MapFS
+	broken map[string]bool
+}
+
+func (b brokenFS) Open(name string) (fs.File, error) {
+	if b.broken[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return b.MapFS.Open(name)
+}
+
+func (b brokenFS) ReadFile(name string) ([]byte, error) {
+	if b.broken[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return b.MapFS.ReadFile(name)
+}
+
+func TestErrorPolicy(t *testing.T) {
+	fsys := brokenFS{
+		MapFS: fstest.MapFS{
+			"a.txt":      {Data: []byte("a\n")},
+			"locked.txt": {Data: []byte("secret\n")},
+			"z.txt":      {Data: []byte("z\n")},
+		},
+		broken: map[string]bool{"locked.txt": true},
+	}
+	ctx := context.Background()
+
+	if _, err := Snapshot(ctx, fsys, Options{Tokenizer: wordTokenizer{}}); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("fail policy: err = %v", err)
+	}
+	result, err := Snapshot(ctx, fsys, Options{Tokenizer: wordTokenizer{}, OnError: SkipOnError})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Repo.FileCount != 2 || len(result.Repo.Skipped) != 1 || result.Repo.Skipped[0].Path != "locked.txt" {
+		t.Errorf("skip policy: files %+v, skipped %+v", result.Repo.Files, result.Repo.Skipped)
+	}
+
+	for _, tc := range []struct {
+		in   string
+		want ErrorPolicy
+	}{{"skip", SkipOnError}, {"warn", WarnOnError}, {"fail", FailOnError}} {
+		if got, err := ParseErrorPolicy(tc.in); err != nil || got != tc.want || got.String() != tc.in {
+			t.Errorf("ParseErrorPolicy(%q) = %v, %v", tc.in, got, err)
+		}
+	}
+	if _, err := ParseErrorPolicy("ignore"); err == nil {
+		t.Error("unknown policy was accepted")
+	}
+}
@@ -0,0 +1,76 @@
+package prompt
+
+import (
+	"fmt"
+	"os"
+)
+
+// ErrorPolicy decides what happens to a selected file that cannot be read.
+type ErrorPolicy int
+
+const (
+	// FailOnError stops processing with an error. It is the default.
+	FailOnError ErrorPolicy = iota
+	// SkipOnError leaves the file out and records it in GitRepo.Skipped.
+	SkipOnError
+	// WarnOnError is SkipOnError that also prints a warning to stderr.
+	WarnOnError
+)
+
+// ParseErrorPolicy parses the values of --on-error: skip, warn or fail.
+func ParseErrorPolicy(s string) (ErrorPolicy, error) {
+	switch s {
+	case "fail", "":
+		return FailOnError, nil
+	case "skip":
+		return SkipOnError, nil
+	case "warn":
+		return WarnOnError, nil
+	}
+	return FailOnError, fmt.Errorf("unknown error policy %q, expected skip, warn or fail", s)
+}
+
+func (p ErrorPolicy) String() string {
+	switch p {
+	case SkipOnError:
+		return "skip"
+	case WarnOnError:
+		return "warn"
+	}
+	return "fail"
+}
+
+// Set parses s like ParseErrorPolicy, so an ErrorPolicy can be used as a
+// command line flag.
+func (p *ErrorPolicy) Set(s string) error {
+	policy, err := ParseErrorPolicy(s)
+	if err != nil {
+		return err
+	}
+	*p = policy
+	return nil
+}
+
+// Type names the flag type in help output.
+func (p *ErrorPolicy) Type() string {
+	return "policy"
+}
+
+// SkippedFile is a file left out because it could not be read.
+type SkippedFile struct {
+	Path   string
+	Reason string
+}
+
+// handleFileError applies policy to err, which occurred reading path. It
+// returns the error to stop with, or nil after recording the file in repo.
+func handleFileError(policy ErrorPolicy, repo *GitRepo, path string, err error) error {
+	if policy == FailOnError {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+	if policy == WarnOnError {
+		fmt.Fprintf(os.Stderr, "Warning: skipping %s: %s\n", path, err)
+	}
+	repo.Skipped = append(repo.Skipped, SkippedFile{Path: path, Reason: err.Error()})
+	return nil
+}
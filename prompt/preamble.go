@@ -0,0 +1,172 @@
+package prompt
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/chand1012/git2gpt/git"
+)
+
+// TemplateMarker is the first line of a preamble that is a template. It is
+// removed before the rest is executed; preambles without it are used as
+// they are, byte for byte.
+const TemplateMarker = "{{/* template */}}"
+
+// PreambleData is what a preamble template can refer to, for example
+// {{.Name}} at {{.Commit}}{{if .Dirty}} with local changes{{end}}. The fields
+// of the first repository are available directly; Repos lists all of them.
+type PreambleData struct {
+	RepoInfo
+	Repos      []RepoInfo
+	Generated  time.Time
+	FileCount  int
+	FileTokens int64    // tokens of the files alone, not of the whole output
+	Languages  []string // languages of the files, most files first
+	Format     string   // the default preamble, describing the markers in use
+	Delimiters Delimiters
+}
+
+// RepoInfo describes a repository the files were read from. Branch and Commit
+// are empty outside a git repository or when HEAD is detached.
+type RepoInfo struct {
+	Name   string // base name of the working tree
+	Path   string
+	Branch string
+	Commit string // short hash of HEAD
+
+	gitDir   string
+	workTree string
+	tree     git.Hash
+}
+
+// LoadRepoInfo describes the repository at path. Anything that cannot be
+// read from git is left empty.
+func LoadRepoInfo(path string) RepoInfo {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	info := RepoInfo{Name: filepath.Base(abs), Path: abs}
+	repo, prefix, err := git.Discover(abs)
+	if err != nil {
+		return info
+	}
+	defer repo.Close()
+	workTree := abs
+	if prefix != "" {
+		for range strings.Split(prefix, "/") {
+			workTree = filepath.Dir(workTree)
+		}
+	}
+	info.Name, info.gitDir = filepath.Base(workTree), repo.GitDir
+	if !repo.Bare {
+		info.workTree = workTree
+	}
+	info.Branch = repo.HeadBranch()
+	head, err := repo.Head()
+	if err != nil {
+		return info
+	}
+	info.Commit = head.Short()
+	if commit, err := repo.Commit(head); err == nil {
+		info.tree = commit.Tree
+	}
+	return info
+}
+
+// Dirty reports whether tracked files differ from HEAD. It is only worked out
+// when a template asks, since it reads every tracked file.
+func (r RepoInfo) Dirty() bool {
+	if r.tree.IsZero() || r.workTree == "" {
+		return false
+	}
+	repo, err := git.OpenGitDir(r.gitDir)
+	if err != nil {
+		return false
+	}
+	defer repo.Close()
+	modified, err := repo.ModifiedFiles(r.tree, r.workTree, 1)
+	return err == nil && len(modified) > 0
+}
+
+// now is replaced in tests.
+var now = time.Now
+
+var preambleFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// renderPreamble executes a preamble that starts with TemplateMarker. Other
+// text is returned as is, so static preambles never touch git.
+func renderPreamble(text string, repo *GitRepo, delims Delimiters) (string, error) {
+	first, rest, _ := strings.Cut(text, "\n")
+	if strings.TrimRight(first, "\r") != TemplateMarker {
+		return text, nil
+	}
+	text = rest
+	tmpl, err := template.New("preamble").Funcs(preambleFuncs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("error in preamble template: %w", err)
+	}
+	data := PreambleData{
+		Generated:  now(),
+		FileCount:  len(repo.Files),
+		Languages:  fileLanguages(repo.Files),
+		Format:     defaultPreambleText(repo, delims),
+		Delimiters: delims,
+	}
+	seen := map[string]bool{}
+	for _, file := range repo.Files {
+		data.FileTokens += file.Tokens
+		if file.Root != "" && !seen[file.Root] {
+			seen[file.Root] = true
+			data.Repos = append(data.Repos, LoadRepoInfo(file.Root))
+		}
+	}
+	if len(data.Repos) > 0 {
+		data.RepoInfo = data.Repos[0]
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("error in preamble template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// languages maps file extensions to language names for PreambleData.
+var languages = map[string]string{
+	".c": "C", ".h": "C", ".cc": "C++", ".cpp": "C++", ".hpp": "C++",
+	".cs": "C#", ".css": "CSS", ".dart": "Dart", ".ex": "Elixir", ".exs": "Elixir",
+	".go": "Go", ".html": "HTML", ".java": "Java", ".js": "JavaScript", ".jsx": "JavaScript",
+	".mjs": "JavaScript", ".kt": "Kotlin", ".lua": "Lua", ".md": "Markdown", ".php": "PHP",
+	".py": "Python", ".rb": "Ruby", ".rs": "Rust", ".scala": "Scala", ".sh": "Shell",
+	".bash": "Shell", ".sql": "SQL", ".swift": "Swift", ".ts": "TypeScript", ".tsx": "TypeScript",
+	".vue": "Vue", ".yaml": "YAML", ".yml": "YAML", ".json": "JSON", ".toml": "TOML", ".xml": "XML",
+}
+
+// fileLanguages lists the languages of files, the most common first.
+func fileLanguages(files []GitFile) []string {
+	counts := map[string]int{}
+	for _, file := range files {
+		if lang, ok := languages[strings.ToLower(filepath.Ext(file.Path))]; ok {
+			counts[lang]++
+		}
+	}
+	langs := make([]string, 0, len(counts))
+	for lang := range counts {
+		langs = append(langs, lang)
+	}
+	sort.Slice(langs, func(i, j int) bool {
+		if counts[langs[i]] != counts[langs[j]] {
+			return counts[langs[i]] > counts[langs[j]]
+		}
+		return langs[i] < langs[j]
+	})
+	return langs
+}
@@ -0,0 +1,50 @@
+package prompt
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreambleTemplate(t *testing.T) {
+	defer func(saved func() time.Time) { now = saved }(now)
+	now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	root := filepath.Join(t.TempDir(), "myproject")
+	repo := &GitRepo{Files: []GitFile{
+		{Path: "main.go", Root: root, Tokens: 10, Contents: "package main"},
+		{Path: "util.go", Root: root, Tokens: 5, Contents: "package main"},
+		{Path: "README.md", Root: root, Tokens: 2, Contents: "# Title\n----\n"},
+	}}
+	preamble := `{{/* template */}}
+{{.Name}}: {{.FileCount}} files, {{.FileTokens}} tokens, {{join .Languages ", "}}, {{.Generated.Format "2006-01-02"}}{{if .Dirty}} dirty{{end}}
+{{.Format}}`
+	output, err := renderText(context.Background(), repo, preamble, false, wordTokenizer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "myproject: 3 files, 17 tokens, Go, Markdown, 2024-05-01\n"
+	if !strings.HasPrefix(output, want) {
+		t.Errorf("output starts with %q, want %q", strings.SplitN(output, "\n", 2)[0], want)
+	}
+	// README.md forces a boundary; .Format must name it, so no note is added.
+	parsed, err := ParseText(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := parsed.Delimiters
+	if d == ClassicDelimiters || !strings.Contains(output, "begin with "+d.File+",") || strings.Contains(output, "Files begin with a line") {
+		t.Errorf("preamble does not describe %s exactly once:\n%s", d.File, output)
+	}
+
+	if _, err := renderText(context.Background(), repo, TemplateMarker+"\n{{.Nope}}", false, wordTokenizer{}); err == nil {
+		t.Error("unknown template field was accepted")
+	}
+	for _, static := range []string{"Plain preamble with {braces}.", "Write {{ name }} where the name goes.\n{{.Name}}"} {
+		if output, err := renderText(context.Background(), repo, static, false, wordTokenizer{}); err != nil || !strings.HasPrefix(output, static+"\n") {
+			t.Errorf("static preamble changed: %q, %v", output, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package prompt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Preset is a ready-made task: Preamble is added to the preamble of the text
+// output and Instructions follow the repository.
+type Preset struct {
+	Name         string `json:"-"`
+	Description  string `json:"description"`
+	Preamble     string `json:"preamble"`
+	Instructions string `json:"instructions"`
+}
+
+// builtinPresets are the presets that ship with git2gpt. Presets in the
+// config directory with the same name replace them.
+var builtinPresets = []Preset{
+	{
+		Name:         "review",
+		Description:  "review the code like a senior engineer",
+		Preamble:     "You are a senior software engineer reviewing this repository. Be specific and direct, and refer to files by path.",
+		Instructions: "Review the code above. Point out bugs, risky patterns, unclear code and missing error handling, ordered by severity, and suggest a concrete fix for each.",
+	},
+	{
+		Name:         "explain",
+		Description:  "explain how the code is organised and how it works",
+		Preamble:     "You are an experienced engineer explaining this repository to a new member of the team.",
+		Instructions: "Explain what this code does and how it is organised: the main components, how data flows between them and where to start reading. Finish with anything surprising a newcomer should know.",
+	},
+	{
+		Name:         "write-tests",
+		Description:  "write tests for untested code",
+		Preamble:     "You are a software engineer who writes thorough, maintainable tests in the style of the existing ones.",
+		Instructions: "Write tests for the code above. Follow the test framework, layout and conventions the repository already uses, cover edge cases and error paths, and say which behaviour each test checks.",
+	},
+	{
+		Name:         "document",
+		Description:  "write documentation for the code",
+		Preamble:     "You are a technical writer documenting this repository for its users and contributors.",
+		Instructions: "Write documentation for the code above: a short overview, then the public API or commands with examples. Match the tone of any existing documentation and do not describe behaviour the code does not have.",
+	},
+	{
+		Name:         "find-bugs",
+		Description:  "hunt for bugs and explain how to trigger them",
+		Preamble:     "You are a meticulous engineer hunting for bugs in this repository. Only report problems you can justify from the code.",
+		Instructions: "Find bugs in the code above, such as logic errors, off-by-one errors, race conditions, resource leaks and unhandled errors. For each, give the file, the input or sequence of events that triggers it, and a fix.",
+	},
+}
+
+// DefaultConfigDir returns the git2gpt directory inside the user config
+// directory, such as ~/.config/git2gpt on Linux.
+func DefaultConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "git2gpt"), nil
+}
+
+// PresetDir is where user presets live inside a config directory, one JSON
+// file per preset named after it, such as presets/security.json.
+func PresetDir(configDir string) string {
+	return filepath.Join(configDir, "presets")
+}
+
+// LoadPreset finds a preset by name, preferring one in configDir over the
+// built-in presets. An empty configDir only looks at the built-in ones.
+func LoadPreset(configDir, name string) (Preset, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return Preset{}, fmt.Errorf("invalid preset name %q", name)
+	}
+	if configDir != "" {
+		preset, err := readPreset(filepath.Join(PresetDir(configDir), name+".json"))
+		if err == nil {
+			return preset, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return Preset{}, err
+		}
+	}
+	for _, preset := range builtinPresets {
+		if preset.Name == name {
+			return preset, nil
+		}
+	}
+	presets, _ := Presets(configDir)
+	var names []string
+	for _, preset := range presets {
+		names = append(names, preset.Name)
+	}
+	return Preset{}, fmt.Errorf("unknown preset %q, available: %s", name, strings.Join(names, ", "))
+}
+
+// Presets lists the built-in presets and those in configDir, sorted by name.
+func Presets(configDir string) ([]Preset, error) {
+	byName := map[string]Preset{}
+	for _, preset := range builtinPresets {
+		byName[preset.Name] = preset
+	}
+	if configDir != "" {
+		paths, err := filepath.Glob(filepath.Join(PresetDir(configDir), "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			preset, err := readPreset(path)
+			if err != nil {
+				return nil, err
+			}
+			byName[preset.Name] = preset
+		}
+	}
+	presets := make([]Preset, 0, len(byName))
+	for _, preset := range byName {
+		presets = append(presets, preset)
+	}
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+	return presets, nil
+}
+
+func readPreset(path string) (Preset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Preset{}, err
+	}
+	var preset Preset
+	if err := json.Unmarshal(data, &preset); err != nil {
+		return Preset{}, fmt.Errorf("error parsing preset %s: %w", path, err)
+	}
+	preset.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+	return preset, nil
+}
+
+// Task combines a preset and a question into the guidance for the preamble
+// and the instructions that follow the repository. The question comes after
+// the preset's instructions, so it can narrow them down.
+func (p Preset) Task(question string) (guidance, instructions string) {
+	parts := []string{}
+	for _, s := range []string{p.Instructions, question} {
+		if s = strings.TrimSpace(s); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.TrimSpace(p.Preamble), strings.Join(parts, "\n\n")
+}
@@ -0,0 +1,72 @@
+package prompt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPresets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(PresetDir(dir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	custom := `{"description": "our review", "preamble": "You review for ACME.", "instructions": "Check the ACME style guide."}`
+	if err := os.WriteFile(filepath.Join(PresetDir(dir), "review.json"), []byte(custom), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(PresetDir(dir), "security.json"), []byte(`{"instructions": "Audit it."}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	preset, err := LoadPreset(dir, "review")
+	if err != nil || preset.Preamble != "You review for ACME." {
+		t.Errorf("user preset did not replace the built-in one: %+v, %v", preset, err)
+	}
+	if preset, err := LoadPreset("", "find-bugs"); err != nil || preset.Instructions == "" {
+		t.Errorf("built-in preset = %+v, %v", preset, err)
+	}
+	if _, err := LoadPreset(dir, "nope"); err == nil || !strings.Contains(err.Error(), "security") {
+		t.Errorf("unknown preset error = %v", err)
+	}
+	if _, err := LoadPreset(dir, "../review"); err == nil {
+		t.Error("preset name with a path was accepted")
+	}
+	presets, err := Presets(dir)
+	if err != nil || len(presets) != len(builtinPresets)+1 {
+		t.Errorf("Presets = %+v, %v", presets, err)
+	}
+
+	guidance, task := preset.Task("Focus on errors.")
+	if guidance != "You review for ACME." || task != "Check the ACME style guide.\n\nFocus on errors." {
+		t.Errorf("Task = %q, %q", guidance, task)
+	}
+}
+
+func TestTaskOutput(t *testing.T) {
+	repo := &GitRepo{
+		Files:    []GitFile{{Path: "main.go", Contents: "package main"}},
+		Guidance: "You are a reviewer.",
+		Task:     "Review this.",
+	}
+	output, err := renderText(context.Background(), repo, "", false, wordTokenizer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseText(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(parsed.Preamble, "You are a reviewer.\n") || parsed.Trailer != "Review this." {
+		t.Errorf("preamble %q, trailer %q", parsed.Preamble, parsed.Trailer)
+	}
+	xml, err := renderXML(context.Background(), repo, false, wordTokenizer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(xml, "<task>Review this.</task>") {
+		t.Errorf("XML lacks the task:\n%s", xml)
+	}
+}
@@ -0,0 +1,161 @@
+package prompt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ModelPrice is the input price and context window of a model.
+type ModelPrice struct {
+	Name            string  `json:"-"`
+	InputPerMillion float64 `json:"input_per_million"` // US dollars per million input tokens
+	ContextWindow   int64   `json:"context_window"`    // in tokens; 0 means unknown
+	// Encoding is the tiktoken encoding of the model: cl100k_base,
+	// o200k_base, p50k_base, p50k_edit or r50k_base. Empty means the model's
+	// own tokenizer is not available, as for Claude and Gemini; its tokens
+	// are then counted with cl100k_base and the estimate is approximate.
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// pricingEncodings are the encodings a pricing entry can name.
+var pricingEncodings = map[string]bool{
+	"cl100k_base": true,
+	"o200k_base":  true,
+	"p50k_base":   true,
+	"p50k_edit":   true,
+	"r50k_base":   true,
+}
+
+// builtinPricing is the pricing table that ships with git2gpt. Prices
+// change; entries in the pricing file with the same name replace these.
+var builtinPricing = []ModelPrice{
+	{Name: "gpt-4o", InputPerMillion: 2.50, ContextWindow: 128000, Encoding: "o200k_base"},
+	{Name: "gpt-4o-mini", InputPerMillion: 0.15, ContextWindow: 128000, Encoding: "o200k_base"},
+	{Name: "gpt-4.1", InputPerMillion: 2.00, ContextWindow: 1047576, Encoding: "o200k_base"},
+	{Name: "gpt-4.1-mini", InputPerMillion: 0.40, ContextWindow: 1047576, Encoding: "o200k_base"},
+	{Name: "o3", InputPerMillion: 2.00, ContextWindow: 200000, Encoding: "o200k_base"},
+	{Name: "o4-mini", InputPerMillion: 1.10, ContextWindow: 200000, Encoding: "o200k_base"},
+	{Name: "claude-opus-4-1", InputPerMillion: 15.00, ContextWindow: 200000},
+	{Name: "claude-sonnet-4-5", InputPerMillion: 3.00, ContextWindow: 200000},
+	{Name: "claude-haiku-4-5", InputPerMillion: 1.00, ContextWindow: 200000},
+	{Name: "gemini-2.5-pro", InputPerMillion: 1.25, ContextWindow: 1048576},
+	{Name: "gemini-2.5-flash", InputPerMillion: 0.30, ContextWindow: 1048576},
+}
+
+// PricingFile is where the user pricing table lives inside a config
+// directory: a JSON object mapping model names to their ModelPrice.
+func PricingFile(configDir string) string {
+	return filepath.Join(configDir, "pricing.json")
+}
+
+// LoadPricing returns the built-in pricing table with the entries of the
+// pricing file at path added or replaced, sorted by name. A missing file
+// leaves the built-in table as it is, unless required is set.
+func LoadPricing(path string, required bool) ([]ModelPrice, error) {
+	byName := map[string]ModelPrice{}
+	for _, price := range builtinPricing {
+		byName[price.Name] = price
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && (required || !errors.Is(err, fs.ErrNotExist)) {
+			return nil, fmt.Errorf("error reading pricing file: %w", err)
+		}
+		if err == nil {
+			var prices map[string]ModelPrice
+			if err := json.Unmarshal(data, &prices); err != nil {
+				return nil, fmt.Errorf("error parsing pricing file %s: %w", path, err)
+			}
+			for name, price := range prices {
+				if price.Encoding != "" && !pricingEncodings[price.Encoding] {
+					return nil, fmt.Errorf("error in pricing file %s: model %s has unknown encoding %q, expected one of %s", path, name, price.Encoding, strings.Join(pricingEncodingNames(), ", "))
+				}
+				price.Name = name
+				byName[name] = price
+			}
+		}
+	}
+	prices := make([]ModelPrice, 0, len(byName))
+	for _, price := range byName {
+		prices = append(prices, price)
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].Name < prices[j].Name })
+	return prices, nil
+}
+
+// pricingEncodingNames lists the keys of pricingEncodings in order.
+func pricingEncodingNames() []string {
+	names := make([]string, 0, len(pricingEncodings))
+	for name := range pricingEncodings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CostEstimate is the estimated input cost of a prompt for one model.
+type CostEstimate struct {
+	Model string `json:"model"`
+	// Encoding is the encoding Tokens were counted with.
+	Encoding string `json:"encoding"`
+	Tokens   int64  `json:"tokens"`
+	// Approximate is set when the model's own tokenizer is not available,
+	// so Tokens were counted with cl100k_base instead.
+	Approximate   bool    `json:"approximate,omitempty"`
+	InputCost     float64 `json:"input_cost_usd"`
+	ContextWindow int64   `json:"context_window,omitempty"`
+	ExceedsWindow bool    `json:"exceeds_context_window"`
+}
+
+// EstimateCosts counts the tokens of text once per encoding and prices them
+// for every model.
+func EstimateCosts(text string, prices []ModelPrice) []CostEstimate {
+	tokens := map[string]int64{}
+	estimates := make([]CostEstimate, 0, len(prices))
+	for _, price := range prices {
+		encoding := price.Encoding
+		if encoding == "" {
+			encoding = "cl100k_base"
+		}
+		n, ok := tokens[encoding]
+		if !ok {
+			n = countTokens(encodingTokenizer(encoding), text)
+			tokens[encoding] = n
+		}
+		estimates = append(estimates, CostEstimate{
+			Model:         price.Name,
+			Encoding:      encoding,
+			Tokens:        n,
+			Approximate:   price.Encoding == "",
+			InputCost:     float64(n) * price.InputPerMillion / 1e6,
+			ContextWindow: price.ContextWindow,
+			ExceedsWindow: price.ContextWindow > 0 && n > price.ContextWindow,
+		})
+	}
+	return estimates
+}
+
+var (
+	encodingTokenizersMu sync.Mutex
+	encodingTokenizers   = map[string]Tokenizer{"cl100k_base": DefaultTokenizer}
+)
+
+// encodingTokenizer returns a shared tokenizer for a tiktoken encoding, so
+// each encoding is loaded once.
+func encodingTokenizer(encoding string) Tokenizer {
+	encodingTokenizersMu.Lock()
+	defer encodingTokenizersMu.Unlock()
+	tok, ok := encodingTokenizers[encoding]
+	if !ok {
+		tok = NewTiktokenTokenizer(encoding)
+		encodingTokenizers[encoding] = tok
+	}
+	return tok
+}
@@ -0,0 +1,123 @@
+package prompt
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadPricing(t *testing.T) {
+	dir := t.TempDir()
+	prices, err := LoadPricing(PricingFile(dir), false)
+	if err != nil || len(prices) != len(builtinPricing) {
+		t.Fatalf("missing file: %d prices, %v", len(prices), err)
+	}
+	if _, err := LoadPricing(PricingFile(dir), true); err == nil {
+		t.Error("missing required file did not fail")
+	}
+
+	data := `{"gpt-4o": {"input_per_million": 1, "context_window": 5}, "local": {"input_per_million": 0.5, "encoding": "p50k_base"}}`
+	if err := os.WriteFile(PricingFile(dir), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prices, err = LoadPricing(PricingFile(dir), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]ModelPrice{}
+	for _, price := range prices {
+		byName[price.Name] = price
+	}
+	if len(prices) != len(builtinPricing)+1 || byName["gpt-4o"].InputPerMillion != 1 || byName["local"].Encoding != "p50k_base" {
+		t.Errorf("prices = %+v", prices)
+	}
+
+	if byName["gpt-4.1"].Encoding != "o200k_base" {
+		t.Errorf("gpt-4.1 = %+v, want o200k_base", byName["gpt-4.1"])
+	}
+	for _, price := range builtinPricing {
+		if price.Encoding != "" && !pricingEncodings[price.Encoding] {
+			t.Errorf("built-in %s has unknown encoding %q", price.Name, price.Encoding)
+		}
+	}
+
+	for name, data := range map[string]string{
+		"bad.json":      "{",
+		"encoding.json": `{"typo": {"input_per_million": 1, "encoding": "cl100k"}}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadPricing(filepath.Join(dir, name), false); err == nil {
+			t.Errorf("%s did not fail", name)
+		}
+	}
+}
+
+func TestEstimateCosts(t *testing.T) {
+	encodingTokenizersMu.Lock()
+	saved := encodingTokenizers
+	encodingTokenizers = map[string]Tokenizer{"cl100k_base": wordTokenizer{}, "p50k_base": halfWords{}, "o200k_base": halfWords{}}
+	encodingTokenizersMu.Unlock()
+	defer func() { encodingTokenizers = saved }()
+
+	prices := []ModelPrice{
+		{Name: "big", InputPerMillion: 2, ContextWindow: 100},
+		{Name: "small", InputPerMillion: 1e6, ContextWindow: 3},
+		{Name: "other", InputPerMillion: 1, Encoding: "p50k_base"},
+		{Name: "newer", InputPerMillion: 1, Encoding: "o200k_base"},
+	}
+	estimates := EstimateCosts("one two three four", prices)
+	// Without an encoding, the model's tokenizer is unknown and cl100k_base
+	// only approximates it.
+	if e := estimates[0]; e.Tokens != 4 || e.InputCost != 8e-6 || e.ExceedsWindow || e.Encoding != "cl100k_base" || !e.Approximate {
+		t.Errorf("big = %+v", e)
+	}
+	if e := estimates[1]; e.InputCost != 4 || !e.ExceedsWindow {
+		t.Errorf("small = %+v", e)
+	}
+	if e := estimates[2]; e.Tokens != 2 || e.Encoding != "p50k_base" || e.ExceedsWindow || e.Approximate {
+		t.Errorf("other = %+v", e)
+	}
+	if e := estimates[3]; e.Tokens != 2 || e.Encoding != "o200k_base" || e.Approximate {
+		t.Errorf("newer = %+v", e)
+	}
+}
+
+func TestO200kBase(t *testing.T) {
+	// Ranks for every byte and one merge stand in for the published ranks,
+	// which would be downloaded.
+	var ranks strings.Builder
+	for b := 0; b < 256; b++ {
+		fmt.Fprintf(&ranks, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(b)}), b)
+	}
+	fmt.Fprintf(&ranks, "%s 256\n", base64.StdEncoding.EncodeToString([]byte("ab")))
+	path := filepath.Join(t.TempDir(), "o200k_base.tiktoken")
+	if err := os.WriteFile(path, []byte(ranks.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	saved := o200kRanks
+	o200kRanks = path
+	defer func() { o200kRanks = saved }()
+
+	// The pattern splits "ab ab" into "ab" and " ab", and " ab" is not a
+	// rank, so it is encoded as " " and "ab".
+	n, err := NewTiktokenTokenizer("o200k_base").CountTokens("ab ab")
+	if err != nil || n != 3 {
+		t.Errorf("o200k_base counted %d tokens, %v; want 3", n, err)
+	}
+}
+
+// halfWords stands in for a second encoding with fewer tokens.
+type halfWords struct{}
+
+func (halfWords) Name() string { return "test:halfwords" }
+
+func (halfWords) CountTokens(text string) (int64, error) {
+	n, _ := wordTokenizer{}.CountTokens(text)
+	return n / 2, nil
+}
@@ -0,0 +1,39 @@
+package prompt
+
+import "context"
+
+// Progress reports how far processing a repository has got.
+type Progress struct {
+	FilesScanned  int   // files visited by the walk, selected or not
+	FilesIncluded int   // files selected and read
+	Bytes         int64 // combined size of the included files
+	Tokens        int64 // combined tokens of the included files
+}
+
+// ProgressFunc receives a Progress after every file visited. It is called
+// from the goroutine doing the work, so it should return quickly.
+type ProgressFunc func(Progress)
+
+// CanceledError is returned when the context of a run is cancelled or its
+// deadline passes. It wraps the context's error, so
+// errors.Is(err, context.Canceled) holds, and records the progress made.
+type CanceledError struct {
+	Err      error
+	Progress Progress
+}
+
+func (e *CanceledError) Error() string {
+	return "canceled: " + e.Err.Error()
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// checkCanceled returns a *CanceledError once ctx is done.
+func checkCanceled(ctx context.Context, p Progress) error {
+	if err := ctx.Err(); err != nil {
+		return &CanceledError{Err: err, Progress: p}
+	}
+	return nil
+}
@@ -2,31 +2,73 @@ package prompt
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 	"unicode/utf8"
-	"github.com/chand1012/git2gpt/utils"
 	"github.com/gobwas/glob"
-	"github.com/pkoukk/tiktoken-go"
 )
 
 type GitFile struct {
-	Path     string `json:"path" xml:"path"`     // path to the file relative to the repository root
-	Tokens   int64  `json:"tokens" xml:"tokens"`   // number of tokens in the file
-	Contents string `json:"contents" xml:"contents"` // contents of the file
+	Path            string `json:"path" xml:"path"`                                             // path to the file relative to the repository root
+	Tokens          int64  `json:"tokens" xml:"tokens"`                                         // number of tokens in the file
+	Contents        string `json:"contents" xml:"contents"`                                     // contents of the file
+	LastCommit      string `json:"last_commit,omitempty" xml:"last_commit,omitempty"`           // short hash of the last commit that modified the file
+	Partial         bool   `json:"partial,omitempty" xml:"partial,omitempty"`                   // contents are excerpts, not the whole file
+	ID              string `json:"id,omitempty" xml:"id,omitempty"`                             // short ID for citations, such as F3kq9
+	Summary         bool   `json:"summary,omitempty" xml:"summary,omitempty"`                   // contents are a summary, not the file
+	Submodule       string `json:"submodule,omitempty" xml:"submodule,omitempty"`               // path of the submodule the file belongs to
+	SubmoduleCommit string `json:"submodule_commit,omitempty" xml:"submodule_commit,omitempty"` // short hash of the commit the repository pins the submodule at
+	Symlink         string `json:"symlink,omitempty" xml:"symlink,omitempty"`                   // target of a symbolic link recorded instead of read
+	Root            string `json:"-" xml:"-"`                                                   // absolute path of the repository the file was read from
+	Ref             string `json:"-" xml:"-"`                                                   // commit the file was read from, when read from the object database
+
+	// The size and SHA-256 of the file as read, before any transform, for
+	// the manifest; see setSource.
+	sourceSize   int64
+	sourceSHA256 string
+	lineNumbers  bool // numbered by NumberLines
 }
 
 type GitRepo struct {
 	TotalTokens int64     `json:"total_tokens" xml:"total_tokens"`
 	Files       []GitFile `json:"files" xml:"files>file"`
 	FileCount   int       `json:"file_count" xml:"file_count"`
+	History     []Commit  `json:"history,omitempty" xml:"history>commit,omitempty"`
+	// Digest identifies the files of the output by their paths, checksums
+	// and transforms; see SnapshotDigest. It is set by the JSON and XML
+	// formats.
+	Digest string `json:"digest,omitempty" xml:"digest,omitempty"`
+	// Submodules lists the git submodules of the repository, whether their
+	// files are included or not.
+	Submodules []Submodule `json:"submodules,omitempty" xml:"submodules>submodule,omitempty"`
+	// Task holds instructions that follow the repository, such as a question
+	// about it. In the text format they come after the end marker.
+	Task string `json:"task,omitempty" xml:"task,omitempty"`
+	// Guidance is added to the preamble of the text format, such as the role
+	// a preset asks the model to take. The other formats have no preamble.
+	Guidance string `json:"-" xml:"-"`
+	// Skipped lists the selected files that could not be read and were left
+	// out under SkipOnError or WarnOnError. It is not part of the output.
+	Skipped []SkippedFile `json:"-" xml:"-"`
 }
 
+const defaultPreamble = "The following text is a Git repository with code. The structure of the text are sections that begin with ----, followed by a single line containing the file path and file name, followed by a variable amount of lines containing the file contents. The text representing the Git repository ends when the symbols --END-- are encountered. Any further text beyond --END-- are meant to be interpreted as instructions using the aforementioned Git repository as context.\n"
+
+const citationPreamble = "Each file path is preceded by a short file ID in brackets, such as [F3kq9]. When referring to code, cite it by file ID and line numbers, such as F3kq9:L30-42.\n"
+
+// delimiterNote follows a custom preamble when the classic markers could not
+// be used, since the custom text cannot be rewritten to name the new ones.
+const delimiterNote = "Files begin with a line ----, followed by a line with the file path, and the repository ends with --END--.\n"
+
+const historyPreamble = "After the files and before --END--, a section beginning with --HISTORY-- lists recent commits to the repository, newest first, with their authors, dates, messages and the files they touched.\n"
+
 func contains(s []string, e string) bool {
 	for _, a := range s {
 		if a == e {
@@ -37,37 +79,34 @@ func contains(s []string, e string) bool {
 }
 
 func getIgnoreList(ignoreFilePath string) ([]string, error) {
-	var ignoreList []string
 	file, err := os.Open(ignoreFilePath)
 	if err != nil {
-		return ignoreList, err
+		return nil, err
 	}
 	defer file.Close()
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		if strings.HasSuffix(line, "/") {
-			line = line + "**"
-		}
-		line = strings.TrimPrefix(line, "/")
-		ignoreList = append(ignoreList, line)
-	}
-	return ignoreList, scanner.Err()
+	return parsePatterns(file, ignoreFilePath)
 }
 
 // Similar to getIgnoreList, but for .gptinclude files
 func getIncludeList(includeFilePath string) ([]string, error) {
-	var includeList []string
 	file, err := os.Open(includeFilePath)
 	if err != nil {
-		return includeList, err
+		return nil, err
 	}
 	defer file.Close()
-	scanner := bufio.NewScanner(file)
+	return parsePatterns(file, includeFilePath)
+}
+
+// parsePatterns reads one glob pattern per line, skipping blank lines and
+// comments, in the format shared by .gptignore, .gptinclude and .gitignore.
+// An invalid pattern is reported as a *PatternError naming the file, called
+// name, and the line.
+func parsePatterns(r io.Reader, name string) ([]string, error) {
+	var patterns []string
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
 	for scanner.Scan() {
+		lineNumber++
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
@@ -76,9 +115,15 @@ func getIncludeList(includeFilePath string) ([]string, error) {
 			line = line + "**"
 		}
 		line = strings.TrimPrefix(line, "/")
-		includeList = append(includeList, line)
+		if _, err := glob.Compile(line, '/'); err != nil {
+			return nil, &PatternError{File: name, Line: lineNumber, Pattern: line, Err: err}
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", name, err)
 	}
-	return includeList, scanner.Err()
+	return patterns, nil
 }
 
 func windowsToUnixPath(windowsPath string) string {
@@ -86,60 +131,51 @@ func windowsToUnixPath(windowsPath string) string {
 	return unixPath
 }
 
-// This function is kept for backward compatibility
-func shouldIgnore(filePath string, ignoreList []string) bool {
-	for _, pattern := range ignoreList {
-		g := glob.MustCompile(pattern, '/')
-		if g.Match(windowsToUnixPath(filePath)) {
-			return true
-		}
-	}
-	return false
+// GenerateIgnoreList is LoadIgnoreList without error reporting: a pattern
+// file that cannot be read or parsed contributes no patterns.
+func GenerateIgnoreList(repoPath, ignoreFilePath string, useGitignore bool) []string {
+	ignoreList, _ := loadIgnoreList(repoPath, ignoreFilePath, useGitignore, true)
+	return ignoreList
 }
-
-// Determines if a file should be included in the output
-// First checks if the file matches the include list (if provided)
-// Then checks if the file is excluded by the ignore list
-func shouldProcess(filePath string, includeList, ignoreList []string) bool {
-	// If includeList is provided, check if the file is included
-	if len(includeList) > 0 {
-		included := false
-		for _, pattern := range includeList {
-			g := glob.MustCompile(pattern, '/')
-			if g.Match(windowsToUnixPath(filePath)) {
-				included = true
-				break
-			}
-		}
-		if !included {
-			return false // If not in the include list, skip it
-		}
-	}
-	
-	// Check if the file is excluded by ignoreList
-	for _, pattern := range ignoreList {
-		g := glob.MustCompile(pattern, '/')
-		if g.Match(windowsToUnixPath(filePath)) {
-			return false // If in the ignore list, skip it
-		}
-	}
 	
-	return true // Process this file
+// LoadIgnoreList builds the ignore list of the repository at repoPath from
+// its .gptignore, or from ignoreFilePath if set, the built-in patterns and,
+// if useGitignore is set, its .gitignore. Invalid patterns are reported as a
+// *PatternError with the file and line; a missing ignoreFilePath is an error.
+func LoadIgnoreList(repoPath, ignoreFilePath string, useGitignore bool) ([]string, error) {
+	return loadIgnoreList(repoPath, ignoreFilePath, useGitignore, false)
 }
-
-func GenerateIgnoreList(repoPath, ignoreFilePath string, useGitignore bool) []string {
+	
+// loadIgnoreList does the work of LoadIgnoreList. With lenient set, files
+// that fail to load are skipped and the remaining patterns are returned.
+func loadIgnoreList(repoPath, ignoreFilePath string, useGitignore, lenient bool) ([]string, error) {
+	required := ignoreFilePath != ""
 	if ignoreFilePath == "" {
 		ignoreFilePath = filepath.Join(repoPath, ".gptignore")
 	}
 	var ignoreList []string
-	if _, err := os.Stat(ignoreFilePath); err == nil {
-		ignoreList, _ = getIgnoreList(ignoreFilePath)
+	var firstErr error
+	if _, err := os.Stat(ignoreFilePath); err == nil || required {
+		patterns, err := getIgnoreList(ignoreFilePath)
+		if err != nil && !lenient {
+			return nil, err
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		ignoreList = patterns
 	}
 	ignoreList = append(ignoreList, ".git/**", ".gitignore", ".gptignore", ".gptinclude")
 	if useGitignore {
 		gitignorePath := filepath.Join(repoPath, ".gitignore")
 		if _, err := os.Stat(gitignorePath); err == nil {
-			gitignoreList, _ := getIgnoreList(gitignorePath)
+			gitignoreList, err := getIgnoreList(gitignorePath)
+			if err != nil && !lenient {
+				return nil, err
+			}
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
 			ignoreList = append(ignoreList, gitignoreList...)
 		}
 	}
@@ -153,17 +189,37 @@ func GenerateIgnoreList(repoPath, ignoreFilePath string, useGitignore bool) []st
 			finalIgnoreList = append(finalIgnoreList, pattern)
 		}
 	}
-	return finalIgnoreList
+	return finalIgnoreList, firstErr
 }
 
-// Generate include list from .gptinclude file
+// Generate include list from .gptinclude file. Like GenerateIgnoreList, it
+// does not report errors; see LoadIncludeList.
 func GenerateIncludeList(repoPath, includeFilePath string) []string {
+	includeList, _ := loadIncludeList(repoPath, includeFilePath, true)
+	return includeList
+}
+
+// LoadIncludeList builds the include list of the repository at repoPath from
+// its .gptinclude, or from includeFilePath if set. Errors are reported as by
+// LoadIgnoreList.
+func LoadIncludeList(repoPath, includeFilePath string) ([]string, error) {
+	return loadIncludeList(repoPath, includeFilePath, false)
+}
+
+func loadIncludeList(repoPath, includeFilePath string, lenient bool) ([]string, error) {
+	required := includeFilePath != ""
 	if includeFilePath == "" {
 		includeFilePath = filepath.Join(repoPath, ".gptinclude")
 	}
 	var includeList []string
-	if _, err := os.Stat(includeFilePath); err == nil {
-		includeList, _ = getIncludeList(includeFilePath)
+	var firstErr error
+	if _, err := os.Stat(includeFilePath); err == nil || required {
+		patterns, err := getIncludeList(includeFilePath)
+		if err != nil && !lenient {
+			return nil, err
+		}
+		firstErr = err
+		includeList = patterns
 	}
 	
 	var finalIncludeList []string
@@ -176,13 +232,45 @@ func GenerateIncludeList(repoPath, includeFilePath string) []string {
 			finalIncludeList = append(finalIncludeList, pattern)
 		}
 	}
-	return finalIncludeList
+	return finalIncludeList, firstErr
 }
 
 // Update the function signature to accept includeList
 func ProcessGitRepo(repoPath string, includeList, ignoreList []string) (*GitRepo, error) {
+	return ProcessGitRepoCached(repoPath, includeList, ignoreList, nil)
+}
+
+// ProcessGitRepoCached is like ProcessGitRepo, but reuses the contents and
+// token counts of files that cache has already seen unchanged. A nil cache
+// reads every file.
+func ProcessGitRepoCached(repoPath string, includeList, ignoreList []string, cache *TokenCache) (*GitRepo, error) {
+	return ProcessGitRepoContext(context.Background(), repoPath, includeList, ignoreList, ProcessOptions{Cache: cache})
+}
+
+// ProcessOptions holds the optional settings of ProcessGitRepoContext.
+type ProcessOptions struct {
+	Cache    *TokenCache   // reuse unchanged files; nil reads every file
+	Progress ProgressFunc  // called after every file visited; may be nil
+	OnError  ErrorPolicy   // what to do with files that cannot be read
+	Symlinks SymlinkPolicy // how symbolic links in the working tree are read
+	// Submodules decides whether the files of git submodules are read.
+	Submodules SubmoduleMode
+	// IgnoreGitignore leaves out the .gitignore of each included submodule.
+	// By default it applies, the way LoadIgnoreList reads the .gitignore of
+	// the repository itself.
+	IgnoreGitignore bool
+	// Tokenizer counts the tokens of every file; nil means DefaultTokenizer.
+	// Use DiskCache.Tokenizer to keep the counts between runs.
+	Tokenizer Tokenizer
+}
+
+// ProcessGitRepoContext is ProcessGitRepo with cancellation, progress
+// reporting and an error policy. Once ctx is done it stops and returns a
+// *CanceledError. Invalid patterns are reported as a *PatternError before
+// any file is read.
+func ProcessGitRepoContext(ctx context.Context, repoPath string, includeList, ignoreList []string, opts ProcessOptions) (*GitRepo, error) {
 	var repo GitRepo
-	err := processRepository(repoPath, includeList, ignoreList, &repo)
+	err := processRepository(ctx, repoPath, includeList, ignoreList, &repo, walkOptions{ProcessOptions: opts})
 	if err != nil {
 		return nil, fmt.Errorf("error processing repository: %w", err)
 	}
@@ -190,35 +278,118 @@ func ProcessGitRepo(repoPath string, includeList, ignoreList []string) (*GitRepo
 }
 
 func OutputGitRepo(repo *GitRepo, preambleFile string, scrubComments bool) (string, error) {
-	var repoBuilder strings.Builder
-	if preambleFile != "" {
-		preambleText, err := os.ReadFile(preambleFile)
+	return RenderRepoContext(context.Background(), repo, FormatText, preambleFile, scrubComments)
+}
+
+// renderText writes the plain text format. An empty preamble selects the
+// default one. The markers are chosen by ChooseDelimiters after comments are
+// scrubbed, so they never collide with a line of the output.
+func renderText(ctx context.Context, repo *GitRepo, preamble string, scrubComments bool, tok Tokenizer) (string, error) {
+	head, body, err := renderTextParts(ctx, repo, preamble, scrubComments, tok)
+	if err != nil {
+		return "", err
+	}
+	output := head + body
+	repo.TotalTokens = countTokens(tok, output)
+	return output, nil
+}
+
+// renderTextParts renders the plain text format as the preamble and the
+// body holding the files, history and task.
+func renderTextParts(ctx context.Context, repo *GitRepo, preamble string, scrubComments bool, tok Tokenizer) (string, string, error) {
+	var head, body strings.Builder
+	if err := writeTextParts(ctx, &head, &body, repo, preamble, scrubComments, tok); err != nil {
+		return "", "", err
+	}
+	return head.String(), body.String(), nil
+}
+
+// writeTextParts writes the preamble of the plain text format to head and
+// the files, history and task to body, one file at a time, and stops at the
+// first write error.
+func writeTextParts(ctx context.Context, head, body io.Writer, repo *GitRepo, preamble string, scrubComments bool, tok Tokenizer) error {
+	files := scrubbedFiles(repo, scrubComments, tok)
+	// A custom preamble and guidance are part of the output too, so they are
+	// checked for marker lines along with the files.
+	delims := ChooseDelimiters(append(files, GitFile{Contents: preamble + "\n" + repo.Guidance + "\n" + submoduleText(repo.Submodules)}))
+
+	var headBuilder strings.Builder
+	if preamble != "" {
+		text, err := renderPreamble(preamble, repo, delims)
 		if err != nil {
-			return "", fmt.Errorf("error reading preamble file: %w", err)
+			return err
+		}
+		headBuilder.WriteString(fmt.Sprintf("%s\n", text))
+		if delims != ClassicDelimiters && !strings.Contains(text, delims.File) {
+			headBuilder.WriteString(delims.describe(delimiterNote))
 		}
-		repoBuilder.WriteString(fmt.Sprintf("%s\n", string(preambleText)))
 	} else {
-		repoBuilder.WriteString("The following text is a Git repository with code. The structure of the text are sections that begin with ----, followed by a single line containing the file path and file name, followed by a variable amount of lines containing the file contents. The text representing the Git repository ends when the symbols --END-- are encountered. Any further text beyond --END-- are meant to be interpreted as instructions using the aforementioned Git repository as context.\n")
+		headBuilder.WriteString(defaultPreambleText(repo, delims))
 	}
-	for _, file := range repo.Files {
-		repoBuilder.WriteString("----\n")
-		repoBuilder.WriteString(fmt.Sprintf("%s\n", file.Path))
-		if scrubComments {
-			file.Contents = utils.RemoveCodeComments(file.Contents)
+	if repo.Guidance != "" {
+		headBuilder.WriteString(strings.TrimRight(repo.Guidance, "\n") + "\n")
+	}
+	headBuilder.WriteString(submoduleText(repo.Submodules))
+	if _, err := io.WriteString(head, headBuilder.String()); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return &CanceledError{Err: err}
+		}
+		if _, err := io.WriteString(body, delims.File+"\n"+pathLine(file)+"\n"+file.Contents+"\n"); err != nil {
+			return err
 		}
-		repoBuilder.WriteString(fmt.Sprintf("%s\n", file.Contents))
 	}
-	repoBuilder.WriteString("--END--")
-	output := repoBuilder.String()
-	repo.TotalTokens = EstimateTokens(output)
-	return output, nil
+	var tail strings.Builder
+	if len(repo.History) > 0 {
+		writeHistory(&tail, repo.History, delims)
+	}
+	tail.WriteString(delims.End)
+	if repo.Task != "" {
+		tail.WriteString("\n" + repo.Task)
+	}
+	_, err := io.WriteString(body, tail.String())
+	return err
+}
+
+// scrubbedFiles returns a copy of the files of repo, with comments removed
+// if scrubComments is set. A tokenizer from DiskCache.Tokenizer also caches
+// the scrubbed files.
+func scrubbedFiles(repo *GitRepo, scrubComments bool, tok Tokenizer) []GitFile {
+	files := make([]GitFile, len(repo.Files))
+	copy(files, repo.Files)
+	if scrubComments {
+		for i := range files {
+			files[i].Contents = removeComments(diskCacheOf(tok), files[i].Contents)
+		}
+	}
+	return files
+}
+
+// defaultPreambleText is the preamble used when none is given, naming the
+// markers in use and describing the file IDs and history if present.
+func defaultPreambleText(repo *GitRepo, delims Delimiters) string {
+	text := delims.describe(defaultPreamble)
+	if len(repo.Files) > 0 && repo.Files[0].ID != "" {
+		text += citationPreamble
+	}
+	if len(repo.History) > 0 {
+		text += delims.describe(historyPreamble)
+	}
+	return text
 }
 
 
 func OutputGitRepoXML(repo *GitRepo, scrubComments bool) (string, error) {
+	return renderXML(context.Background(), repo, scrubComments, DefaultTokenizer)
+}
+
+func renderXML(ctx context.Context, repo *GitRepo, scrubComments bool, tok Tokenizer) (string, error) {
 	if scrubComments {
 		for i, file := range repo.Files {
-			repo.Files[i].Contents = utils.RemoveCodeComments(file.Contents)
+			repo.Files[i].Contents = removeComments(diskCacheOf(tok), file.Contents)
 		}
 	}
 	var result strings.Builder
@@ -227,12 +398,38 @@ func OutputGitRepoXML(repo *GitRepo, scrubComments bool) (string, error) {
 	
 	result.WriteString("    <total_tokens>PLACEHOLDER</total_tokens>\n")
 	result.WriteString(fmt.Sprintf("    <file_count>%d</file_count>\n", repo.FileCount))
+	repo.Digest = SnapshotDigest(repo, scrubComments)
+	result.WriteString(fmt.Sprintf("    <digest>%s</digest>\n", repo.Digest))
 	result.WriteString("    <files>\n")
 	
 	for _, file := range repo.Files {
+		if err := ctx.Err(); err != nil {
+			return "", &CanceledError{Err: err}
+		}
 		result.WriteString("        <file>\n")
+		if file.ID != "" {
+			result.WriteString(fmt.Sprintf("            <id>%s</id>\n", escapeXML(file.ID)))
+		}
 		result.WriteString(fmt.Sprintf("            <path>%s</path>\n", escapeXML(file.Path)))
 		result.WriteString(fmt.Sprintf("            <tokens>%d</tokens>\n", file.Tokens))
+		if file.LastCommit != "" {
+			result.WriteString(fmt.Sprintf("            <last_commit>%s</last_commit>\n", escapeXML(file.LastCommit)))
+		}
+		if file.Partial {
+			result.WriteString("            <partial>true</partial>\n")
+		}
+		if file.Summary {
+			result.WriteString("            <summary>true</summary>\n")
+		}
+		if file.Symlink != "" {
+			result.WriteString(fmt.Sprintf("            <symlink>%s</symlink>\n", escapeXML(file.Symlink)))
+		}
+		if file.Submodule != "" {
+			result.WriteString(fmt.Sprintf("            <submodule>%s</submodule>\n", escapeXML(file.Submodule)))
+		}
+		if file.SubmoduleCommit != "" {
+			result.WriteString(fmt.Sprintf("            <submodule_commit>%s</submodule_commit>\n", escapeXML(file.SubmoduleCommit)))
+		}
 		
 		// Split content around CDATA end marker (]]>) and create multiple CDATA sections
 		contents := file.Contents
@@ -251,7 +448,7 @@ func OutputGitRepoXML(repo *GitRepo, scrubComments bool) (string, error) {
 			// Write content up to the CDATA end marker
 			result.WriteString("<![CDATA[")
 			result.WriteString(contents[:idx+2]) // Include the "]]" part
-			result.WriteString("]]>") // Close this CDATA section
+			result.WriteString("]]>")            // Close this CDATA section
 			
 			// Start a new CDATA section with the ">" character
 			result.WriteString("<![CDATA[>")
@@ -265,17 +462,26 @@ func OutputGitRepoXML(repo *GitRepo, scrubComments bool) (string, error) {
 	}
 	
 	result.WriteString("    </files>\n")
+	if len(repo.Submodules) > 0 {
+		writeSubmodulesXML(&result, repo.Submodules)
+	}
+	if len(repo.History) > 0 {
+		writeHistoryXML(&result, repo.History)
+	}
+	if repo.Task != "" {
+		result.WriteString(fmt.Sprintf("    <task>%s</task>\n", escapeXML(repo.Task)))
+	}
 	result.WriteString("</root>\n")
 	
 	outputStr := result.String()
 	
-	tokenCount := EstimateTokens(outputStr)
+	tokenCount := countTokens(tok, outputStr)
 	repo.TotalTokens = tokenCount
 	
 	outputStr = strings.Replace(
-		outputStr, 
-		"<total_tokens>PLACEHOLDER</total_tokens>", 
-		fmt.Sprintf("<total_tokens>%d</total_tokens>", tokenCount), 
+		outputStr,
+		"<total_tokens>PLACEHOLDER</total_tokens>",
+		fmt.Sprintf("<total_tokens>%d</total_tokens>", tokenCount),
 		1,
 	)
 	
@@ -292,66 +498,322 @@ func escapeXML(s string) string {
 }
 
 func ValidateXML(xmlString string) error {
-    decoder := xml.NewDecoder(strings.NewReader(xmlString))
-    for {
-        _, err := decoder.Token()
-        if err == io.EOF {
-            break
-        }
-        if err != nil {
-            return fmt.Errorf("XML validation error: %w", err)
-        }
-    }
-    return nil
+	decoder := xml.NewDecoder(strings.NewReader(xmlString))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("XML validation error: %w", err)
+		}
+	}
+	return nil
 }
 
 func MarshalRepo(repo *GitRepo, scrubComments bool) ([]byte, error) {
-	_, err := OutputGitRepo(repo, "", scrubComments)
+	return marshalRepo(context.Background(), repo, scrubComments, DefaultTokenizer)
+}
+
+func marshalRepo(ctx context.Context, repo *GitRepo, scrubComments bool, tok Tokenizer) ([]byte, error) {
+	if _, err := renderText(ctx, repo, "", scrubComments, tok); err != nil {
+		return nil, err
+	}
+	repo.Digest = SnapshotDigest(repo, scrubComments)
+	// The files are marshalled as sent, so scrubbed like in the text.
+	sent := *repo
+	sent.Files = scrubbedFiles(repo, scrubComments, tok)
+	output, err := json.Marshal(&sent)
 	if err != nil {
 		return nil, fmt.Errorf("error marshalling repo: %w", err)
 	}
-	return json.Marshal(repo)
+	return output, nil
+}
+
+// Update the function signature to accept includeList
+func processRepository(ctx context.Context, repoPath string, includeList, ignoreList []string, repo *GitRepo, opts walkOptions) error {
+	opts.cacheRoot = repoPath
+	opts.osRoot = repoPath
+	submodules, err := findSubmodules(repoPath)
+	if err != nil {
+		return err
+	}
+	// Submodules are read on their own, with their own ignore rules.
+	opts.skipDirs = map[string]bool{}
+	for _, sub := range submodules {
+		opts.skipDirs[sub.Path] = true
+	}
+	err = processFS(ctx, os.DirFS(repoPath), includeList, ignoreList, repo, opts)
+	localizePaths(repo, repoPath)
+	if err != nil {
+		return fmt.Errorf("error walking the path %q: %w", repoPath, err)
+	}
+	if err := processSubmodules(ctx, repoPath, submodules, includeList, ignoreList, repo, opts); err != nil {
+		return err
+	}
+	sortFiles(repo.Files)
+	return nil
+}
+
+// localizePaths turns the slash separated paths of processFS into paths for
+// the operating system and records the repository the files came from.
+func localizePaths(repo *GitRepo, repoPath string) {
+	root, err := filepath.Abs(repoPath)
+	if err != nil {
+		root = repoPath
+	}
+	for i := range repo.Files {
+		repo.Files[i].Path = filepath.FromSlash(repo.Files[i].Path)
+		repo.Files[i].Root = root
+	}
+	for i := range repo.Skipped {
+		repo.Skipped[i].Path = filepath.FromSlash(repo.Skipped[i].Path)
+	}
+}
+
+// walkOptions holds the settings of processFS beyond the file selection.
+type walkOptions struct {
+	ProcessOptions
+	cacheRoot string // cache entries are keyed by the file's path below it
+	skipDirs  map[string]bool // directories left out of the walk, such as submodules
+	// osRoot is the directory on disk that the walked fs.FS reads, if any.
+	// Symbolic links are only resolved, and confined to it, when it is set.
+	osRoot string
+	// stamps, if set, receives the size and modification time of the
+	// selected files instead of their contents; see StatGitRepo.
+	stamps map[string]FileStamp
+}
+
+// processFS reads the selected files of fsys into repo. Paths are slash
+// separated and relative to the root of fsys.
+func processFS(ctx context.Context, fsys fs.FS, includeList, ignoreList []string, repo *GitRepo, opts walkOptions) error {
+	m, err := newMatcher(includeList, ignoreList)
+	if err != nil {
+		return err
+	}
+	w := &fsWalker{ctx: ctx, fsys: fsys, m: m, repo: repo, opts: opts}
+	if opts.osRoot != "" {
+		if w.realRoot, err = filepath.EvalSymlinks(opts.osRoot); err != nil {
+			return err
+		}
+	}
+	err = w.walk(".", nil)
+	repo.FileCount = len(repo.Files)
+	return err
+}
+
+// fsWalker holds the state of a walk of processFS.
+type fsWalker struct {
+	ctx      context.Context
+	fsys     fs.FS
+	m        *matcher
+	repo     *GitRepo
+	opts     walkOptions
+	progress Progress
+	realRoot string // opts.osRoot with symbolic links resolved
 }
 
-// Update the function signature to accept includeList and use shouldProcess
-func processRepository(repoPath string, includeList, ignoreList []string, repo *GitRepo) error {
-	err := filepath.Walk(repoPath, func(path string, info os.FileInfo, err error) error {
+// walk visits the tree below root. chain holds the real paths of the linked
+// directories followed to reach it.
+func (w *fsWalker) walk(root string, chain []string) error {
+	return fs.WalkDir(w.fsys, root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
+			if path == "." {
+				return err
+			}
+			// The entry, or the listing of a directory, could not be read.
+			return handleFileError(w.opts.OnError, w.repo, path, err)
+		}
+		if err := checkCanceled(w.ctx, w.progress); err != nil {
 			return err
 		}
-		if !info.IsDir() {
-			relativeFilePath, _ := filepath.Rel(repoPath, path)
-			process := shouldProcess(relativeFilePath, includeList, ignoreList)
-			if process {
-				contents, err := os.ReadFile(path)
-				if !utf8.Valid(contents) {
-					return nil
-				}
-				if err != nil {
-					return err
-				}
-				var file GitFile
-				file.Path = relativeFilePath
-				file.Contents = string(contents)
-				file.Tokens = EstimateTokens(file.Contents)
-				repo.Files = append(repo.Files, file)
+		if d.Type()&fs.ModeSymlink != 0 {
+			if w.opts.osRoot != "" {
+				return w.symlink(path, chain)
+			}
+			if links, ok := w.fsys.(linkFS); ok {
+				return w.storedSymlink(path, links)
+			}
+			if w.opts.Symlinks == SkipSymlinks {
+				return nil
 			}
 		}
-		return nil
+		if d.IsDir() {
+			if path != "." && w.skipDir(path) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		return w.file(path, d.Info)
 	})
-	repo.FileCount = len(repo.Files)
+}
+
+func (w *fsWalker) skipDir(path string) bool {
+	return w.opts.skipDirs[path] || w.m.skipDir(path)
+}
+
+// file reads path if it is selected.
+func (w *fsWalker) file(path string, stat func() (fs.FileInfo, error)) error {
+	w.progress.FilesScanned++
+	defer func() { w.opts.report(w.progress) }()
+	if !w.m.match(path) {
+		return nil
+	}
+	return readFile(w.fsys, path, stat, w.repo, w.opts, &w.progress)
+}
+
+func (opts walkOptions) report(progress Progress) {
+	if opts.Progress != nil {
+		opts.Progress(progress)
+	}
+}
+
+// readFile reads the selected file path of fsys into repo, reusing the cached
+// copy if the file is unchanged, or only stats it for opts.stamps. stat is
+// only called when there is a cache or stamps.
+// Files that are not valid UTF-8 are left out.
+func readFile(fsys fs.FS, path string, stat func() (fs.FileInfo, error), repo *GitRepo, opts walkOptions, progress *Progress) error {
+	include := func(file GitFile) { addFile(repo, file, progress) }
+	var info fs.FileInfo
+	var err error
+	cacheKey := filepath.Join(opts.cacheRoot, filepath.FromSlash(path))
+	if opts.stamps != nil {
+		info, err := stat()
+		if err != nil {
+			return handleFileError(opts.OnError, repo, path, err)
+		}
+		opts.stamps[cacheKey] = FileStamp{Size: info.Size(), ModTime: info.ModTime()}
+		return nil
+	}
+	if opts.Cache != nil {
+		if info, err = stat(); err != nil {
+			return handleFileError(opts.OnError, repo, path, err)
+		}
+		if file, ok := opts.Cache.lookup(cacheKey, info); ok {
+			file.Path = path
+			include(file)
+			return nil
+		}
+	}
+	contents, err := fs.ReadFile(fsys, path)
 	if err != nil {
-		return fmt.Errorf("error walking the path %q: %w", repoPath, err)
+		return handleFileError(opts.OnError, repo, path, err)
+	}
+	if !utf8.Valid(contents) {
+		return nil
+	}
+	var file GitFile
+	file.Path = path
+	file.Contents = string(contents)
+	file.Tokens = countTokens(opts.Tokenizer, file.Contents)
+	file.setSource(contents)
+	if opts.Cache != nil {
+		opts.Cache.store(cacheKey, info, file)
 	}
+	include(file)
 	return nil
 }
 
-func EstimateTokens(output string) int64 {
-	tke, err := tiktoken.GetEncoding("cl100k_base")
+// addFile adds file to repo and counts it in progress.
+func addFile(repo *GitRepo, file GitFile, progress *Progress) {
+	repo.Files = append(repo.Files, file)
+	progress.FilesIncluded++
+	progress.Bytes += int64(len(file.Contents))
+	progress.Tokens += file.Tokens
+}
+
+// Output formats accepted by RenderRepo, besides the request body formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatXML  = "xml"
+)
+
+// RenderRepo formats repo as plain text, JSON, XML or a request body with
+// the default RequestOptions.
+func RenderRepo(repo *GitRepo, format, preambleFile string, scrubComments bool) (string, error) {
+	return RenderRepoContext(context.Background(), repo, format, preambleFile, scrubComments)
+}
+
+// RenderRepoContext is RenderRepo with cancellation: once ctx is done it
+// stops and returns a *CanceledError.
+func RenderRepoContext(ctx context.Context, repo *GitRepo, format, preambleFile string, scrubComments bool) (string, error) {
+	return RenderRepoWith(ctx, repo, format, preambleFile, scrubComments, RequestOptions{}, DefaultTokenizer)
+}
+
+// RenderRepoWith is RenderRepoContext with the options of the request body
+// formats and the tokenizer that counts the tokens of the output.
+func RenderRepoWith(ctx context.Context, repo *GitRepo, format, preambleFile string, scrubComments bool, opts RequestOptions, tok Tokenizer) (string, error) {
+	if tok == nil {
+		tok = DefaultTokenizer
+	}
+	switch format {
+	case FormatText, "":
+		preamble, err := readPreamble(preambleFile)
+		if err != nil {
+			return "", err
+		}
+		return renderText(ctx, repo, preamble, scrubComments, tok)
+	case FormatJSON:
+		output, err := marshalRepo(ctx, repo, scrubComments, tok)
+		if err != nil {
+			return "", err
+		}
+		return string(output), nil
+	case FormatXML:
+		output, err := renderXML(ctx, repo, scrubComments, tok)
+		if err != nil {
+			return "", err
+		}
+		if err := ValidateXML(output); err != nil {
+			return "", err
+		}
+		return output, nil
+	case FormatOpenAI, FormatAnthropic:
+		return renderRequest(ctx, repo, format, preambleFile, scrubComments, opts, tok)
+	}
+	return "", fmt.Errorf("unknown output format %q", format)
+}
+
+// WriteRepo is RenderRepoWith writing the output to w as it is rendered.
+// The plain text format is written one file at a time; the other formats
+// start with counts of the whole output, so they are rendered before any of
+// it is written. repo.TotalTokens is set once the output is written.
+func WriteRepo(ctx context.Context, w io.Writer, repo *GitRepo, format, preambleFile string, scrubComments bool, opts RequestOptions, tok Tokenizer) error {
+	if tok == nil {
+		tok = DefaultTokenizer
+	}
+	if format != FormatText && format != "" {
+		output, err := RenderRepoWith(ctx, repo, format, preambleFile, scrubComments, opts, tok)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, output)
+		return err
+	}
+	preamble, err := readPreamble(preambleFile)
+	if err != nil {
+		return err
+	}
+	// Tokens are counted over the whole output, as by renderText, so a copy
+	// of what is written is kept until the end.
+	var sent strings.Builder
+	out := io.MultiWriter(w, &sent)
+	if err := writeTextParts(ctx, out, out, repo, preamble, scrubComments, tok); err != nil {
+		return err
+	}
+	repo.TotalTokens = countTokens(tok, sent.String())
+	return nil
+}
+
+// readPreamble reads a preamble file; an empty path means no preamble.
+func readPreamble(preambleFile string) (string, error) {
+	if preambleFile == "" {
+		return "", nil
+	}
+	preamble, err := os.ReadFile(preambleFile)
 	if err != nil {
-		fmt.Println("Error getting encoding:", err)
-		return 0
+		return "", fmt.Errorf("error reading preamble file: %w", err)
 	}
-	tokens := tke.Encode(output, nil, nil)
-	return int64(len(tokens))
+	return string(preamble), nil
 }
@@ -0,0 +1,255 @@
+package prompt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Request body formats accepted by RenderRepo. They produce the JSON body of
+// a chat request, ready to be posted to the API.
+const (
+	FormatOpenAI    = "openai"    // OpenAI chat completions
+	FormatAnthropic = "anthropic" // Anthropic Messages
+)
+
+// Defaults of RequestOptions.
+const (
+	DefaultOpenAIModel    = "gpt-4o"
+	DefaultAnthropicModel = "claude-sonnet-4-5"
+	DefaultMaxTokens      = 4096
+)
+
+const anthropicPreamble = "The user message contains a Git repository with code, one document per file, titled with the file path and name. Any text after the documents is meant to be interpreted as instructions using the Git repository as context.\n"
+
+const anthropicCitationPreamble = "The context of each document gives its file ID, such as F3kq9. When referring to code, cite it by file ID and line numbers, such as F3kq9:L30-42.\n"
+
+const anthropicHistoryPreamble = "A text block after the documents lists recent commits to the repository, newest first, with their authors, dates, messages and the files they touched.\n"
+
+// RequestOptions controls the request body formats. The question is the task
+// of the repository, set with GitRepo.Task.
+type RequestOptions struct {
+	Model     string // empty selects the default model of the API
+	MaxTokens int    // maximum tokens of the answer; 0 means DefaultMaxTokens
+	// Preamble replaces the default preamble. Like the preamble of the plain
+	// text format, it is a template if it starts with TemplateMarker.
+	Preamble string
+	// CacheControl adds cache_control breakpoints after the system prompt and
+	// after the files and history of Anthropic requests, so the repository is
+	// cached across questions. OpenAI caches prefixes without being asked.
+	CacheControl bool
+}
+
+// OpenAIFormatter renders an OpenAI chat completions request: the preamble
+// as the system message and the plain text repository and question as the
+// user message.
+type OpenAIFormatter struct {
+	RequestOptions
+}
+
+func (f OpenAIFormatter) Format(ctx context.Context, repo *GitRepo, tok Tokenizer) (string, error) {
+	return renderOpenAI(ctx, repo, f.RequestOptions, false, tok)
+}
+
+// AnthropicFormatter renders an Anthropic Messages request with one document
+// content block per file, followed by the history and the question.
+type AnthropicFormatter struct {
+	RequestOptions
+}
+
+func (f AnthropicFormatter) Format(ctx context.Context, repo *GitRepo, tok Tokenizer) (string, error) {
+	return renderAnthropic(ctx, repo, f.RequestOptions, false, tok)
+}
+
+// RenderRequest formats repo as the request body of format, FormatOpenAI or
+// FormatAnthropic. A preambleFile replaces opts.Preamble.
+func RenderRequest(ctx context.Context, repo *GitRepo, format, preambleFile string, scrubComments bool, opts RequestOptions) (string, error) {
+	return renderRequest(ctx, repo, format, preambleFile, scrubComments, opts, DefaultTokenizer)
+}
+
+func renderRequest(ctx context.Context, repo *GitRepo, format, preambleFile string, scrubComments bool, opts RequestOptions, tok Tokenizer) (string, error) {
+	if preambleFile != "" {
+		preamble, err := readPreamble(preambleFile)
+		if err != nil {
+			return "", err
+		}
+		opts.Preamble = preamble
+	}
+	switch format {
+	case FormatOpenAI:
+		return renderOpenAI(ctx, repo, opts, scrubComments, tok)
+	case FormatAnthropic:
+		return renderAnthropic(ctx, repo, opts, scrubComments, tok)
+	}
+	return "", fmt.Errorf("unknown request format %q", format)
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIRequest struct {
+	Model     string          `json:"model"`
+	MaxTokens int             `json:"max_tokens"`
+	Messages  []openAIMessage `json:"messages"`
+}
+
+func renderOpenAI(ctx context.Context, repo *GitRepo, opts RequestOptions, scrubComments bool, tok Tokenizer) (string, error) {
+	head, body, err := renderTextParts(ctx, repo, opts.Preamble, scrubComments, tok)
+	if err != nil {
+		return "", err
+	}
+	req := openAIRequest{
+		Model:     opts.model(DefaultOpenAIModel),
+		MaxTokens: opts.maxTokens(),
+		Messages: []openAIMessage{
+			{Role: "system", Content: strings.TrimRight(head, "\n")},
+			{Role: "user", Content: body},
+		},
+	}
+	repo.TotalTokens = countTokens(tok, head+body)
+	return marshalRequest(req)
+}
+
+type cacheControl struct {
+	Type string `json:"type"`
+}
+
+// anthropicBlock is a text or document content block.
+type anthropicBlock struct {
+	Type         string          `json:"type"`
+	Text         string          `json:"text,omitempty"`
+	Source       *documentSource `json:"source,omitempty"`
+	Title        string          `json:"title,omitempty"`
+	Context      string          `json:"context,omitempty"`
+	CacheControl *cacheControl   `json:"cache_control,omitempty"`
+}
+
+type documentSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	MaxTokens int                `json:"max_tokens"`
+	System    []anthropicBlock   `json:"system,omitempty"`
+	Messages  []anthropicMessage `json:"messages"`
+}
+
+func renderAnthropic(ctx context.Context, repo *GitRepo, opts RequestOptions, scrubComments bool, tok Tokenizer) (string, error) {
+	files := scrubbedFiles(repo, scrubComments, tok)
+	var system string
+	if opts.Preamble != "" {
+		text, err := renderPreamble(opts.Preamble, repo, ClassicDelimiters)
+		if err != nil {
+			return "", err
+		}
+		system = text + "\n"
+	} else {
+		system = anthropicPreamble
+		if len(files) > 0 && files[0].ID != "" {
+			system += anthropicCitationPreamble
+		}
+		if len(repo.History) > 0 {
+			system += anthropicHistoryPreamble
+		}
+	}
+	if repo.Guidance != "" {
+		system += strings.TrimRight(repo.Guidance, "\n") + "\n"
+	}
+	system += submoduleText(repo.Submodules)
+	system = strings.TrimRight(system, "\n")
+	counted := system
+
+	var blocks []anthropicBlock
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return "", &CanceledError{Err: err}
+		}
+		// Empty text blocks are rejected by the API.
+		data := file.Contents
+		if data == "" {
+			data = "(empty file)"
+		}
+		block := anthropicBlock{
+			Type:   "document",
+			Source: &documentSource{Type: "text", MediaType: "text/plain", Data: data},
+			Title:  filepath.ToSlash(file.Path),
+		}
+		var notes []string
+		if file.ID != "" {
+			notes = append(notes, "File ID "+file.ID)
+		}
+		if file.Submodule != "" {
+			note := "Submodule " + file.Submodule
+			if file.SubmoduleCommit != "" {
+				note += " at " + file.SubmoduleCommit
+			}
+			notes = append(notes, note)
+		}
+		block.Context = strings.Join(notes, "; ")
+		blocks = append(blocks, block)
+		counted += "\n" + block.Title + "\n" + data
+	}
+	if len(repo.History) > 0 {
+		var b strings.Builder
+		b.WriteString("Recent commits, newest first:\n\n")
+		writeCommits(&b, repo.History)
+		text := strings.TrimRight(b.String(), "\n")
+		blocks = append(blocks, anthropicBlock{Type: "text", Text: text})
+		counted += "\n" + text
+	}
+
+	req := anthropicRequest{
+		Model:     opts.model(DefaultAnthropicModel),
+		MaxTokens: opts.maxTokens(),
+		System:    []anthropicBlock{{Type: "text", Text: system}},
+	}
+	// The system prompt, files and history stay the same across questions, so
+	// the breakpoints go right after them.
+	if opts.CacheControl {
+		req.System[0].CacheControl = &cacheControl{Type: "ephemeral"}
+		if len(blocks) > 0 {
+			blocks[len(blocks)-1].CacheControl = &cacheControl{Type: "ephemeral"}
+		}
+	}
+	if repo.Task != "" {
+		blocks = append(blocks, anthropicBlock{Type: "text", Text: repo.Task})
+		counted += "\n" + repo.Task
+	}
+	req.Messages = []anthropicMessage{{Role: "user", Content: blocks}}
+	repo.TotalTokens = countTokens(tok, counted)
+	return marshalRequest(req)
+}
+
+func marshalRequest(req any) (string, error) {
+	output, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling request: %w", err)
+	}
+	return string(output), nil
+}
+
+func (opts RequestOptions) model(fallback string) string {
+	if opts.Model == "" {
+		return fallback
+	}
+	return opts.Model
+}
+
+func (opts RequestOptions) maxTokens() int {
+	if opts.MaxTokens <= 0 {
+		return DefaultMaxTokens
+	}
+	return opts.MaxTokens
+}
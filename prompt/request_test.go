@@ -0,0 +1,96 @@
+package prompt
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func requestRepo() *GitRepo {
+	return &GitRepo{
+		Files: []GitFile{
+			{Path: "main.go", Contents: "package main", ID: "F1"},
+			{Path: "empty.txt", ID: "F2"},
+		},
+		History: []Commit{{Hash: "abc1234", Author: "A <a@example.com>", Date: "2024-01-02T03:04:05Z", Message: "Initial commit"}},
+		Task:    "What does main do?",
+	}
+}
+
+func TestOpenAIRequest(t *testing.T) {
+	repo := requestRepo()
+	output, err := OpenAIFormatter{RequestOptions{MaxTokens: 100}}.Format(context.Background(), repo, wordTokenizer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req struct {
+		Model     string `json:"model"`
+		MaxTokens int    `json:"max_tokens"`
+		Messages  []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte(output), &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Model != DefaultOpenAIModel || req.MaxTokens != 100 || len(req.Messages) != 2 {
+		t.Fatalf("request = %+v", req)
+	}
+	system, user := req.Messages[0], req.Messages[1]
+	if system.Role != "system" || !strings.Contains(system.Content, "F3kq9:L30-42") || strings.Contains(system.Content, "package main") {
+		t.Errorf("system message = %q", system.Content)
+	}
+	if user.Role != "user" || !strings.HasPrefix(user.Content, "----\n[F1] main.go\npackage main\n") || !strings.HasSuffix(user.Content, "--END--\nWhat does main do?") {
+		t.Errorf("user message = %q", user.Content)
+	}
+	if repo.TotalTokens == 0 {
+		t.Error("TotalTokens not set")
+	}
+}
+
+func TestAnthropicRequest(t *testing.T) {
+	repo := requestRepo()
+	opts := RequestOptions{Model: "claude-test", CacheControl: true}
+	output, err := AnthropicFormatter{opts}.Format(context.Background(), repo, wordTokenizer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req anthropicRequest
+	if err := json.Unmarshal([]byte(output), &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Model != "claude-test" || req.MaxTokens != DefaultMaxTokens || len(req.Messages) != 1 {
+		t.Fatalf("request = %+v", req)
+	}
+	if len(req.System) != 1 || req.System[0].CacheControl == nil || strings.Contains(req.System[0].Text, "--END--") {
+		t.Errorf("system = %+v", req.System)
+	}
+	blocks := req.Messages[0].Content
+	if len(blocks) != 4 {
+		t.Fatalf("content = %+v", blocks)
+	}
+	main, empty, history, question := blocks[0], blocks[1], blocks[2], blocks[3]
+	if main.Type != "document" || main.Title != "main.go" || main.Context != "File ID F1" || main.Source.Data != "package main" || main.CacheControl != nil {
+		t.Errorf("document = %+v", main)
+	}
+	if empty.Source.Data == "" {
+		t.Error("empty file sent as an empty block")
+	}
+	// The breakpoint follows the stable prefix, before the question.
+	if history.Type != "text" || !strings.Contains(history.Text, "commit abc1234") || history.CacheControl == nil {
+		t.Errorf("history = %+v", history)
+	}
+	if question.Text != "What does main do?" || question.CacheControl != nil {
+		t.Errorf("question = %+v", question)
+	}
+
+	output, err = AnthropicFormatter{}.Format(context.Background(), &GitRepo{Files: []GitFile{{Path: "a.go", Contents: "x"}}}, wordTokenizer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(output, "cache_control") || !strings.Contains(output, DefaultAnthropicModel) {
+		t.Errorf("defaults: %s", output)
+	}
+}
@@ -0,0 +1,279 @@
+// Package prompt turns a repository into a prompt for a language model.
+//
+// Snapshot is the library entry point: it reads any fs.FS, selects files with
+// .gptignore and .gptinclude style patterns and renders them with a
+// Formatter, counting tokens with a Tokenizer:
+//
+//	result, err := prompt.Snapshot(ctx, os.DirFS("path/to/repo"), prompt.Options{
+//		UseGitignore: true,
+//		Formatter:    prompt.XMLFormatter{},
+//		Transforms:   []prompt.Transform{prompt.ScrubComments()},
+//	})
+//
+// The remaining functions are the building blocks of the git2gpt command.
+package prompt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+)
+
+// Formatter renders a repository as a prompt. Formatters set
+// repo.TotalTokens to the token count of the output, measured with tok, and
+// return a *CanceledError once ctx is done.
+type Formatter interface {
+	Format(ctx context.Context, repo *GitRepo, tok Tokenizer) (string, error)
+}
+
+// TextFormatter renders the plain text format. An empty Preamble selects the
+// default one.
+type TextFormatter struct {
+	Preamble string
+}
+
+func (f TextFormatter) Format(ctx context.Context, repo *GitRepo, tok Tokenizer) (string, error) {
+	return renderText(ctx, repo, f.Preamble, false, tok)
+}
+
+// JSONFormatter renders the repository as JSON.
+type JSONFormatter struct{}
+
+func (JSONFormatter) Format(ctx context.Context, repo *GitRepo, tok Tokenizer) (string, error) {
+	output, err := marshalRepo(ctx, repo, false, tok)
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
+
+// XMLFormatter renders the repository as XML.
+type XMLFormatter struct{}
+
+func (XMLFormatter) Format(ctx context.Context, repo *GitRepo, tok Tokenizer) (string, error) {
+	output, err := renderXML(ctx, repo, false, tok)
+	if err != nil {
+		return "", err
+	}
+	if err := ValidateXML(output); err != nil {
+		return "", err
+	}
+	return output, nil
+}
+
+// Transform rewrites the contents of a file before it is formatted.
+type Transform interface {
+	Apply(path, contents string) string
+}
+
+// TransformFunc adapts an ordinary function to the Transform interface.
+type TransformFunc func(path, contents string) string
+
+func (f TransformFunc) Apply(path, contents string) string {
+	return f(path, contents)
+}
+
+// ScrubComments returns the transform behind --scrub-comments, which removes
+// code comments to save tokens.
+func ScrubComments() Transform {
+	return TransformFunc(func(_, contents string) string {
+		return removeComments(nil, contents)
+	})
+}
+
+// Options configures Snapshot. The zero value selects files the way the
+// command line tool does without flags, except that .gitignore is only
+// applied when UseGitignore is set.
+type Options struct {
+	// Include replaces the patterns of the include file when not empty.
+	Include []string
+	// Ignore is added to the patterns of the ignore file.
+	Ignore []string
+	// IgnoreFile and IncludeFile name pattern files inside the file system.
+	// They default to .gptignore and .gptinclude.
+	IgnoreFile  string
+	IncludeFile string
+	// UseGitignore also applies the patterns of .gitignore.
+	UseGitignore bool
+	// Grep keeps only files whose contents match. With Excerpt set, only the
+	// matching regions are kept, with ExcerptContext lines around them.
+	Grep           *regexp.Regexp
+	Excerpt        bool
+	ExcerptContext int
+
+	Tokenizer  Tokenizer   // defaults to DefaultTokenizer
+	Formatter  Formatter   // defaults to TextFormatter with the default preamble
+	Transforms []Transform // applied in order to every file
+	// Budget drops files until the total fits within this many tokens.
+	// Zero means no limit.
+	Budget int64
+	// FileIDs gives every file a short ID for citations; see NewManifest.
+	FileIDs bool
+	// LineNumbers prefixes every line with its line number.
+	LineNumbers bool
+	// Progress, if set, is called after every file visited.
+	Progress ProgressFunc
+	// OnError decides what happens to files that cannot be read. Skipped
+	// files are listed in Repo.Skipped.
+	OnError ErrorPolicy
+	// Symlinks decides how symbolic links are read when fsys is an os.DirFS.
+	// Followed links are confined to its directory. Other file systems
+	// cannot tell where a link leads, so only SkipSymlinks changes how their
+	// links are read.
+	Symlinks SymlinkPolicy
+}
+
+// Result is the outcome of Snapshot.
+type Result struct {
+	Repo        *GitRepo
+	Output      string   // the formatted prompt
+	TotalTokens int64    // tokens of Output
+	Dropped     []string // files left out to meet the budget
+}
+
+// Snapshot selects the files of fsys, applies the transforms and renders
+// them with the formatter. Paths in the result are slash separated and
+// relative to the root of fsys, so any fs.FS works: os.DirFS, embed.FS,
+// fstest.MapFS or an archive. Invalid patterns are reported as a
+// *PatternError before any file is read. Once
+// ctx is done, Snapshot stops and returns a *CanceledError.
+func Snapshot(ctx context.Context, fsys fs.FS, opts Options) (*Result, error) {
+	tok := opts.Tokenizer
+	if tok == nil {
+		tok = DefaultTokenizer
+	}
+	formatter := opts.Formatter
+	if formatter == nil {
+		formatter = TextFormatter{}
+	}
+
+	includeList, err := includeListFS(fsys, opts.IncludeFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Include) > 0 {
+		includeList = opts.Include
+	}
+	ignoreList, err := ignoreListFS(fsys, opts.IgnoreFile, opts.UseGitignore)
+	if err != nil {
+		return nil, err
+	}
+	ignoreList = append(ignoreList, opts.Ignore...)
+
+	var repo GitRepo
+	walk := walkOptions{ProcessOptions: ProcessOptions{Progress: opts.Progress, OnError: opts.OnError, Symlinks: opts.Symlinks, Tokenizer: tok}}
+	walk.osRoot, _ = dirFSRoot(fsys)
+	if err := processFS(ctx, fsys, includeList, ignoreList, &repo, walk); err != nil {
+		return nil, fmt.Errorf("error processing repository: %w", err)
+	}
+	if opts.Grep != nil {
+		FilterByContent(&repo, opts.Grep)
+		if opts.Excerpt {
+			excerptMatches(&repo, opts.Grep, opts.ExcerptContext, tok)
+		}
+	}
+	if len(opts.Transforms) > 0 {
+		for i := range repo.Files {
+			if err := ctx.Err(); err != nil {
+				return nil, &CanceledError{Err: err}
+			}
+			file := &repo.Files[i]
+			for _, t := range opts.Transforms {
+				file.Contents = t.Apply(file.Path, file.Contents)
+			}
+			file.Tokens = countTokens(tok, file.Contents)
+		}
+	}
+	dropped := ApplyTokenBudget(&repo, opts.Budget)
+	if opts.FileIDs {
+		AssignFileIDs(&repo)
+	}
+	if opts.LineNumbers {
+		NumberLinesWith(&repo, tok)
+	}
+
+	output, err := formatter.Format(ctx, &repo, tok)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Repo: &repo, Output: output, TotalTokens: repo.TotalTokens, Dropped: dropped}, nil
+}
+
+// dirFSRoot returns the directory of fsys if it was made by os.DirFS, so
+// symbolic links can be resolved on disk.
+func dirFSRoot(fsys fs.FS) (string, bool) {
+	v := reflect.ValueOf(fsys)
+	if v.Type() != reflect.TypeOf(os.DirFS("")) || v.Kind() != reflect.String {
+		return "", false
+	}
+	return v.String(), true
+}
+
+// readPatternsFS parses a pattern file of fsys. A missing file yields no
+// patterns.
+func readPatternsFS(fsys fs.FS, name string) ([]string, error) {
+	file, err := fsys.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", name, err)
+	}
+	defer file.Close()
+	return parsePatterns(file, name)
+}
+
+// expandDirsFS appends "/**" to patterns that name a directory of fsys, the
+// way GenerateIgnoreList does on disk.
+func expandDirsFS(fsys fs.FS, patterns []string) []string {
+	var final []string
+	for _, pattern := range patterns {
+		if contains(final, pattern) {
+			continue
+		}
+		if fs.ValidPath(pattern) {
+			if info, err := fs.Stat(fsys, pattern); err == nil && info.IsDir() {
+				pattern = path.Join(pattern, "**")
+			}
+		}
+		final = append(final, pattern)
+	}
+	return final
+}
+
+// ignoreListFS is GenerateIgnoreList for an fs.FS.
+func ignoreListFS(fsys fs.FS, ignoreFile string, useGitignore bool) ([]string, error) {
+	if ignoreFile == "" {
+		ignoreFile = ".gptignore"
+	}
+	ignoreList, err := readPatternsFS(fsys, ignoreFile)
+	if err != nil {
+		return nil, err
+	}
+	ignoreList = append(ignoreList, ".git/**", ".gitignore", ".gptignore", ".gptinclude")
+	if useGitignore {
+		gitignoreList, err := readPatternsFS(fsys, ".gitignore")
+		if err != nil {
+			return nil, err
+		}
+		ignoreList = append(ignoreList, gitignoreList...)
+	}
+	return expandDirsFS(fsys, ignoreList), nil
+}
+
+// includeListFS is GenerateIncludeList for an fs.FS.
+func includeListFS(fsys fs.FS, includeFile string) ([]string, error) {
+	if includeFile == "" {
+		includeFile = ".gptinclude"
+	}
+	includeList, err := readPatternsFS(fsys, includeFile)
+	if err != nil {
+		return nil, err
+	}
+	return expandDirsFS(fsys, includeList), nil
+}
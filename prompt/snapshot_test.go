@@ -0,0 +1,108 @@
+package prompt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// wordTokenizer counts whitespace separated words, so tests do not depend on
+// downloading a tiktoken encoding.
+type wordTokenizer struct{}
+
+func (wordTokenizer) Name() string { return "test:words" }
+
+func (wordTokenizer) CountTokens(text string) (int64, error) {
+	return int64(len(strings.Fields(text))), nil
+}
+
+func TestSnapshot(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":          {Data: []byte("// entry point\npackage main\n")},
+		"docs/guide.md":    {Data: []byte("one two three four five six\n")},
+		"vendor/dep/x.go":  {Data: []byte("package dep\n")},
+		"secret.env":       {Data: []byte("TOKEN=1\n")},
+		"bin.dat":          {Data: []byte{0xff, 0xfe}},
+		".gptignore":       {Data: []byte("vendor\n*.env\n")},
+		".git/config":      {Data: []byte("[core]\n")},
+		"sub/notes.txt":    {Data: []byte("notes\n")},
+		"sub/deeper/a.txt": {Data: []byte("a\n")},
+	}
+	ctx := context.Background()
+
+	result, err := Snapshot(ctx, fsys, Options{Tokenizer: wordTokenizer{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range result.Repo.Files {
+		paths = append(paths, f.Path)
+	}
+	want := "docs/guide.md main.go sub/deeper/a.txt sub/notes.txt"
+	if got := strings.Join(paths, " "); got != want {
+		t.Errorf("files = %q, want %q", got, want)
+	}
+	if !strings.HasSuffix(result.Output, "--END--") || result.TotalTokens == 0 {
+		t.Errorf("unexpected output (%d tokens): %q", result.TotalTokens, result.Output)
+	}
+
+	result, err = Snapshot(ctx, fsys, Options{
+		Include:    []string{"**.go", "docs/**"},
+		Tokenizer:  wordTokenizer{},
+		Formatter:  JSONFormatter{},
+		Transforms: []Transform{ScrubComments()},
+		Budget:     5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var repo GitRepo
+	if err := json.Unmarshal([]byte(result.Output), &repo); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.Files) != 1 || repo.Files[0].Path != "main.go" || strings.Contains(repo.Files[0].Contents, "entry point") {
+		t.Errorf("unexpected files: %+v", repo.Files)
+	}
+	if len(result.Dropped) != 1 || result.Dropped[0] != "docs/guide.md" {
+		t.Errorf("dropped = %v", result.Dropped)
+	}
+
+	if _, err := Snapshot(ctx, fsys, Options{Ignore: []string{"["}}); err == nil {
+		t.Error("invalid pattern was accepted")
+	}
+}
+
+func TestSnapshotProgressAndCancel(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for i := 0; i < 10; i++ {
+		fsys[fmt.Sprintf("f%d.txt", i)] = &fstest.MapFile{Data: []byte("a b\n")}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var last Progress
+	_, err := Snapshot(ctx, fsys, Options{Tokenizer: wordTokenizer{}, Progress: func(p Progress) { last = p }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last != (Progress{FilesScanned: 10, FilesIncluded: 10, Bytes: 40, Tokens: 20}) {
+		t.Errorf("final progress = %+v", last)
+	}
+
+	_, err = Snapshot(ctx, fsys, Options{Tokenizer: wordTokenizer{}, Progress: func(p Progress) {
+		if p.FilesScanned == 3 {
+			cancel()
+		}
+	}})
+	var canceled *CanceledError
+	if !errors.As(err, &canceled) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want a CanceledError", err)
+	}
+	if canceled.Progress.FilesScanned != 3 {
+		t.Errorf("stopped after %d files, want 3", canceled.Progress.FilesScanned)
+	}
+}
@@ -0,0 +1,284 @@
+package prompt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/chand1012/git2gpt/git"
+)
+
+// SubmoduleMode decides how the git submodules of a repository are read.
+type SubmoduleMode int
+
+const (
+	// IncludeSubmodules reads the files of every checked out submodule with
+	// the submodule's own ignore rules, and lists the others. It is the
+	// default.
+	IncludeSubmodules SubmoduleMode = iota
+	// ListSubmodules leaves the files of submodules out and lists them all.
+	ListSubmodules
+	// SkipSubmodules leaves submodules out altogether.
+	SkipSubmodules
+)
+
+// ParseSubmoduleMode parses the values of --submodules: include, list or
+// skip.
+func ParseSubmoduleMode(s string) (SubmoduleMode, error) {
+	switch s {
+	case "include", "":
+		return IncludeSubmodules, nil
+	case "list":
+		return ListSubmodules, nil
+	case "skip":
+		return SkipSubmodules, nil
+	}
+	return IncludeSubmodules, fmt.Errorf("unknown submodule mode %q, expected include, list or skip", s)
+}
+
+func (m SubmoduleMode) String() string {
+	switch m {
+	case ListSubmodules:
+		return "list"
+	case SkipSubmodules:
+		return "skip"
+	}
+	return "include"
+}
+
+// Set parses s like ParseSubmoduleMode, so a SubmoduleMode can be used as a
+// command line flag.
+func (m *SubmoduleMode) Set(s string) error {
+	mode, err := ParseSubmoduleMode(s)
+	if err != nil {
+		return err
+	}
+	*m = mode
+	return nil
+}
+
+// Type names the flag type in help output.
+func (m *SubmoduleMode) Type() string {
+	return "mode"
+}
+
+// Submodule is a git submodule of the repository. The files of an included
+// submodule have paths below the submodule path.
+type Submodule struct {
+	Path string `json:"path" xml:"path"` // relative to the repository root
+	URL  string `json:"url,omitempty" xml:"url,omitempty"`
+	// Commit is the short hash of the commit the repository pins.
+	Commit string `json:"commit,omitempty" xml:"commit,omitempty"`
+	// CheckedOut is the short hash of the commit checked out in the
+	// submodule, which the included files come from. It differs from Commit
+	// when the submodule was updated without committing the new pin.
+	CheckedOut  string `json:"checked_out,omitempty" xml:"checked_out,omitempty"`
+	Initialized bool   `json:"initialized" xml:"initialized"` // checked out in the working tree
+	Included    bool   `json:"included" xml:"included"`       // its files are part of the output
+}
+
+// findSubmodules reads the submodules below repoPath from the .gitmodules
+// file at the root of its working tree. Paths are slash separated and
+// relative to repoPath. A directory outside a git repository has none. A
+// submodule that leads outside the repository is an error.
+func findSubmodules(repoPath string) ([]Submodule, error) {
+	gitRepo, prefix, err := git.Discover(repoPath)
+	if err != nil {
+		return nil, nil
+	}
+	defer gitRepo.Close()
+	if gitRepo.Bare {
+		return nil, nil
+	}
+	workTree, err := filepath.Abs(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" {
+		workTree = strings.TrimSuffix(workTree, string(filepath.Separator)+filepath.FromSlash(prefix))
+	}
+	data, err := os.ReadFile(filepath.Join(workTree, ".gitmodules"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading .gitmodules: %w", err)
+	}
+	entries, err := git.ParseGitmodules(data)
+	if err != nil {
+		return nil, fmt.Errorf("error reading .gitmodules: %w", err)
+	}
+	// The pinned commits are the submodule entries of the HEAD tree. A new
+	// repository has no HEAD yet, which leaves them unknown.
+	var tree git.Hash
+	if head, err := gitRepo.Head(); err == nil {
+		if commit, err := gitRepo.Commit(head); err == nil {
+			tree = commit.Tree
+		}
+	}
+	realRoot, err := filepath.EvalSymlinks(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	var submodules []Submodule
+	for _, entry := range entries {
+		rel, ok := relativeToPrefix(entry.Path, prefix)
+		if !ok {
+			continue
+		}
+		sub := Submodule{Path: rel, URL: entry.URL}
+		dir := filepath.Join(repoPath, filepath.FromSlash(rel))
+		// ParseGitmodules rejects paths with "..", but a symbolic link in
+		// the working tree could still lead elsewhere.
+		if real, err := filepath.EvalSymlinks(dir); err == nil && !within(realRoot, real) {
+			return nil, fmt.Errorf("submodule %s: %w", rel, errOutsideRoot)
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			sub.Initialized = true
+			if subRepo, err := git.Open(dir); err == nil {
+				if head, err := subRepo.Head(); err == nil {
+					sub.CheckedOut = head.Short()
+				}
+				subRepo.Close()
+			}
+		}
+		if !tree.IsZero() {
+			if e, err := gitRepo.TreeEntryAt(tree, entry.Path); err == nil && e.Mode == git.ModeSubmodule {
+				sub.Commit = e.Hash.Short()
+			}
+		}
+		submodules = append(submodules, sub)
+	}
+	return submodules, nil
+}
+
+// processSubmodules reads the files of the submodules of the repository at
+// repoPath into repo, as selected by opts.Submodules, and records them in
+// repo.Submodules. The include and ignore lists of the repository apply to
+// the files of a submodule too, after its own.
+func processSubmodules(ctx context.Context, repoPath string, submodules []Submodule, includeList, ignoreList []string, repo *GitRepo, opts walkOptions) error {
+	if opts.Submodules == SkipSubmodules || len(submodules) == 0 {
+		return nil
+	}
+	m, err := newMatcher(includeList, ignoreList)
+	if err != nil {
+		return err
+	}
+	root, err := filepath.Abs(repoPath)
+	if err != nil {
+		root = repoPath
+	}
+	var nested []Submodule
+	for i := range submodules {
+		sub := &submodules[i]
+		if opts.Submodules != IncludeSubmodules || !sub.Initialized {
+			continue
+		}
+		dir := filepath.Join(repoPath, filepath.FromSlash(sub.Path))
+		subIgnore, err := LoadIgnoreList(dir, "", !opts.IgnoreGitignore)
+		if err != nil {
+			return err
+		}
+		// The .git of a submodule is a file pointing to its git directory.
+		subIgnore = append(subIgnore, ".git")
+		subInclude, err := LoadIncludeList(dir, "")
+		if err != nil {
+			return err
+		}
+		var subRepo GitRepo
+		if err := processRepository(ctx, dir, subInclude, subIgnore, &subRepo, opts); err != nil {
+			return err
+		}
+		for _, file := range subRepo.Files {
+			p := path.Join(sub.Path, filepath.ToSlash(file.Path))
+			if !m.match(p) {
+				continue
+			}
+			file.Path = filepath.FromSlash(p)
+			file.Root = root
+			// Files of nested submodules keep the commit of the innermost
+			// one.
+			if file.Submodule == "" {
+				file.SubmoduleCommit = sub.Commit
+			}
+			file.Submodule = path.Join(sub.Path, file.Submodule)
+			repo.Files = append(repo.Files, file)
+		}
+		for _, skipped := range subRepo.Skipped {
+			skipped.Path = filepath.Join(filepath.FromSlash(sub.Path), skipped.Path)
+			repo.Skipped = append(repo.Skipped, skipped)
+		}
+		for _, s := range subRepo.Submodules {
+			s.Path = path.Join(sub.Path, s.Path)
+			nested = append(nested, s)
+		}
+		sub.Included = true
+	}
+	repo.Submodules = append(repo.Submodules, submodules...)
+	repo.Submodules = append(repo.Submodules, nested...)
+	repo.FileCount = len(repo.Files)
+	return nil
+}
+
+// submoduleText lists the submodules for the preamble, so the model knows
+// about code that is not part of the output.
+func submoduleText(submodules []Submodule) string {
+	if len(submodules) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("The repository has git submodules, shown at the commits it pins. The files of an included submodule are listed under its path, as checked out, and their path lines start with the submodule and its pinned commit in brackets; the other submodules are not part of this text.\n")
+	for _, s := range submodules {
+		b.WriteString("- " + s.Path)
+		if s.Commit != "" {
+			b.WriteString(" at " + s.Commit)
+		}
+		if s.URL != "" {
+			b.WriteString(" (" + s.URL + ")")
+		}
+		switch {
+		case s.Included:
+			b.WriteString(": included")
+		case !s.Initialized:
+			b.WriteString(": not checked out")
+		default:
+			b.WriteString(": not included")
+		}
+		switch {
+		case s.CheckedOut == "" || s.CheckedOut == s.Commit:
+		case s.Commit == "":
+			b.WriteString(", checked out at " + s.CheckedOut)
+		default:
+			b.WriteString(", but checked out at " + s.CheckedOut + ", not the pinned commit")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// writeSubmodulesXML writes the submodules element of the XML output.
+func writeSubmodulesXML(b *strings.Builder, submodules []Submodule) {
+	b.WriteString("    <submodules>\n")
+	for _, s := range submodules {
+		b.WriteString("        <submodule>\n")
+		b.WriteString(fmt.Sprintf("            <path>%s</path>\n", escapeXML(s.Path)))
+		if s.URL != "" {
+			b.WriteString(fmt.Sprintf("            <url>%s</url>\n", escapeXML(s.URL)))
+		}
+		if s.Commit != "" {
+			b.WriteString(fmt.Sprintf("            <commit>%s</commit>\n", escapeXML(s.Commit)))
+		}
+		if s.CheckedOut != "" {
+			b.WriteString(fmt.Sprintf("            <checked_out>%s</checked_out>\n", escapeXML(s.CheckedOut)))
+		}
+		b.WriteString(fmt.Sprintf("            <initialized>%t</initialized>\n", s.Initialized))
+		b.WriteString(fmt.Sprintf("            <included>%t</included>\n", s.Included))
+		b.WriteString("        </submodule>\n")
+	}
+	b.WriteString("    </submodules>\n")
+}
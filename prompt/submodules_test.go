@@ -0,0 +1,243 @@
+package prompt
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeObject stores a loose git object in the objects directory and
+// returns its hash.
+func writeObject(t *testing.T, objects, kind string, data []byte) []byte {
+	t.Helper()
+	object := append([]byte(fmt.Sprintf("%s %d\x00", kind, len(data))), data...)
+	sum := sha1.Sum(object)
+	hash := hex.EncodeToString(sum[:])
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(object)
+	zw.Close()
+	path := filepath.Join(objects, hash[:2], hash[2:])
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, compressed.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return sum[:]
+}
+
+// writeSubmoduleRepo lays out a working tree with one checked out and one
+// missing submodule. The git directories hold just enough for them to be
+// recognized: the repository's HEAD commit pins both submodules, and the
+// checked out one is at another commit. It returns the short hashes of the
+// pinned and the checked out commits.
+func writeSubmoduleRepo(t *testing.T) (string, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		".git/HEAD":               "ref: refs/heads/main\n",
+		".gitignore":              "lib/sub/*.tmp\n",
+		".gitmodules":             "[submodule \"sub\"]\n\tpath = lib/sub\n\turl = https://example.com/sub.git\n[submodule \"missing\"]\n\tpath = lib/missing\n\turl = https://example.com/missing.git\n",
+		"main.go":                 "package main\n",
+		"lib/sub/.git":            "gitdir: ../../.git/modules/sub\n",
+		"lib/sub/.gitignore":      "*.log\n",
+		"lib/sub/.gptignore":      "secret.txt\n",
+		"lib/sub/sub.go":          "package sub\n",
+		"lib/sub/build.log":       "noise\n",
+		"lib/sub/secret.txt":      "hidden\n",
+		"lib/sub/cache.tmp":       "parent rules apply\n",
+		"lib/missing/.keep-empty": "",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The submodule has a detached HEAD at a loose commit object.
+	checkedOut := writeObject(t, filepath.Join(dir, ".git/modules/sub/objects"), "commit", []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nsubmodule commit\n"))
+	if err := os.WriteFile(filepath.Join(dir, ".git/modules/sub/HEAD"), []byte(hex.EncodeToString(checkedOut)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The repository pins commits whose objects live in the submodules.
+	objects := filepath.Join(dir, ".git/objects")
+	pinned := bytes.Repeat([]byte{0x11}, 20)
+	lib := writeObject(t, objects, "tree", append(append(append([]byte("160000 missing\x00"), bytes.Repeat([]byte{0x22}, 20)...), "160000 sub\x00"...), pinned...))
+	root := writeObject(t, objects, "tree", append([]byte("40000 lib\x00"), lib...))
+	commit := writeObject(t, objects, "commit", []byte("tree "+hex.EncodeToString(root)+"\n\nsuperproject commit\n"))
+	if err := os.MkdirAll(filepath.Join(dir, ".git/refs/heads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".git/refs/heads/main"), []byte(hex.EncodeToString(commit)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// An uninitialized submodule is an empty directory.
+	if err := os.Remove(filepath.Join(dir, "lib/missing/.keep-empty")); err != nil {
+		t.Fatal(err)
+	}
+	return dir, hex.EncodeToString(pinned)[:7], hex.EncodeToString(checkedOut)[:7]
+}
+
+func TestSubmodules(t *testing.T) {
+	dir, pinned, checkedOut := writeSubmoduleRepo(t)
+	ignoreList, err := LoadIgnoreList(dir, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	process := func(mode SubmoduleMode) *GitRepo {
+		t.Helper()
+		repo, err := ProcessGitRepoContext(context.Background(), dir, nil, ignoreList, ProcessOptions{Submodules: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	}
+	paths := func(repo *GitRepo) []string {
+		var paths []string
+		for _, f := range repo.Files {
+			paths = append(paths, filepath.ToSlash(f.Path)+"@"+f.Submodule)
+		}
+		return paths
+	}
+
+	repo := process(IncludeSubmodules)
+	if want := []string{".gitmodules@", "lib/sub/sub.go@lib/sub", "main.go@"}; !reflect.DeepEqual(paths(repo), want) {
+		t.Errorf("include: files = %q, want %q", paths(repo), want)
+	}
+	want := []Submodule{
+		{Path: "lib/sub", URL: "https://example.com/sub.git", Commit: pinned, CheckedOut: checkedOut, Initialized: true, Included: true},
+		{Path: "lib/missing", URL: "https://example.com/missing.git", Commit: "2222222"},
+	}
+	if !reflect.DeepEqual(repo.Submodules, want) {
+		t.Errorf("include: submodules = %+v, want %+v", repo.Submodules, want)
+	}
+	output, err := RenderRepo(repo, FormatText, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"- lib/sub at " + pinned + " (https://example.com/sub.git): included, but checked out at " + checkedOut + ", not the pinned commit\n",
+		"- lib/missing at 2222222 (https://example.com/missing.git): not checked out\n",
+		// Files of a submodule carry its path and pinned commit.
+		"\n[lib/sub@" + pinned + "] " + filepath.Join("lib", "sub", "sub.go") + "\n",
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("text output lacks %q:\n%s", line, output)
+		}
+	}
+	output, err = RenderRepo(repo, FormatXML, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "<submodule>lib/sub</submodule>") || !strings.Contains(output, "<submodule_commit>"+pinned+"</submodule_commit>") || !strings.Contains(output, "<path>lib/missing</path>") {
+		t.Errorf("XML output lacks the submodules:\n%s", output)
+	}
+
+	output, err = RenderRepo(repo, FormatJSON, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, `"submodule":"lib/sub","submodule_commit":"`+pinned+`"`) {
+		t.Errorf("JSON output lacks the submodule commit of its files:\n%s", output)
+	}
+	output, err = RenderRepo(repo, FormatAnthropic, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, `"context":"Submodule lib/sub at `+pinned+`"`) {
+		t.Errorf("Anthropic request lacks the submodule commit of its files:\n%s", output)
+	}
+
+	repo = process(ListSubmodules)
+	if want := []string{".gitmodules@", "main.go@"}; !reflect.DeepEqual(paths(repo), want) {
+		t.Errorf("list: files = %q, want %q", paths(repo), want)
+	}
+	if len(repo.Submodules) != 2 || repo.Submodules[0].Included {
+		t.Errorf("list: submodules = %+v", repo.Submodules)
+	}
+
+	repo = process(SkipSubmodules)
+	if want := []string{".gitmodules@", "main.go@"}; !reflect.DeepEqual(paths(repo), want) || len(repo.Submodules) != 0 {
+		t.Errorf("skip: files = %q, submodules = %+v", paths(repo), repo.Submodules)
+	}
+
+	// The wrappers without options apply the .gitignore of submodules too.
+	repo, err = ProcessGitRepo(dir, nil, ignoreList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{".gitmodules@", "lib/sub/sub.go@lib/sub", "main.go@"}; !reflect.DeepEqual(paths(repo), want) {
+		t.Errorf("ProcessGitRepo: files = %q, want %q", paths(repo), want)
+	}
+	repo, err = ProcessGitRepoContext(context.Background(), dir, nil, ignoreList, ProcessOptions{IgnoreGitignore: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{".gitmodules@", "lib/sub/build.log@lib/sub", "lib/sub/sub.go@lib/sub", "main.go@"}; !reflect.DeepEqual(paths(repo), want) {
+		t.Errorf("IgnoreGitignore: files = %q, want %q", paths(repo), want)
+	}
+
+	if _, err := ParseSubmoduleMode("all"); err == nil {
+		t.Error("ParseSubmoduleMode accepted an unknown mode")
+	}
+}
+
+func TestHostileSubmodulePaths(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "repo")
+	for name, contents := range map[string]string{
+		"repo/.git/HEAD":          "ref: refs/heads/main\n",
+		"repo/.git/objects/.keep": "",
+		"repo/main.go":            "package main\n",
+		"sibling/.git":            "gitdir: elsewhere\n",
+		"sibling/secret.env":      "SECRET=1\n",
+		"outside/.git":            "gitdir: elsewhere\n",
+		"outside/secret.env":      "SECRET=2\n",
+	} {
+		p := filepath.Join(parent, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitmodules := filepath.Join(dir, ".gitmodules")
+	for _, modules := range []string{
+		"[submodule \"x\"]\n\tpath = ../sibling\n",
+		"[submodule \"x\"]\n\tpath = lib/../../sibling\n",
+		"[submodule \"x\"]\n\tpath = " + filepath.ToSlash(filepath.Join(parent, "sibling")) + "\n",
+	} {
+		if err := os.WriteFile(gitmodules, []byte(modules), 0644); err != nil {
+			t.Fatal(err)
+		}
+		repo, err := ProcessGitRepoContext(context.Background(), dir, nil, nil, ProcessOptions{})
+		if err == nil {
+			t.Errorf("%q was accepted, files %+v", modules, repo.Files)
+		}
+	}
+
+	// A path inside the working tree that is a link to a directory outside
+	// it is rejected too.
+	if err := os.Symlink(filepath.Join(parent, "outside"), filepath.Join(dir, "vendored")); err != nil {
+		t.Skipf("symbolic links not supported: %v", err)
+	}
+	if err := os.WriteFile(gitmodules, []byte("[submodule \"x\"]\n\tpath = vendored\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if repo, err := ProcessGitRepoContext(context.Background(), dir, nil, nil, ProcessOptions{}); !errors.Is(err, errOutsideRoot) {
+		t.Errorf("a linked submodule outside the repository: %v, files %+v", err, repo)
+	}
+}
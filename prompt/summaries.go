@@ -0,0 +1,107 @@
+package prompt
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Summarizer writes a short summary of a file, typically by asking a model.
+type Summarizer interface {
+	// Name identifies the model and instructions. Summaries are cached under
+	// it together with the contents, so it must change when they do.
+	Name() string
+	Summarize(ctx context.Context, path, contents string) (string, error)
+}
+
+// SummaryOptions controls SummarizeFiles.
+type SummaryOptions struct {
+	// Patterns select the files to summarize, in .gptignore syntax and
+	// matched against slash separated paths.
+	Patterns []string
+	// Cache stores summaries between runs, so they are only requested once
+	// per contents and model and are available offline. They are kept apart
+	// from the token counts and survive pruning. Nil disables it.
+	Cache *DiskCache
+	// Concurrency is the number of files summarized at once; values below 1
+	// mean 1.
+	Concurrency int
+	// OnError decides what happens when a summary cannot be obtained:
+	// FailOnError stops, the other policies keep the full contents.
+	OnError   ErrorPolicy
+	Tokenizer Tokenizer
+}
+
+// SummaryPrefix starts the contents of summarized files, so the model can
+// tell a summary from the file itself in every output format.
+const SummaryPrefix = "Summary: "
+
+// SummarizeFiles replaces the contents of the files of repo that match
+// opts.Patterns with summaries, marking them with Summary. Cached summaries
+// are used without contacting the summarizer. Token counts are updated.
+func SummarizeFiles(ctx context.Context, repo *GitRepo, s Summarizer, opts SummaryOptions) error {
+	globs, err := compilePatterns(opts.Patterns)
+	if err != nil {
+		return err
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	var selected []int
+	for i, file := range repo.Files {
+		if !file.Summary && matchAny(globs, filepath.ToSlash(file.Path)) {
+			selected = append(selected, i)
+		}
+	}
+
+	summaries := make([]string, len(repo.Files))
+	errs := make([]error, len(repo.Files))
+	sem := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+	for _, i := range selected {
+		file := repo.Files[i]
+		key := cacheKey("summary", s.Name(), file.Contents)
+		if entry, ok := opts.Cache.getSummary(key); ok && entry.Contents != nil {
+			summaries[i] = string(*entry.Contents)
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, file GitFile, key string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			summary, err := s.Summarize(ctx, filepath.ToSlash(file.Path), file.Contents)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			data := []byte(summary)
+			opts.Cache.putSummary(key, diskCacheEntry{Contents: &data})
+			summaries[i] = summary
+		}(i, file, key)
+	}
+	wg.Wait()
+
+	for _, i := range selected {
+		file := &repo.Files[i]
+		if errs[i] != nil {
+			err := fmt.Errorf("error summarizing %s: %w", file.Path, errs[i])
+			if ctx.Err() != nil {
+				return &CanceledError{Err: ctx.Err()}
+			}
+			if opts.OnError == FailOnError {
+				return err
+			}
+			if opts.OnError == WarnOnError {
+				fmt.Fprintf(os.Stderr, "Warning: %s; keeping the full contents\n", err)
+			}
+			continue
+		}
+		file.Contents = SummaryPrefix + summaries[i]
+		file.Summary = true
+		file.Tokens = countTokens(opts.Tokenizer, file.Contents)
+	}
+	return nil
+}
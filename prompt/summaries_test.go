@@ -0,0 +1,85 @@
+package prompt
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeSummarizer summarizes a file by its first word, or fails when offline.
+type fakeSummarizer struct {
+	model   string
+	offline bool
+	calls   int32
+}
+
+func (s *fakeSummarizer) Name() string { return "fake:" + s.model }
+
+func (s *fakeSummarizer) Summarize(ctx context.Context, path, contents string) (string, error) {
+	atomic.AddInt32(&s.calls, 1)
+	if s.offline {
+		return "", errors.New("connection refused")
+	}
+	return path + " starts with " + strings.Fields(contents)[0], nil
+}
+
+func TestSummarizeFiles(t *testing.T) {
+	cache, err := OpenDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRepo := func() *GitRepo {
+		return &GitRepo{Files: []GitFile{
+			{Path: "main.go", Contents: "package main"},
+			{Path: "docs/a.md", Contents: "alpha beta gamma"},
+			{Path: "docs/b.md", Contents: "beta gamma"},
+		}}
+	}
+	opts := SummaryOptions{Patterns: []string{"docs/**"}, Cache: cache, Concurrency: 2, Tokenizer: wordTokenizer{}}
+
+	online := &fakeSummarizer{model: "m1"}
+	repo := newRepo()
+	if err := SummarizeFiles(context.Background(), repo, online, opts); err != nil {
+		t.Fatal(err)
+	}
+	if repo.Files[0].Summary || !repo.Files[1].Summary || repo.Files[1].Contents != "Summary: docs/a.md starts with alpha" {
+		t.Errorf("files = %+v", repo.Files)
+	}
+	if repo.Files[1].Tokens != 5 || online.calls != 2 {
+		t.Errorf("tokens %d, calls %d", repo.Files[1].Tokens, online.calls)
+	}
+
+	// Pruning the cache down to nothing keeps the summaries.
+	if _, err := cache.Prune(1, time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cached summaries are used without contacting the summarizer.
+	offline := &fakeSummarizer{model: "m1", offline: true}
+	repo = newRepo()
+	if err := SummarizeFiles(context.Background(), repo, offline, opts); err != nil {
+		t.Fatalf("cached summaries were not reused offline: %v", err)
+	}
+	if offline.calls != 0 || repo.Files[2].Contents != "Summary: docs/b.md starts with beta" {
+		t.Errorf("calls %d, files %+v", offline.calls, repo.Files)
+	}
+
+	// Another model or changed contents need a new summary.
+	other := &fakeSummarizer{model: "m2", offline: true}
+	repo = newRepo()
+	if err := SummarizeFiles(context.Background(), repo, other, opts); err == nil {
+		t.Error("missing summary did not fail under FailOnError")
+	}
+	repo = newRepo()
+	repo.Files[1].Contents = "changed"
+	opts.OnError = SkipOnError
+	if err := SummarizeFiles(context.Background(), repo, offline, opts); err != nil {
+		t.Fatal(err)
+	}
+	if repo.Files[1].Summary || repo.Files[1].Contents != "changed" || !repo.Files[2].Summary {
+		t.Errorf("SkipOnError: %+v", repo.Files)
+	}
+}
@@ -0,0 +1,177 @@
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkPolicy decides how symbolic links found while walking a working
+// tree are read. Links that the follow policies would read but that lead
+// outside the repository are skipped with a warning, whatever the error
+// policy.
+type SymlinkPolicy int
+
+const (
+	// FollowFileSymlinks reads linked files whose targets are inside the
+	// repository, but does not walk linked directories. It is the default.
+	FollowFileSymlinks SymlinkPolicy = iota
+	// FollowSymlinks also walks linked directories inside the repository.
+	// Links back into a directory being walked are left out.
+	FollowSymlinks
+	// SkipSymlinks leaves symbolic links out.
+	SkipSymlinks
+	// RecordSymlinks outputs every link as a file holding its target, in
+	// GitFile.Symlink, without reading what it points to.
+	RecordSymlinks
+)
+
+// ParseSymlinkPolicy parses the values of --symlinks: files, follow, skip or
+// record.
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	switch s {
+	case "files", "":
+		return FollowFileSymlinks, nil
+	case "follow":
+		return FollowSymlinks, nil
+	case "skip":
+		return SkipSymlinks, nil
+	case "record":
+		return RecordSymlinks, nil
+	}
+	return FollowFileSymlinks, fmt.Errorf("unknown symlink policy %q, expected files, follow, skip or record", s)
+}
+
+func (p SymlinkPolicy) String() string {
+	switch p {
+	case FollowSymlinks:
+		return "follow"
+	case SkipSymlinks:
+		return "skip"
+	case RecordSymlinks:
+		return "record"
+	}
+	return "files"
+}
+
+// Set parses s like ParseSymlinkPolicy, so a SymlinkPolicy can be used as a
+// command line flag.
+func (p *SymlinkPolicy) Set(s string) error {
+	policy, err := ParseSymlinkPolicy(s)
+	if err != nil {
+		return err
+	}
+	*p = policy
+	return nil
+}
+
+// Type names the flag type in help output.
+func (p *SymlinkPolicy) Type() string {
+	return "policy"
+}
+
+// errOutsideRoot is the reason a followed link that leads outside the
+// repository is not read.
+var errOutsideRoot = errors.New("symbolic link leads outside the repository")
+
+// symlinkContents is what a recorded link holds in the plain text output.
+const symlinkContents = "symbolic link to %s"
+
+// symlink handles the symbolic link path according to the policy. chain
+// holds the real paths of the linked directories followed to reach it.
+func (w *fsWalker) symlink(path string, chain []string) error {
+	name := filepath.Join(w.opts.osRoot, filepath.FromSlash(path))
+	switch w.opts.Symlinks {
+	case SkipSymlinks:
+		return nil
+	case RecordSymlinks:
+		return w.recordSymlink(path, func() (string, error) {
+			target, err := os.Readlink(name)
+			return filepath.ToSlash(target), err
+		})
+	}
+
+	// Ignored links are left alone before anything is resolved, so a link
+	// leading outside, such as bazel-out, never fails the run.
+	if w.m.ignored(path) || w.skipDir(path) {
+		return nil
+	}
+	real, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		// A dangling link, or a loop of links.
+		return handleFileError(w.opts.OnError, w.repo, path, err)
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		return handleFileError(w.opts.OnError, w.repo, path, err)
+	}
+	if info.IsDir() && w.opts.Symlinks != FollowSymlinks {
+		return nil
+	}
+	if !within(w.realRoot, real) {
+		// Only links that would be read are reported.
+		if !info.IsDir() && !w.m.match(path) {
+			return nil
+		}
+		return handleFileError(WarnOnError, w.repo, path, errOutsideRoot)
+	}
+	if !info.IsDir() {
+		return w.file(path, func() (fs.FileInfo, error) { return info, nil })
+	}
+	// Following a link to a directory that contains the link, or that was
+	// followed to get here, would walk the same files forever.
+	parent, err := filepath.EvalSymlinks(filepath.Dir(name))
+	if err != nil || within(real, parent) {
+		return nil
+	}
+	for _, dir := range chain {
+		if within(real, dir) {
+			return nil
+		}
+	}
+	return w.walk(path, append(chain[:len(chain):len(chain)], real))
+}
+
+// within reports whether the path p is dir or inside it.
+func within(dir, p string) bool {
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// linkFS is a file system that stores symbolic links without being able to
+// resolve them, such as the tree of a commit.
+type linkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+}
+
+// storedSymlink handles the symbolic link path of a linkFS, which is only
+// output when recorded.
+func (w *fsWalker) storedSymlink(path string, links linkFS) error {
+	if w.opts.Symlinks != RecordSymlinks {
+		return nil
+	}
+	return w.recordSymlink(path, func() (string, error) { return links.ReadLink(path) })
+}
+
+// recordSymlink outputs the link path, if selected, as a file holding the
+// target that readlink returns.
+func (w *fsWalker) recordSymlink(path string, readlink func() (string, error)) error {
+	w.progress.FilesScanned++
+	defer func() { w.opts.report(w.progress) }()
+	if !w.m.match(path) {
+		return nil
+	}
+	target, err := readlink()
+	if err != nil {
+		return handleFileError(w.opts.OnError, w.repo, path, err)
+	}
+	file := GitFile{Path: path, Symlink: target}
+	file.Contents = fmt.Sprintf(symlinkContents, file.Symlink)
+	file.setSource([]byte(file.Symlink))
+	file.Tokens = countTokens(w.opts.Tokenizer, file.Contents)
+	addFile(w.repo, file, &w.progress)
+	return nil
+}
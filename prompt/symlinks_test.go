@@ -0,0 +1,168 @@
+package prompt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSymlinkPolicies(t *testing.T) {
+	root := t.TempDir()
+	repoDir := filepath.Join(root, "repo")
+	for name, contents := range map[string]string{
+		"outside/secret.txt": "outside\n",
+		"repo/main.go":       "package main\n",
+		"repo/src/util.go":   "package src\n",
+		"repo/a/x.txt":       "x\n",
+		"repo/b/.keep":       "",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"link.go":    "src/util.go",
+		"escape.txt": "../outside/secret.txt",
+		"srclink":    "src",
+		"src/loop":   "..",
+		"a/tob":      "../b",
+		"b/toa":      "../a",
+	} {
+		if err := os.Symlink(filepath.FromSlash(target), filepath.Join(repoDir, filepath.FromSlash(link))); err != nil {
+			t.Skipf("symbolic links not supported: %v", err)
+		}
+	}
+	ignoreList := []string{"b/.keep", "**/.keep"}
+
+	for _, tt := range []struct {
+		policy SymlinkPolicy
+		want   []string
+	}{
+		{FollowSymlinks, []string{"a/tob/toa/x.txt", "a/x.txt", "b/toa/x.txt", "link.go", "main.go", "src/util.go", "srclink/util.go"}},
+		{SkipSymlinks, []string{"a/x.txt", "main.go", "src/util.go"}},
+		{RecordSymlinks, []string{"a/tob -> ../b", "a/x.txt", "b/toa -> ../a", "escape.txt -> ../outside/secret.txt", "link.go -> src/util.go", "main.go", "src/loop -> ..", "src/util.go", "srclink -> src"}},
+	} {
+		repo, err := ProcessGitRepoContext(context.Background(), repoDir, nil, ignoreList, ProcessOptions{Symlinks: tt.policy, OnError: SkipOnError})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.policy, err)
+		}
+		var got []string
+		for _, f := range repo.Files {
+			entry := filepath.ToSlash(f.Path)
+			if f.Symlink != "" {
+				entry += " -> " + f.Symlink
+				if f.Contents != "symbolic link to "+f.Symlink {
+					t.Errorf("%s: %s holds %q", tt.policy, entry, f.Contents)
+				}
+			}
+			got = append(got, entry)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: files = %q, want %q", tt.policy, got, tt.want)
+		}
+		// A followed link out of the repository is reported, not dropped.
+		escaped := len(repo.Skipped) == 1 && repo.Skipped[0].Path == "escape.txt" && repo.Skipped[0].Reason == errOutsideRoot.Error()
+		if escaped != (tt.policy == FollowSymlinks) {
+			t.Errorf("%s: skipped = %+v", tt.policy, repo.Skipped)
+		}
+	}
+	// The default reads linked files but not linked directories, and a link
+	// out of the repository is skipped even with --on-error fail.
+	repo, err := ProcessGitRepoContext(context.Background(), repoDir, nil, ignoreList, ProcessOptions{})
+	if err != nil {
+		t.Fatalf("default policy: %v", err)
+	}
+	var got []string
+	for _, f := range repo.Files {
+		got = append(got, filepath.ToSlash(f.Path))
+	}
+	if want := []string{"a/x.txt", "link.go", "main.go", "src/util.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("default policy: files = %q, want %q", got, want)
+	}
+	if len(repo.Skipped) != 1 || repo.Skipped[0].Reason != errOutsideRoot.Error() {
+		t.Errorf("default policy: skipped = %+v", repo.Skipped)
+	}
+	if _, err := ProcessGitRepoContext(context.Background(), repoDir, nil, append(ignoreList, "escape.txt"), ProcessOptions{}); err != nil {
+		t.Errorf("an ignored link out of the repository was reported: %v", err)
+	}
+
+	// Snapshot of an os.DirFS applies the same policies and confinement.
+	for _, tt := range []struct {
+		policy SymlinkPolicy
+		want   []string
+	}{
+		{FollowSymlinks, []string{"a/tob/toa/x.txt", "a/x.txt", "b/toa/x.txt", "link.go", "main.go", "src/util.go", "srclink/util.go"}},
+		{RecordSymlinks, []string{"a/tob", "a/x.txt", "b/toa", "escape.txt", "link.go", "main.go", "src/loop", "src/util.go", "srclink"}},
+	} {
+		result, err := Snapshot(context.Background(), os.DirFS(repoDir), Options{Ignore: ignoreList, Symlinks: tt.policy, OnError: SkipOnError, Tokenizer: wordTokenizer{}})
+		if err != nil {
+			t.Fatalf("Snapshot %s: %v", tt.policy, err)
+		}
+		var got []string
+		for _, f := range result.Repo.Files {
+			got = append(got, f.Path)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Snapshot %s: files = %q, want %q", tt.policy, got, tt.want)
+		}
+	}
+
+	if err := os.Symlink("missing.txt", filepath.Join(repoDir, "dangling.txt")); err != nil {
+		t.Fatal(err)
+	}
+	repo, err = ProcessGitRepoContext(context.Background(), repoDir, nil, ignoreList, ProcessOptions{OnError: SkipOnError})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.Skipped) != 2 || repo.Skipped[0].Path != "dangling.txt" || repo.Skipped[1].Path != "escape.txt" {
+		t.Errorf("skipped = %+v, want the dangling and the escaping link", repo.Skipped)
+	}
+}
+
+func TestIgnoredSymlinksAreNotResolved(t *testing.T) {
+	root := t.TempDir()
+	repoDir := filepath.Join(root, "repo")
+	for name, contents := range map[string]string{
+		"outside/out.txt": "build output\n",
+		"repo/main.go":    "package main\n",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The links of a Bazel workspace lead to its shared output directories.
+	if err := os.Symlink(filepath.Join(root, "outside"), filepath.Join(repoDir, "bazel-out")); err != nil {
+		t.Skipf("symbolic links not supported: %v", err)
+	}
+	for _, policy := range []SymlinkPolicy{FollowFileSymlinks, FollowSymlinks} {
+		repo, err := ProcessGitRepoContext(context.Background(), repoDir, nil, []string{"bazel-*"}, ProcessOptions{Symlinks: policy})
+		if err != nil {
+			t.Fatalf("%s: %v", policy, err)
+		}
+		if len(repo.Files) != 1 || len(repo.Skipped) != 0 {
+			t.Errorf("%s: files %+v, skipped %+v", policy, repo.Files, repo.Skipped)
+		}
+	}
+	// Not ignored, the linked directory is only reported when it would be
+	// walked.
+	repo, err := ProcessGitRepoContext(context.Background(), repoDir, nil, nil, ProcessOptions{})
+	if err != nil || len(repo.Skipped) != 0 {
+		t.Errorf("default policy: %v, skipped %+v", err, repo)
+	}
+	repo, err = ProcessGitRepoContext(context.Background(), repoDir, nil, nil, ProcessOptions{Symlinks: FollowSymlinks})
+	if err != nil || len(repo.Skipped) != 1 || repo.Skipped[0].Path != "bazel-out" {
+		t.Errorf("follow: %v, skipped %+v", err, repo)
+	}
+}
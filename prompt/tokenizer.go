@@ -0,0 +1,107 @@
+package prompt
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// Tokenizer counts the tokens a model would see for a text.
+type Tokenizer interface {
+	// Name identifies the tokenizer, for example in cache keys.
+	Name() string
+	CountTokens(text string) (int64, error)
+}
+
+// DefaultTokenizer is the tokenizer used when none is chosen: tiktoken's
+// cl100k_base encoding, as used by GPT-3.5 and GPT-4.
+var DefaultTokenizer = NewTiktokenTokenizer("cl100k_base")
+
+type tiktokenTokenizer struct {
+	encoding string
+	mu       sync.Mutex
+	tke      *tiktoken.Tiktoken
+}
+
+// NewTiktokenTokenizer returns a tokenizer for a tiktoken encoding: cl100k_base,
+// o200k_base, p50k_base, p50k_edit or r50k_base. The encoding is loaded on first
+// use; a failed load is retried on the next call.
+func NewTiktokenTokenizer(encoding string) Tokenizer {
+	return &tiktokenTokenizer{encoding: encoding}
+}
+
+func (t *tiktokenTokenizer) Name() string {
+	return "tiktoken:" + t.encoding
+}
+
+func (t *tiktokenTokenizer) CountTokens(text string) (int64, error) {
+	t.mu.Lock()
+	tke := t.tke
+	if tke == nil {
+		var err error
+		tke, err = getEncoding(t.encoding)
+		if err != nil {
+			t.mu.Unlock()
+			return 0, err
+		}
+		t.tke = tke
+	}
+	t.mu.Unlock()
+	return int64(len(tke.Encode(text, nil, nil))), nil
+}
+
+// o200kRanks is where the ranks of o200k_base are loaded from. Like those
+// of the encodings tiktoken-go knows, they are downloaded on first use and
+// cached in TIKTOKEN_CACHE_DIR.
+var o200kRanks = "https://openaipublic.blob.core.windows.net/encodings/o200k_base.tiktoken"
+
+// o200kPattern splits text into the pieces o200k_base encodes separately,
+// as in OpenAI's tiktoken.
+const o200kPattern = `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+	`|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+	`|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+
+// getEncoding loads a tiktoken encoding. tiktoken-go does not include
+// o200k_base, the encoding of GPT-4o and later OpenAI models, so it is
+// built here from its published ranks.
+func getEncoding(encoding string) (*tiktoken.Tiktoken, error) {
+	if encoding != "o200k_base" {
+		return tiktoken.GetEncoding(encoding)
+	}
+	ranks, err := tiktoken.NewDefaultBpeLoader().LoadTiktokenBpe(o200kRanks)
+	if err != nil {
+		return nil, err
+	}
+	special := map[string]int{tiktoken.ENDOFTEXT: 199999, tiktoken.ENDOFPROMPT: 200018}
+	bpe, err := tiktoken.NewCoreBPE(ranks, special, o200kPattern)
+	if err != nil {
+		return nil, err
+	}
+	enc := &tiktoken.Encoding{Name: encoding, PatStr: o200kPattern, MergeableRanks: ranks, SpecialTokens: special}
+	specialSet := map[string]any{}
+	for token := range special {
+		specialSet[token] = true
+	}
+	return tiktoken.NewTiktoken(bpe, enc, specialSet), nil
+}
+
+// countTokens counts the tokens of text with tok, reporting failures as zero
+// tokens. A nil tok means DefaultTokenizer.
+func countTokens(tok Tokenizer, text string) int64 {
+	if tok == nil {
+		tok = DefaultTokenizer
+	}
+	n, err := tok.CountTokens(text)
+	if err != nil {
+		// Report on stderr: stdout may carry a protocol stream (git2gpt mcp).
+		fmt.Fprintln(os.Stderr, "Error getting encoding:", err)
+		return 0
+	}
+	return n
+}
+
+func EstimateTokens(output string) int64 {
+	return countTokens(DefaultTokenizer, output)
+}
@@ -0,0 +1,335 @@
+package prompt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+
+	"github.com/chand1012/git2gpt/git"
+)
+
+// GitTree is the file tree of a single commit, read from the git object
+// database instead of the working tree.
+type GitTree struct {
+	repo   *git.Repository
+	path   string // as given to OpenGitTree
+	prefix string
+	Commit git.Hash
+	files  []treeFile
+	dirs   map[string]bool
+}
+
+type treeFile struct {
+	path  string
+	entry git.TreeEntry
+}
+
+// IsBareSource reports whether path is a bare repository or a git bundle,
+// which have no working tree to walk and are read with OpenGitTree.
+func IsBareSource(path string) bool {
+	if git.IsBundle(path) {
+		return true
+	}
+	repo, err := git.Open(path)
+	if err != nil {
+		return false
+	}
+	defer repo.Close()
+	return repo.Bare
+}
+
+// OpenGitTree opens the tree of rev (a branch, tag, commit or "HEAD") in the
+// repository containing repoPath, which may also be a bare repository or a
+// bundle. When repoPath is a subdirectory of the working tree, only files
+// below it are visible and paths are relative to it.
+func OpenGitTree(repoPath, rev string) (*GitTree, error) {
+	repo, prefix, err := git.Discover(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening git repository: %w", err)
+	}
+	t, err := newGitTree(repo, prefix, rev)
+	if err != nil {
+		repo.Close()
+		return nil, err
+	}
+	t.path = repoPath
+	return t, nil
+}
+
+func newGitTree(repo *git.Repository, prefix, rev string) (*GitTree, error) {
+	if rev == "" {
+		rev = "HEAD"
+	}
+	commitHash, err := repo.ResolveRef(rev)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s: %w", rev, err)
+	}
+	commit, err := repo.Commit(commitHash)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s: %w", rev, err)
+	}
+	t := &GitTree{repo: repo, prefix: prefix, Commit: commitHash, dirs: map[string]bool{}}
+	err = repo.WalkTree(commit.Tree, func(p string, entry git.TreeEntry) error {
+		rel, ok := relativeToPrefix(p, prefix)
+		if !ok {
+			return nil
+		}
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			t.dirs[dir] = true
+		}
+		t.files = append(t.files, treeFile{path: rel, entry: entry})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading tree of %s: %w", rev, err)
+	}
+	return t, nil
+}
+
+// Close releases the underlying repository.
+func (t *GitTree) Close() error {
+	return t.repo.Close()
+}
+
+// readPatternFile parses a pattern file stored in the tree. A missing file
+// yields no patterns.
+func (t *GitTree) readPatternFile(name string) ([]string, error) {
+	for _, f := range t.files {
+		if f.path != name {
+			continue
+		}
+		data, err := t.repo.ReadBlob(f.entry.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", name, err)
+		}
+		return parsePatterns(bytes.NewReader(data), name)
+	}
+	return nil, nil
+}
+
+// expandDirs appends "/**" to patterns that name a directory of the tree, the
+// way GenerateIgnoreList does for directories on disk.
+func (t *GitTree) expandDirs(patterns []string) []string {
+	var final []string
+	for _, pattern := range patterns {
+		if contains(final, pattern) {
+			continue
+		}
+		if t.dirs[pattern] {
+			pattern = path.Join(pattern, "**")
+		}
+		final = append(final, pattern)
+	}
+	return final
+}
+
+// IgnoreList is LoadIgnoreList for the tree. The .gptignore and .gitignore
+// files are read from the commit unless ignoreFilePath names a file on disk.
+func (t *GitTree) IgnoreList(ignoreFilePath string, useGitignore bool) ([]string, error) {
+	var ignoreList []string
+	var err error
+	if ignoreFilePath != "" {
+		ignoreList, err = getIgnoreList(ignoreFilePath)
+	} else {
+		ignoreList, err = t.readPatternFile(".gptignore")
+	}
+	if err != nil {
+		return nil, err
+	}
+	ignoreList = append(ignoreList, ".git/**", ".gitignore", ".gptignore", ".gptinclude")
+	if useGitignore {
+		gitignoreList, err := t.readPatternFile(".gitignore")
+		if err != nil {
+			return nil, err
+		}
+		ignoreList = append(ignoreList, gitignoreList...)
+	}
+	return t.expandDirs(ignoreList), nil
+}
+
+// IncludeList is LoadIncludeList for the tree.
+func (t *GitTree) IncludeList(includeFilePath string) ([]string, error) {
+	var includeList []string
+	var err error
+	if includeFilePath != "" {
+		includeList, err = getIncludeList(includeFilePath)
+	} else {
+		includeList, err = t.readPatternFile(".gptinclude")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t.expandDirs(includeList), nil
+}
+
+// Process is ProcessGitRepoContext for the tree, read by the same walk
+// through treeFS. Symbolic links are only output when recorded, since their
+// targets cannot be read from a tree, and submodules are skipped. The
+// OnError policy also covers objects that cannot be read, such as those an
+// incremental bundle builds on but does not hold. opts.Cache is not used.
+func (t *GitTree) Process(ctx context.Context, includeList, ignoreList []string, opts ProcessOptions) (*GitRepo, error) {
+	var repo GitRepo
+	walk := walkOptions{ProcessOptions: opts}
+	walk.Cache = nil
+	err := processFS(ctx, newTreeFS(t), includeList, ignoreList, &repo, walk)
+	localizePaths(&repo, t.path)
+	for i := range repo.Files {
+		repo.Files[i].Ref = t.Commit.String()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error processing %s at %s: %w", t.path, t.Commit.Short(), err)
+	}
+	return &repo, nil
+}
+
+// Submodules lists the submodules of the tree with their pinned commits.
+// Their objects live in other repositories, so they are never included.
+func (t *GitTree) Submodules() ([]Submodule, error) {
+	urls := map[string]string{}
+	commit, err := t.repo.Commit(t.Commit)
+	if err != nil {
+		return nil, err
+	}
+	if entry, err := t.repo.TreeEntryAt(commit.Tree, ".gitmodules"); err == nil {
+		data, err := t.repo.ReadBlob(entry.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("error reading .gitmodules: %w", err)
+		}
+		entries, err := git.ParseGitmodules(data)
+		if err != nil {
+			return nil, fmt.Errorf("error reading .gitmodules: %w", err)
+		}
+		for _, e := range entries {
+			if rel, ok := relativeToPrefix(e.Path, t.prefix); ok {
+				urls[rel] = e.URL
+			}
+		}
+	}
+	var submodules []Submodule
+	for _, f := range t.files {
+		if f.entry.Mode == git.ModeSubmodule {
+			submodules = append(submodules, Submodule{Path: f.path, URL: urls[f.path], Commit: f.entry.Hash.Short()})
+		}
+	}
+	return submodules, nil
+}
+
+// treeFS presents the files of a GitTree as a read-only file system. Blobs
+// are read when a file is opened. Symbolic links are listed with their
+// type, and ReadLink returns their targets; submodules are left out.
+type treeFS struct {
+	tree    *GitTree
+	entries map[string]git.TreeEntry // files and links by slash separated path
+	dirs    map[string][]fs.DirEntry // sorted as in the tree; "." is the root
+}
+
+func newTreeFS(t *GitTree) *treeFS {
+	fsys := &treeFS{tree: t, entries: map[string]git.TreeEntry{}, dirs: map[string][]fs.DirEntry{".": nil}}
+	for _, f := range t.files {
+		if f.entry.Mode != git.ModeFile && f.entry.Mode != git.ModeExecutable && f.entry.Mode != git.ModeSymlink {
+			continue
+		}
+		fsys.entries[f.path] = f.entry
+		fsys.addEntry(f.path, treeFileMode(f.entry.Mode))
+	}
+	for _, entries := range fsys.dirs {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	}
+	return fsys
+}
+
+// addEntry lists name in its directory, adding the directories above it.
+func (fsys *treeFS) addEntry(name string, mode fs.FileMode) {
+	dir := path.Dir(name)
+	if _, ok := fsys.dirs[dir]; !ok {
+		fsys.dirs[dir] = nil
+		fsys.addEntry(dir, fs.ModeDir|0755)
+	}
+	fsys.dirs[dir] = append(fsys.dirs[dir], treeDirEntry{fsys: fsys, path: name, mode: mode})
+}
+
+func treeFileMode(mode uint32) fs.FileMode {
+	switch mode {
+	case git.ModeExecutable:
+		return 0755
+	case git.ModeSymlink:
+		return fs.ModeSymlink | 0777
+	}
+	return 0644
+}
+
+func (fsys *treeFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if entries, ok := fsys.dirs[name]; ok {
+		return &openMemFile{memFile: &memFile{name: path.Base(name), mode: fs.ModeDir | 0755, entries: entries}, Reader: bytes.NewReader(nil)}, nil
+	}
+	data, err := fsys.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	f := &memFile{name: path.Base(name), data: data, mode: treeFileMode(fsys.entries[name].Mode)}
+	return &openMemFile{memFile: f, Reader: bytes.NewReader(data)}, nil
+}
+
+// ReadFile reads the blob of a file. The blob of a symbolic link holds its
+// target, which the tree cannot resolve, so links cannot be read this way.
+func (fsys *treeFS) ReadFile(name string) ([]byte, error) {
+	entry, ok := fsys.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	if entry.Mode == git.ModeSymlink {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("symbolic links of a git tree cannot be followed")}
+	}
+	return fsys.tree.repo.ReadBlob(entry.Hash)
+}
+
+func (fsys *treeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, ok := fsys.dirs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]fs.DirEntry(nil), entries...), nil
+}
+
+// ReadLink returns the target of a symbolic link, as stored in its blob.
+func (fsys *treeFS) ReadLink(name string) (string, error) {
+	entry, ok := fsys.entries[name]
+	if !ok {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrNotExist}
+	}
+	if entry.Mode != git.ModeSymlink {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: errors.New("not a symbolic link")}
+	}
+	data, err := fsys.tree.repo.ReadBlob(entry.Hash)
+	return string(data), err
+}
+
+// treeDirEntry is an entry of a treeFS directory. Its size is only known
+// once the blob is read, so Info opens it.
+type treeDirEntry struct {
+	fsys *treeFS
+	path string
+	mode fs.FileMode
+}
+
+func (e treeDirEntry) Name() string      { return path.Base(e.path) }
+func (e treeDirEntry) IsDir() bool       { return e.mode.IsDir() }
+func (e treeDirEntry) Type() fs.FileMode { return e.mode.Type() }
+
+func (e treeDirEntry) Info() (fs.FileInfo, error) {
+	if e.mode&fs.ModeSymlink != 0 {
+		target, err := e.fsys.ReadLink(e.path)
+		if err != nil {
+			return nil, err
+		}
+		return memFileInfo{&memFile{name: e.Name(), data: []byte(target), mode: e.mode}}, nil
+	}
+	return fs.Stat(e.fsys, e.path)
+}
@@ -0,0 +1,137 @@
+package prompt
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// runGit runs the git binary in dir and returns its trimmed output.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test Author", "GIT_AUTHOR_EMAIL=author@example.com",
+		"GIT_COMMITTER_NAME=Test Author", "GIT_COMMITTER_EMAIL=author@example.com",
+		"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir,
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// writeTreeRepo commits a few files and a symbolic link, and returns the
+// working tree, a bare clone and a bundle of it.
+func writeTreeRepo(t *testing.T) (string, string, string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available")
+	}
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q")
+	for name, contents := range map[string]string{
+		".gptignore":     "docs\n",
+		"main.go":        "package main\n",
+		"src/util.go":    "package src\n",
+		"docs/guide.md":  "guide\n",
+		"data/blob.bin":  "\xff\xfe",
+		"src/nested/a.c": "int a;\n",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("src/util.go", filepath.Join(dir, "link.go")); err != nil {
+		t.Skipf("symbolic links not supported: %v", err)
+	}
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "first")
+	bare := filepath.Join(t.TempDir(), "repo.git")
+	runGit(t, dir, "clone", "-q", "--bare", dir, bare)
+	bundle := filepath.Join(t.TempDir(), "repo.bundle")
+	runGit(t, dir, "bundle", "create", bundle, "HEAD", "--all")
+	return dir, bare, bundle
+}
+
+// processTree reads the tree of rev in path with its own pattern files.
+func processTree(t *testing.T, ctx context.Context, path, rev string, opts ProcessOptions) (*GitRepo, error) {
+	t.Helper()
+	tree, err := OpenGitTree(path, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	includeList, err := tree.IncludeList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ignoreList, err := tree.IgnoreList("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree.Process(ctx, includeList, ignoreList, opts)
+}
+
+func TestGitTreeProcess(t *testing.T) {
+	dir, bare, bundle := writeTreeRepo(t)
+	for _, path := range []string{dir, bare, bundle} {
+		var last Progress
+		repo, err := processTree(t, context.Background(), path, "HEAD", ProcessOptions{
+			Symlinks:  RecordSymlinks,
+			Tokenizer: wordTokenizer{},
+			Progress:  func(p Progress) { last = p },
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		var got []string
+		for _, f := range repo.Files {
+			entry := filepath.ToSlash(f.Path)
+			if f.Symlink != "" {
+				entry += " -> " + f.Symlink
+			}
+			got = append(got, entry)
+		}
+		// The walk is the one of working trees: .gptignore applies, binary
+		// files are left out and the link is recorded.
+		want := []string{"link.go -> src/util.go", "main.go", "src/nested/a.c", "src/util.go"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: files = %q, want %q", path, got, want)
+		}
+		if last.FilesIncluded != 4 || last.Tokens != 10 {
+			t.Errorf("%s: last progress = %+v", path, last)
+		}
+		if abs, _ := filepath.Abs(path); repo.Files[0].Root != abs {
+			t.Errorf("%s: root = %q", path, repo.Files[0].Root)
+		}
+	}
+
+	// Unless recorded, links are left out, since the tree cannot resolve
+	// them.
+	repo, err := processTree(t, context.Background(), bare, "", ProcessOptions{Symlinks: FollowSymlinks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.Files) != 3 {
+		t.Errorf("followed links: files = %+v", repo.Files)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var canceled *CanceledError
+	if _, err := processTree(t, ctx, bundle, "", ProcessOptions{}); !errors.As(err, &canceled) {
+		t.Errorf("a canceled context gave %v", err)
+	}
+}
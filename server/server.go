@@ -0,0 +1,373 @@
+// Package server exposes repository snapshots over a read-only HTTP API, so
+// other tools can request git2gpt output without running the command line
+// tool.
+//
+// Endpoints:
+//
+//	GET /repos                   list the repositories below the root
+//	GET /repos/{name}/files      list the selected files and their token counts
+//	GET /repos/{name}/snapshot   render a snapshot of the repository
+//
+// The files and snapshot endpoints accept these query parameters:
+//
+//	format=text|json|xml   output format (snapshot only, default text)
+//	format=openai|anthropic  request body for that API (snapshot only)
+//	model=<name>           model of the request body
+//	max_tokens=<n>         maximum answer tokens of the request body
+//	question=<text>        question ending the request body
+//	ref=<rev>              read the tree of a branch, tag or commit instead of the working tree
+//	include=<glob>         only include matching files; repeatable, replaces .gptinclude
+//	ignore=<glob>          additionally ignore matching files; repeatable
+//	gitignore=false        do not apply .gitignore
+//	budget=<tokens>        drop files until the total fits within the token budget
+//	scrub=true             remove code comments (snapshot only)
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chand1012/git2gpt/git"
+	"github.com/chand1012/git2gpt/prompt"
+)
+
+// maxRepoDepth limits how far below the root repositories are searched for.
+const maxRepoDepth = 4
+
+// Server serves the repositories found below Root.
+type Server struct {
+	Root string
+	// Tokenizer counts the tokens of files and outputs; nil means
+	// prompt.DefaultTokenizer. Use DiskCache.Tokenizer to cache the counts.
+	Tokenizer prompt.Tokenizer
+}
+
+// New returns a server for the repositories below root.
+func New(root string) (*Server, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	abs, err = filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+	return &Server{Root: abs}, nil
+}
+
+// RepoInfo describes a repository in the /repos listing.
+type RepoInfo struct {
+	Name   string `json:"name"`
+	Branch string `json:"branch,omitempty"`
+	Head   string `json:"head,omitempty"`
+}
+
+// FileInfo describes a file in the /repos/{name}/files listing.
+type FileInfo struct {
+	Path   string `json:"path"`
+	Tokens int64  `json:"tokens"`
+}
+
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, &httpError{http.StatusMethodNotAllowed, "the server is read-only"})
+		return
+	}
+	var err error
+	switch {
+	case r.URL.Path == "/repos" || r.URL.Path == "/repos/":
+		err = s.listRepos(w)
+	case strings.HasPrefix(r.URL.Path, "/repos/"):
+		rest := strings.TrimPrefix(r.URL.Path, "/repos/")
+		i := strings.LastIndex(rest, "/")
+		if i < 0 {
+			err = &httpError{http.StatusNotFound, "not found"}
+			break
+		}
+		name, action := rest[:i], rest[i+1:]
+		switch action {
+		case "snapshot":
+			err = s.snapshot(w, r, name)
+		case "files":
+			err = s.listFiles(w, r, name)
+		default:
+			err = &httpError{http.StatusNotFound, "not found"}
+		}
+	default:
+		err = &httpError{http.StatusNotFound, "not found"}
+	}
+	if err != nil {
+		writeError(w, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var he *httpError
+	if errors.As(err, &he) {
+		status = he.status
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) listRepos(w http.ResponseWriter) error {
+	repos := []RepoInfo{}
+	err := filepath.WalkDir(s.Root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(s.Root, p)
+		if d.Name() == ".git" || strings.Count(filepath.ToSlash(rel), "/") >= maxRepoDepth {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(p, ".git")); err != nil {
+			return nil
+		}
+		repo, err := git.Open(p)
+		if err != nil {
+			return nil
+		}
+		defer repo.Close()
+		info := RepoInfo{Name: filepath.ToSlash(rel), Branch: repo.HeadBranch()}
+		if head, err := repo.Head(); err == nil {
+			info.Head = head.String()
+		}
+		repos = append(repos, info)
+		// Nested repositories are reached through their parent.
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Name < repos[j].Name })
+	return writeJSON(w, map[string]any{"repos": repos})
+}
+
+// resolveRepo maps a repository name from the URL to a directory, refusing
+// anything that would escape the root.
+func (s *Server) resolveRepo(name string) (string, error) {
+	notFound := &httpError{http.StatusNotFound, fmt.Sprintf("repository %q not found", name)}
+	if name == "" || name == "." {
+		name = "."
+	} else if path.IsAbs(name) || strings.Contains(name, "\\") {
+		return "", notFound
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." || part == ".git" {
+			return "", notFound
+		}
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Join(s.Root, filepath.FromSlash(name)))
+	if err != nil {
+		return "", notFound
+	}
+	if dir != s.Root && !strings.HasPrefix(dir, s.Root+string(filepath.Separator)) {
+		return "", notFound
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return "", notFound
+	}
+	return dir, nil
+}
+
+// loadRepo builds the GitRepo for a request, applying the query parameter
+// overrides.
+func (s *Server) loadRepo(r *http.Request, name string) (*prompt.GitRepo, error) {
+	dir, err := s.resolveRepo(name)
+	if err != nil {
+		return nil, err
+	}
+	q := r.URL.Query()
+	useGitignore := q.Get("gitignore") != "false"
+	var budget int64
+	if b := q.Get("budget"); b != "" {
+		budget, err = strconv.ParseInt(b, 10, 64)
+		if err != nil || budget < 0 {
+			return nil, &httpError{http.StatusBadRequest, fmt.Sprintf("invalid budget %q", b)}
+		}
+	}
+
+	if err := prompt.ValidatePatterns(append(q["include"], q["ignore"]...)); err != nil {
+		return nil, &httpError{http.StatusBadRequest, err.Error()}
+	}
+
+	var repo *prompt.GitRepo
+	if ref := q.Get("ref"); ref != "" {
+		tree, err := prompt.OpenGitTree(dir, ref)
+		if err != nil {
+			if errors.Is(err, git.ErrNotExist) {
+				return nil, &httpError{http.StatusNotFound, err.Error()}
+			}
+			return nil, err
+		}
+		defer tree.Close()
+		includeList, err := tree.IncludeList("")
+		if err != nil {
+			return nil, err
+		}
+		if q.Has("include") {
+			includeList = q["include"]
+		}
+		ignoreList, err := tree.IgnoreList("", useGitignore)
+		if err != nil {
+			return nil, err
+		}
+		opts := prompt.ProcessOptions{OnError: prompt.SkipOnError, Tokenizer: s.Tokenizer}
+		repo, err = tree.Process(r.Context(), includeList, append(ignoreList, q["ignore"]...), opts)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		includeList, err := prompt.LoadIncludeList(dir, "")
+		if err != nil {
+			return nil, err
+		}
+		if q.Has("include") {
+			includeList = q["include"]
+		}
+		ignoreList, err := prompt.LoadIgnoreList(dir, "", useGitignore)
+		if err != nil {
+			return nil, err
+		}
+		// Unreadable files are left out rather than failing the request.
+		opts := prompt.ProcessOptions{OnError: prompt.SkipOnError, IgnoreGitignore: !useGitignore, Tokenizer: s.Tokenizer}
+		repo, err = prompt.ProcessGitRepoContext(r.Context(), dir, includeList, append(ignoreList, q["ignore"]...), opts)
+		if err != nil {
+			return nil, err
+		}
+		s.dropEscapingFiles(dir, repo)
+	}
+	prompt.ApplyTokenBudget(repo, budget)
+	return repo, nil
+}
+
+// dropEscapingFiles removes files that are symbolic links to somewhere
+// outside the root, so a repository cannot be used to read arbitrary files
+// from the server.
+func (s *Server) dropEscapingFiles(dir string, repo *prompt.GitRepo) {
+	kept := repo.Files[:0]
+	for _, f := range repo.Files {
+		real, err := filepath.EvalSymlinks(filepath.Join(dir, f.Path))
+		if err != nil || !strings.HasPrefix(real, s.Root+string(filepath.Separator)) {
+			continue
+		}
+		kept = append(kept, f)
+	}
+	repo.Files = kept
+	repo.FileCount = len(kept)
+}
+
+func (s *Server) listFiles(w http.ResponseWriter, r *http.Request, name string) error {
+	repo, err := s.loadRepo(r, name)
+	if err != nil {
+		return err
+	}
+	files := []FileInfo{}
+	for _, f := range repo.Files {
+		files = append(files, FileInfo{Path: filepath.ToSlash(f.Path), Tokens: f.Tokens})
+	}
+	return writeJSON(w, map[string]any{"files": files})
+}
+
+func (s *Server) snapshot(w http.ResponseWriter, r *http.Request, name string) error {
+	format := r.URL.Query().Get("format")
+	contentType := "text/plain; charset=utf-8"
+	switch format {
+	case "", prompt.FormatText:
+	case prompt.FormatJSON:
+		contentType = "application/json"
+	case prompt.FormatXML:
+		contentType = "application/xml"
+	case prompt.FormatOpenAI, prompt.FormatAnthropic:
+		contentType = "application/json"
+	default:
+		return &httpError{http.StatusBadRequest, fmt.Sprintf("unknown format %q", format)}
+	}
+	repo, err := s.loadRepo(r, name)
+	if err != nil {
+		return err
+	}
+	// Preamble files are never read on behalf of a client, so the server
+	// cannot be used to read files outside the repositories.
+	scrub := r.URL.Query().Get("scrub") == "true"
+	var opts prompt.RequestOptions
+	if format == prompt.FormatOpenAI || format == prompt.FormatAnthropic {
+		opts.Model = r.URL.Query().Get("model")
+		if v := r.URL.Query().Get("max_tokens"); v != "" {
+			if opts.MaxTokens, err = strconv.Atoi(v); err != nil || opts.MaxTokens < 1 {
+				return &httpError{http.StatusBadRequest, fmt.Sprintf("invalid max_tokens %q", v)}
+			}
+		}
+		repo.Task = r.URL.Query().Get("question")
+	}
+	w.Header().Set("Content-Type", contentType)
+	if r.Method == http.MethodHead {
+		// A HEAD response has no trailers, so the count goes in a header and
+		// the output is rendered only to count it.
+		if err := prompt.WriteRepo(r.Context(), io.Discard, repo, format, "", scrub, opts, s.Tokenizer); err != nil {
+			return err
+		}
+		w.Header().Set("X-Total-Tokens", strconv.FormatInt(repo.TotalTokens, 10))
+		return nil
+	}
+	// The output is sent as it is rendered, so its token count is only
+	// known at the end and follows the body as a trailer.
+	w.Header().Set("Trailer", "X-Total-Tokens")
+	out := &startedWriter{w: w}
+	if err := prompt.WriteRepo(r.Context(), out, repo, format, "", scrub, opts, s.Tokenizer); err != nil {
+		if !out.started {
+			return err
+		}
+		// Once the response has started, errors cannot be reported to the
+		// client, which sees the body end without the trailer.
+		return nil
+	}
+	w.Header().Set("X-Total-Tokens", strconv.FormatInt(repo.TotalTokens, 10))
+	return nil
+}
+
+// startedWriter records whether anything was written to w, after which an
+// error response can no longer be sent.
+type startedWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (s *startedWriter) Write(p []byte) (int, error) {
+	s.started = true
+	return s.w.Write(p)
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available")
+	}
+	root := t.TempDir()
+	repo := filepath.Join(root, "team", "app")
+	writeFile(t, filepath.Join(repo, "main.go"), "package main\n")
+	writeFile(t, filepath.Join(repo, "README.md"), "# committed\n")
+	runGit(t, repo, "init", "-q")
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-q", "-m", "init")
+	runGit(t, repo, "tag", "v1")
+	writeFile(t, filepath.Join(repo, "README.md"), "# working tree\n")
+	writeFile(t, filepath.Join(root, "secret.txt"), "outside any repository\n")
+
+	srv, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	return ts, repo
+}
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestListRepos(t *testing.T) {
+	ts, _ := newTestServer(t)
+	status, body := get(t, ts.URL+"/repos")
+	if status != http.StatusOK {
+		t.Fatalf("status %d: %s", status, body)
+	}
+	var result struct {
+		Repos []RepoInfo `json:"repos"`
+	}
+	if err := json.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Repos) != 1 || result.Repos[0].Name != "team/app" || len(result.Repos[0].Head) != 40 {
+		t.Errorf("unexpected repos: %+v", result.Repos)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	status, body := get(t, ts.URL+"/repos/team/app/snapshot")
+	if status != http.StatusOK || !strings.Contains(body, "# working tree") || !strings.HasSuffix(body, "--END--") {
+		t.Errorf("text snapshot: %d %s", status, body)
+	}
+
+	status, body = get(t, ts.URL+"/repos/team/app/snapshot?ref=v1&format=json")
+	if status != http.StatusOK {
+		t.Fatalf("ref snapshot: %d %s", status, body)
+	}
+	var repo struct {
+		Files []struct {
+			Path     string `json:"path"`
+			Contents string `json:"contents"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal([]byte(body), &repo); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.Files) != 2 || repo.Files[0].Contents != "# committed\n" {
+		t.Errorf("unexpected files at v1: %+v", repo.Files)
+	}
+
+	status, body = get(t, ts.URL+"/repos/team/app/files?include=*.go")
+	if status != http.StatusOK || !strings.Contains(body, "main.go") || strings.Contains(body, "README.md") {
+		t.Errorf("include override: %d %s", status, body)
+	}
+	status, body = get(t, ts.URL+"/repos/team/app/files?ignore=*.md")
+	if status != http.StatusOK || strings.Contains(body, "README.md") {
+		t.Errorf("ignore override: %d %s", status, body)
+	}
+
+	status, body = get(t, ts.URL+"/repos/team/app/snapshot?format=xml")
+	if status != http.StatusOK || !strings.HasPrefix(body, "<?xml") {
+		t.Errorf("xml snapshot: %d %s", status, body)
+	}
+
+	status, body = get(t, ts.URL+"/repos/team/app/snapshot?format=anthropic&model=m&max_tokens=10&question=Why%3F")
+	if status != http.StatusOK || !strings.Contains(body, `"model":"m","max_tokens":10`) || !strings.Contains(body, `"text":"Why?"`) {
+		t.Errorf("anthropic snapshot: %d %s", status, body)
+	}
+}
+
+// wordTokenizer counts words, so token counts do not depend on tiktoken.
+type wordTokenizer struct{}
+
+func (wordTokenizer) Name() string { return "words" }
+
+func (wordTokenizer) CountTokens(text string) (int64, error) {
+	return int64(len(strings.Fields(text))), nil
+}
+
+func TestSnapshotTokenTrailer(t *testing.T) {
+	ts, _ := newTestServer(t)
+	ts.Config.Handler.(*Server).Tokenizer = wordTokenizer{}
+
+	resp, err := http.Get(ts.URL + "/repos/team/app/snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	// The body is streamed, so the count is announced as a trailer and
+	// only set once the body is read.
+	if resp.Header.Get("X-Total-Tokens") != "" || resp.Trailer == nil {
+		t.Errorf("headers = %v, trailer = %v", resp.Header, resp.Trailer)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strconv.Itoa(len(strings.Fields(string(body))))
+	if got := resp.Trailer.Get("X-Total-Tokens"); got != want {
+		t.Errorf("X-Total-Tokens trailer = %q, want %q", got, want)
+	}
+
+	// A HEAD response has no body or trailers, so it sends the count as a
+	// header.
+	resp, err = http.Head(ts.URL + "/repos/team/app/snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Total-Tokens"); got != want {
+		t.Errorf("HEAD X-Total-Tokens = %q, want %q", got, want)
+	}
+}
+
+func TestErrorsAndConfinement(t *testing.T) {
+	ts, repo := newTestServer(t)
+	if err := os.Symlink(filepath.Join(repo, "..", "..", "secret.txt"), filepath.Join(repo, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+	writeFile(t, filepath.Join(outside, "passwd"), "root:x:0:0\n")
+	if err := os.Symlink(filepath.Join(outside, "passwd"), filepath.Join(repo, "escape.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	status, body := get(t, ts.URL+"/repos/team/app/snapshot")
+	if status != http.StatusOK || strings.Contains(body, "root:x:0:0") {
+		t.Errorf("symlink outside the root was followed: %s", body)
+	}
+
+	for _, tc := range []struct {
+		url    string
+		status int
+	}{
+		{"/repos/team/../team/app/snapshot", http.StatusNotFound},
+		{"/repos/team/snapshot", http.StatusNotFound},
+		{"/repos/missing/snapshot", http.StatusNotFound},
+		{"/repos/team/app/snapshot?format=yaml", http.StatusBadRequest},
+		{"/repos/team/app/snapshot?budget=lots", http.StatusBadRequest},
+		{"/repos/team/app/snapshot?include=[", http.StatusBadRequest},
+		{"/repos/team/app/snapshot?ref=no-such-branch", http.StatusNotFound},
+		{"/elsewhere", http.StatusNotFound},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+tc.url, nil)
+		// Send the path as written, without client-side cleaning.
+		req.URL.Opaque = strings.SplitN(tc.url, "?", 2)[0]
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("GET %s = %d, want %d", tc.url, resp.StatusCode, tc.status)
+		}
+	}
+
+	resp, err := http.Post(ts.URL+"/repos", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST = %d, want 405", resp.StatusCode)
+	}
+}